@@ -1,8 +1,15 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"stravamcp/pkg/analytics"
+	"stravamcp/pkg/query"
+	"stravamcp/pkg/sport"
+	"stravamcp/pkg/trackfile"
 	"stravamcp/service"
+	"strconv"
 	"time"
 )
 
@@ -10,6 +17,13 @@ type ActivityController interface {
 	RefreshActivities(c *gin.Context)
 	GetAllActivities(c *gin.Context)
 	GetActivityStream(c *gin.Context)
+	GetDecoupling(c *gin.Context)
+	DetectIntervals(c *gin.Context)
+	GetSplits(c *gin.Context)
+	GetClimbs(c *gin.Context)
+	GetPersonalRecords(c *gin.Context)
+	ExportActivity(c *gin.Context)
+	ReconcileActivities(c *gin.Context)
 }
 type activityController struct {
 	activityService service.ActivityService
@@ -20,22 +34,59 @@ func NewActivityController(activityService service.ActivityService) ActivityCont
 }
 
 func (ctrl *activityController) RefreshActivities(c *gin.Context) {
-	err := ctrl.activityService.ProcessActivities(time.Now().Add(time.Hour * 24 * -365))
+	var result *service.SyncResult
+	var err error
+	if after := c.Query("after"); after != "" {
+		afterDate, parseErr := time.Parse(time.RFC3339, after)
+		if parseErr != nil {
+			c.JSON(400, gin.H{"error": "invalid 'after' date, use ISO 8601 (e.g. 2024-01-15T00:00:00Z)"})
+			return
+		}
+		result, err = ctrl.activityService.ProcessActivities(afterDate)
+	} else {
+		result, err = ctrl.activityService.SyncActivities()
+	}
 	if err != nil {
 		c.JSON(500, err)
 		return
 	}
-	c.Status(200)
+	c.JSON(200, result)
 }
 
 func (ctrl *activityController) GetAllActivities(c *gin.Context) {
 	filter := c.Param("filter")
-	activities, err := ctrl.activityService.GetAllActivities(c, filter, nil, nil)
+	var maxStaleness time.Duration
+	if value := c.Query("max_staleness"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid 'max_staleness', use a duration such as 30m or 6h"})
+			return
+		}
+		maxStaleness = parsed
+	}
+	q, err := query.Parse(c.Query("q"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	list, err := ctrl.activityService.GetAllActivities(c, filter, q, nil, nil, maxStaleness)
+	if errors.Is(err, sport.ErrUnknown) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(500, err)
 		return
 	}
-	c.JSON(200, activities)
+	// The body stays a plain array; freshness travels in headers.
+	freshness := list.Freshness
+	if freshness.LastSyncAt != "" {
+		c.Header("X-Last-Sync", freshness.LastSyncAt)
+		c.Header("Age", strconv.FormatInt(*freshness.AgeSeconds, 10))
+	}
+	c.Header("X-Stale", strconv.FormatBool(freshness.Stale))
+	c.Header("X-Refreshing", strconv.FormatBool(freshness.Refreshing))
+	c.JSON(200, list.Activities)
 }
 
 func (ctrl *activityController) GetActivityStream(c *gin.Context) {
@@ -47,3 +98,105 @@ func (ctrl *activityController) GetActivityStream(c *gin.Context) {
 	}
 	c.JSON(200, activityStream)
 }
+
+func (ctrl *activityController) GetDecoupling(c *gin.Context) {
+	decoupling, err := ctrl.activityService.GetDecoupling(c, c.Param("id"))
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, decoupling)
+}
+
+func (ctrl *activityController) DetectIntervals(c *gin.Context) {
+	intervals, err := ctrl.activityService.DetectIntervals(c, c.Param("id"))
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, intervals)
+}
+
+func (ctrl *activityController) GetSplits(c *gin.Context) {
+	unit, err := analytics.ParseSplitUnit(c.Query("unit"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	splits, err := ctrl.activityService.GetSplits(c, c.Param("id"), unit)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, splits)
+}
+
+func (ctrl *activityController) GetClimbs(c *gin.Context) {
+	climbs, err := ctrl.activityService.GetClimbs(c, c.Param("id"))
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, climbs)
+}
+
+func (ctrl *activityController) GetPersonalRecords(c *gin.Context) {
+	year := 0
+	if value := c.Query("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid year, use e.g. 2024"})
+			return
+		}
+		year = parsed
+	}
+	records, err := ctrl.activityService.GetPersonalRecords(c, year)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, records)
+}
+
+func (ctrl *activityController) ExportActivity(c *gin.Context) {
+	// Registered under /activities/:filter/export, gin requires the wildcard to share its name.
+	id := c.Param("filter")
+	format, err := trackfile.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	export, err := ctrl.activityService.ExportActivity(c, id, format)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.FileName))
+	c.Data(200, export.ContentType, export.Data)
+}
+
+func (ctrl *activityController) ReconcileActivities(c *gin.Context) {
+	before := time.Now()
+	after := before.Add(-30 * 24 * time.Hour)
+	for name, target := range map[string]*time.Time{"after": &after, "before": &before} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("invalid '%s' date, use ISO 8601 (e.g. 2024-01-15T00:00:00Z)", name)})
+				return
+			}
+			*target = parsed
+		}
+	}
+	mode, err := service.ParseReconcileMode(c.Query("mode"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := ctrl.activityService.ReconcileActivities(after, before, mode)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "result": result})
+		return
+	}
+	c.JSON(200, result)
+}
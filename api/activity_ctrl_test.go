@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"stravamcp/model"
+	"stravamcp/repo"
+	"stravamcp/service"
+	"testing"
+)
+
+// newTestActivityService returns a cache-only activity service holding one run and one ride.
+func newTestActivityService(t *testing.T) service.ActivityService {
+	t.Helper()
+	storage := repo.NewStorage(t.TempDir())
+	for _, activity := range []model.AthleteActivity{
+		{ID: 1, Name: "Morning Run", Type: "Run", SportType: "Run", StartDate: "2026-01-02T07:00:00Z"},
+		{ID: 2, Name: "Gravel loop", Type: "Ride", SportType: "GravelRide", StartDate: "2026-01-03T09:00:00Z"},
+	} {
+		if err := storage.SaveAthleteActivity(&activity); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return service.NewActivityService(nil, nil, storage, service.SyncConfig{})
+}
+
+func TestGetAllActivitiesSportFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := NewActivityController(newTestActivityService(t))
+	r.GET("/api/activities", ctrl.GetAllActivities)
+	r.GET("/api/activities/:filter", ctrl.GetAllActivities)
+
+	tests := []struct {
+		path string
+		code int
+		ids  []int64
+	}{
+		{"/api/activities", http.StatusOK, []int64{2, 1}},
+		{"/api/activities/runs", http.StatusOK, []int64{1}},
+		{"/api/activities/GravelRide", http.StatusOK, []int64{2}},
+		{"/api/activities/cycling", http.StatusOK, []int64{2}},
+		{"/api/activities/quidditch", http.StatusBadRequest, nil},
+		{"/api/activities/runz", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.code {
+				t.Fatalf("GET %s = %d, want %d: %s", tt.path, w.Code, tt.code, w.Body)
+			}
+			var ids []int64
+			if w.Code == http.StatusOK {
+				var activities []model.AthleteActivity
+				if err := json.Unmarshal(w.Body.Bytes(), &activities); err != nil {
+					t.Fatal(err)
+				}
+				ids = activityIDs(activities)
+			}
+			if !slices.Equal(ids, tt.ids) {
+				t.Errorf("GET %s returned activities %v, want %v", tt.path, ids, tt.ids)
+			}
+		})
+	}
+}
+
+func activityIDs(activities []model.AthleteActivity) []int64 {
+	var ids []int64
+	for _, activity := range activities {
+		ids = append(ids, activity.ID)
+	}
+	return ids
+}
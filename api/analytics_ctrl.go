@@ -0,0 +1,257 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"stravamcp/pkg/geo"
+	"stravamcp/pkg/sport"
+	"stravamcp/repo"
+	"stravamcp/service"
+	"strconv"
+	"time"
+)
+
+type AnalyticsController interface {
+	GetTrainingLoad(c *gin.Context)
+	GetPowerAnalysis(c *gin.Context)
+	GetPowerCurve(c *gin.Context)
+	GetActivityZones(c *gin.Context)
+	GetZoneDistribution(c *gin.Context)
+	GetSummary(c *gin.Context)
+	GetGoals(c *gin.Context)
+	SaveGoals(c *gin.Context)
+	GetGoalProgress(c *gin.Context)
+	FindSimilarActivities(c *gin.Context)
+	SearchActivitiesByLocation(c *gin.Context)
+}
+type analyticsController struct {
+	analyticsService service.AnalyticsService
+}
+
+func NewAnalyticsController(analyticsService service.AnalyticsService) AnalyticsController {
+	return &analyticsController{analyticsService: analyticsService}
+}
+
+func (ctrl *analyticsController) GetTrainingLoad(c *gin.Context) {
+	after, before, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	load, err := ctrl.analyticsService.GetTrainingLoad(c, after, before)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, load)
+}
+
+func (ctrl *analyticsController) GetPowerAnalysis(c *gin.Context) {
+	analysis, err := ctrl.analyticsService.GetPowerAnalysis(c, c.Param("id"))
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, analysis)
+}
+
+func (ctrl *analyticsController) GetPowerCurve(c *gin.Context) {
+	after, before, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	curve, err := ctrl.analyticsService.GetPowerCurve(c, after, before)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, curve)
+}
+
+func (ctrl *analyticsController) GetActivityZones(c *gin.Context) {
+	zones, err := ctrl.analyticsService.GetActivityZones(c, c.Param("id"))
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, zones)
+}
+
+func (ctrl *analyticsController) GetZoneDistribution(c *gin.Context) {
+	after, before, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	groupBy, err := service.ParseGrouping(c.Query("group_by"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	distribution, err := ctrl.analyticsService.GetZoneDistribution(c, c.Query("sport"), after, before, groupBy)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, distribution)
+}
+
+func (ctrl *analyticsController) GetSummary(c *gin.Context) {
+	after, before, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	groupBy, err := service.ParseGrouping(c.Query("group_by"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	summary, err := ctrl.analyticsService.GetSummary(c, c.Query("sport"), after, before, groupBy)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, summary)
+}
+
+func (ctrl *analyticsController) GetGoals(c *gin.Context) {
+	goals, err := ctrl.analyticsService.GetGoals(c)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, goals)
+}
+
+// SaveGoals replaces all goals with the JSON array in the request body.
+func (ctrl *analyticsController) SaveGoals(c *gin.Context) {
+	var goals []repo.Goal
+	if err := c.ShouldBindJSON(&goals); err != nil {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("invalid goals: %v", err)})
+		return
+	}
+	if goals == nil {
+		goals = []repo.Goal{}
+	}
+	if err := ctrl.analyticsService.SaveGoals(c, goals); err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, goals)
+}
+
+func (ctrl *analyticsController) GetGoalProgress(c *gin.Context) {
+	progress, err := ctrl.analyticsService.GetGoalProgress(c)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, progress)
+}
+
+func (ctrl *analyticsController) FindSimilarActivities(c *gin.Context) {
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(400, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+	similar, err := ctrl.analyticsService.FindSimilarActivities(c, c.Param("id"), limit)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, similar)
+}
+
+// SearchActivitiesByLocation reads 'lat', 'lng' and 'radius' in meters, or 'bbox' as
+// south,west,north,east with optional 'within', besides 'sport', 'after', 'before' and 'limit'.
+func (ctrl *analyticsController) SearchActivitiesByLocation(c *gin.Context) {
+	after, before, err := parseDateRange(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	query := service.LocationQuery{Sport: c.Query("sport"), After: after, Before: before, Within: c.Query("within") == "true"}
+	for name, target := range map[string]**float64{"lat": &query.Lat, "lng": &query.Lng} {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("invalid '%s'", name)})
+				return
+			}
+			*target = &parsed
+		}
+	}
+	if value := c.Query("radius"); value != "" {
+		query.Radius, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid 'radius'"})
+			return
+		}
+	}
+	if value := c.Query("bbox"); value != "" {
+		box, err := geo.ParseBoundingBox(value)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		query.Box = &box
+	}
+	if value := c.Query("limit"); value != "" {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil || query.Limit < 0 {
+			c.JSON(400, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+	search, err := ctrl.analyticsService.SearchActivitiesByLocation(c, query)
+	if err != nil {
+		c.JSON(analyticsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, search)
+}
+
+// analyticsErrorStatus maps invalid input to 400, data missing from the cache to 404 and
+// activities that lack what an analysis needs, such as power or heart rate, to 422.
+func analyticsErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sport.ErrUnknown), errors.Is(err, service.ErrInvalidGoal), errors.Is(err, service.ErrInvalidLocation),
+		errors.Is(err, service.ErrInvalidRange):
+		return 400
+	case errors.Is(err, service.ErrActivityNotCached), errors.Is(err, service.ErrStreamNotCached):
+		return 404
+	case errors.Is(err, service.ErrNoPowerData), errors.Is(err, service.ErrNoHeartRateData), errors.Is(err, service.ErrNoDecouplingData),
+		errors.Is(err, service.ErrNoIntervalData), errors.Is(err, service.ErrNoDistanceData),
+		errors.Is(err, service.ErrNoElevationData), errors.Is(err, service.ErrNoRouteData):
+		return 422
+	}
+	return 500
+}
+
+// parseDateRange reads the optional ISO 8601 'after' and 'before' query parameters.
+func parseDateRange(c *gin.Context) (*time.Time, *time.Time, error) {
+	var after, before *time.Time
+	for name, target := range map[string]**time.Time{"after": &after, "before": &before} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid '%s' date, use ISO 8601 (e.g. 2024-01-15T00:00:00Z)", name)
+		}
+		*target = &parsed
+	}
+	if after != nil && before != nil && before.Before(*after) {
+		return nil, nil, fmt.Errorf("'before' date must be after 'after' date")
+	}
+	return after, before, nil
+}
@@ -5,7 +5,7 @@ import (
 	"stravamcp/service"
 )
 
-func SetupRouter(activityService service.ActivityService) *gin.Engine {
+func SetupRouter(activityService service.ActivityService, archiveService service.ArchiveService, backfillService service.BackfillService, scheduler service.SyncScheduler, analyticsService service.AnalyticsService) *gin.Engine {
 	gin.SetMode(gin.DebugMode)
 	r := gin.New()
 	r.RedirectTrailingSlash = false
@@ -17,12 +17,38 @@ func SetupRouter(activityService service.ActivityService) *gin.Engine {
 	})
 
 	activityController := NewActivityController(activityService)
+	archiveController := NewArchiveController(archiveService)
+	syncController := NewSyncController(backfillService, scheduler)
+	analyticsController := NewAnalyticsController(analyticsService)
 	apiGroup := r.Group("/api")
 	{
 		apiGroup.GET("/activities/refresh", activityController.RefreshActivities)
+		apiGroup.POST("/activities/reconcile", activityController.ReconcileActivities)
 		apiGroup.GET("/activities", activityController.GetAllActivities)
 		apiGroup.GET("/activities/:filter", activityController.GetAllActivities)
 		apiGroup.GET("/activities/stream/:id", activityController.GetActivityStream)
+		apiGroup.GET("/activities/decoupling/:id", activityController.GetDecoupling)
+		apiGroup.GET("/activities/intervals/:id", activityController.DetectIntervals)
+		apiGroup.GET("/activities/splits/:id", activityController.GetSplits)
+		apiGroup.GET("/activities/climbs/:id", activityController.GetClimbs)
+		apiGroup.GET("/activities/records", activityController.GetPersonalRecords)
+		apiGroup.GET("/activities/location", analyticsController.SearchActivitiesByLocation)
+		apiGroup.GET("/activities/:filter/export", activityController.ExportActivity)
+		apiGroup.GET("/export/:dataset", archiveController.Export)
+		apiGroup.POST("/import/:dataset", archiveController.Import)
+		apiGroup.GET("/sync/status", syncController.GetStatus)
+		apiGroup.GET("/sync/backfill", syncController.GetBackfill)
+		apiGroup.POST("/sync/backfill", syncController.StartBackfill)
+		apiGroup.GET("/analytics/training-load", analyticsController.GetTrainingLoad)
+		apiGroup.GET("/analytics/power/:id", analyticsController.GetPowerAnalysis)
+		apiGroup.GET("/analytics/power-curve", analyticsController.GetPowerCurve)
+		apiGroup.GET("/analytics/zones", analyticsController.GetZoneDistribution)
+		apiGroup.GET("/analytics/zones/:id", analyticsController.GetActivityZones)
+		apiGroup.GET("/analytics/similar/:id", analyticsController.FindSimilarActivities)
+		apiGroup.GET("/summary", analyticsController.GetSummary)
+		apiGroup.GET("/goals", analyticsController.GetGoals)
+		apiGroup.PUT("/goals", analyticsController.SaveGoals)
+		apiGroup.GET("/goals/progress", analyticsController.GetGoalProgress)
 	}
 	return r
 }
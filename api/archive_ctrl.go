@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"stravamcp/pkg/archive"
+	"stravamcp/service"
+	"time"
+)
+
+type ArchiveController interface {
+	Export(c *gin.Context)
+	Import(c *gin.Context)
+}
+type archiveController struct {
+	archiveService service.ArchiveService
+}
+
+func NewArchiveController(archiveService service.ArchiveService) ArchiveController {
+	return &archiveController{archiveService: archiveService}
+}
+
+func (ctrl *archiveController) Export(c *gin.Context) {
+	dataset, format, err := parseArchiveParams(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	fileName := fmt.Sprintf("strava-%s-%s.%s", dataset, time.Now().Format("20060102"), format)
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Status(200)
+	// The status line is already sent, so a failure part-way through can only be logged.
+	if _, err := ctrl.archiveService.Export(c.Writer, dataset, format); err != nil {
+		slog.Error("Export failed", "dataset", dataset, "format", format, "error", err)
+	}
+}
+
+func (ctrl *archiveController) Import(c *gin.Context) {
+	dataset, format, err := parseArchiveParams(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := ctrl.archiveService.Import(c.Request.Body, dataset, format)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error(), "result": result})
+		return
+	}
+	c.JSON(200, result)
+}
+
+func parseArchiveParams(c *gin.Context) (archive.Dataset, archive.Format, error) {
+	dataset, err := archive.ParseDataset(c.Param("dataset"))
+	if err != nil {
+		return "", "", err
+	}
+	format, err := archive.ParseFormat(c.Query("format"))
+	if err != nil {
+		return "", "", err
+	}
+	return dataset, format, nil
+}
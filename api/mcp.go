@@ -1,10 +1,17 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
+	"slices"
+	"stravamcp/pkg/query"
+	"stravamcp/pkg/sport"
+	"stravamcp/pkg/trackfile"
 	"stravamcp/service"
 	"strings"
 	"time"
@@ -30,13 +37,19 @@ type MCPError struct {
 }
 
 type MCPServer struct {
-	activityService service.ActivityService
-	upgrader        websocket.Upgrader
+	activityService  service.ActivityService
+	archiveService   service.ArchiveService
+	backfillService  service.BackfillService
+	analyticsService service.AnalyticsService
+	upgrader         websocket.Upgrader
 }
 
-func NewMCPServer(activityService service.ActivityService) *MCPServer {
+func NewMCPServer(activityService service.ActivityService, archiveService service.ArchiveService, backfillService service.BackfillService, analyticsService service.AnalyticsService) *MCPServer {
 	return &MCPServer{
-		activityService: activityService,
+		activityService:  activityService,
+		archiveService:   archiveService,
+		backfillService:  backfillService,
+		analyticsService: analyticsService,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for development
@@ -104,7 +117,11 @@ func (s *MCPServer) getToolList(req MCPRequest) MCPResponse {
 						"properties": map[string]interface{}{
 							"filter": map[string]interface{}{
 								"type":        "string",
-								"description": "Activity type filter (e.g., 'runs', 'rides', 'swims')",
+								"description": "Sport filter: a Strava sport type (e.g. 'GravelRide', 'TrailRun'), a colloquial name ('mtb', 'zwift', 'xc ski') or a group ('runs', 'rides', 'cycling', 'swims', 'walking', 'skiing', 'fitness')",
+							},
+							"query": map[string]interface{}{
+								"type":        "string",
+								"description": "Filter expression with optional sort and limit, e.g. 'sport_type in (Run, TrailRun) and distance > 10km and avg_hr < 150 and name ~ \"tempo\" sort by distance desc limit 5'. Literals take units (km, mi, ft, 1h30m, kmh, 5:00/km); dates are written 2024-06-01",
 							},
 							"before": map[string]interface{}{
 								"type":        "string",
@@ -114,6 +131,10 @@ func (s *MCPServer) getToolList(req MCPRequest) MCPResponse {
 								"type":        "string",
 								"description": "Return activities after this date (ISO 8601 format)",
 							},
+							"max_staleness": map[string]interface{}{
+								"type":        "string",
+								"description": "If the cache was last synced longer ago than this duration (e.g. '30m', '6h'), start a background refresh. Results always come from the local cache",
+							},
 						},
 					},
 				},
@@ -139,17 +160,352 @@ func (s *MCPServer) getToolList(req MCPRequest) MCPResponse {
 						"properties": map[string]interface{}{
 							"after": map[string]interface{}{
 								"type":        "string",
-								"description": "Refresh activities after this date (ISO 8601 format). Defaults to 1 month ago if not provided",
+								"description": "Re-scan activities after this date (ISO 8601 format). Without it only activities newer than the last sync are fetched",
+							},
+						},
+					},
+				},
+				{
+					"name":        "analyze_fit_file",
+					"description": "Decode a local FIT file (e.g. from a bike computer) and summarise it without uploading it to Strava",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"path": map[string]interface{}{
+								"type":        "string",
+								"description": "Path to a .fit or .fit.gz file on the machine running the server",
+							},
+						},
+						"required": []string{"path"},
+					},
+				},
+				{
+					"name":        "export_activity",
+					"description": "Export an activity as a GPX or TCX file for use in other tools (Garmin, Komoot, GoldenCheetah, ...)",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"activity_id": map[string]interface{}{
+								"type":        "string",
+								"description": "The ID of the activity",
+							},
+							"format": map[string]interface{}{
+								"type":        "string",
+								"enum":        []string{"gpx", "tcx"},
+								"description": "File format. Defaults to gpx",
+							},
+							"file_name": map[string]interface{}{
+								"type":        "string",
+								"description": "Optional file name to save the export under in the exports folder of the data folder, without a directory. The file content is returned when omitted",
+							},
+						},
+						"required": []string{"activity_id"},
+					},
+				},
+				{
+					"name":        "reconcile_activities",
+					"description": "Compare cached activities in a date range with Strava: update edited names, types, gear and visibility, and remove activities that were deleted or made private",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"after": map[string]interface{}{
+								"type":        "string",
+								"description": "Start of the range (ISO 8601 format). Defaults to 30 days ago",
+							},
+							"before": map[string]interface{}{
+								"type":        "string",
+								"description": "End of the range (ISO 8601 format). Defaults to now",
+							},
+							"mode": map[string]interface{}{
+								"type":        "string",
+								"enum":        []string{"tombstone", "purge"},
+								"description": "tombstone (default) keeps a record of removed activities, purge deletes them completely",
+							},
+						},
+					},
+				},
+				{
+					"name":        "start_backfill",
+					"description": "Start downloading the full activity history in the background. The job pauses on Strava's rate limit and resumes by itself",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"since": map[string]interface{}{
+								"type":        "string",
+								"description": "Only backfill activities after this date (ISO 8601 format). Defaults to the whole history",
+							},
+						},
+					},
+				},
+				{
+					"name":        "get_sync_status",
+					"description": "Show the sync high-water mark, backfill progress and the remaining Strava rate-limit budget",
+					"inputSchema": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{},
+					},
+				},
+				{
+					"name":        "get_training_load",
+					"description": "Get training stress (TSS from power, or hrTSS from heart rate) per activity and the daily fitness (CTL), fatigue (ATL) and form (TSB) series with the current form",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"after": map[string]interface{}{
+								"type":        "string",
+								"description": "Start of the reported range (ISO 8601 format). Defaults to 90 days before 'before'",
+							},
+							"before": map[string]interface{}{
+								"type":        "string",
+								"description": "End of the reported range (ISO 8601 format). Defaults to now",
+							},
+						},
+					},
+				},
+				{
+					"name":        "get_power_analysis",
+					"description": "Power analysis computed on the server: normalized power, intensity factor, variability index, work (kJ), TSS and the mean-maximal power curve (1s to 60min) of one activity, or the best power curve across all cached activities in a date range",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"activity_id": map[string]interface{}{
+								"type":        "string",
+								"description": "Analyse a single activity. Without it the best power curve across activities is returned",
+							},
+							"after": map[string]interface{}{
+								"type":        "string",
+								"description": "Only include activities after this date in the best power curve (ISO 8601 format). Defaults to all time",
+							},
+							"before": map[string]interface{}{
+								"type":        "string",
+								"description": "Only include activities before this date in the best power curve (ISO 8601 format)",
+							},
+						},
+					},
+				},
+				{
+					"name":        "get_zone_distribution",
+					"description": "Time in heart rate zones of one activity, or per week or month across cached activities, with a low/moderate/high intensity split classifying training as polarized, pyramidal or threshold. Zones come from Strava, ATHLETE_LTHR or ATHLETE_MAX_HR, or are estimated from the highest cached heart rate",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"activity_id": map[string]interface{}{
+								"type":        "string",
+								"description": "Zones of a single activity. Without it the distribution across activities is returned",
+							},
+							"after": map[string]interface{}{
+								"type":        "string",
+								"description": "Only include activities after this date (ISO 8601 format). Defaults to 12 weeks before 'before'",
+							},
+							"before": map[string]interface{}{
+								"type":        "string",
+								"description": "Only include activities before this date (ISO 8601 format). Defaults to now",
+							},
+							"group_by": map[string]interface{}{
+								"type":        "string",
+								"enum":        []string{"week", "month", "year"},
+								"description": "Aggregate by ISO week (default), calendar month or year",
+							},
+							"sport": map[string]interface{}{
+								"type":        "string",
+								"description": "Only include a sport or sport group, e.g. 'running' or 'Ride'",
+							},
+						},
+					},
+				},
+				{
+					"name":        "get_aerobic_decoupling",
+					"description": "Aerobic decoupling (cardiac drift) of a steady endurance activity: the efficiency factor of the first and second half of the moving time compared as Pw:HR, or Pace:HR for runs and activities without power, with the efficiency factor trend across similar activities. Below 5% indicates a solid aerobic base",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"activity_id": map[string]interface{}{
+								"type":        "string",
+								"description": "The ID of the activity",
+							},
+						},
+						"required": []string{"activity_id"},
+					},
+				},
+				{
+					"name":        "detect_intervals",
+					"description": "Segment an activity into warm-up, work, rest and cool-down blocks from its power stream, or pace for runs and activities without power, with duration, distance, average/max power, heart rate and cadence per block. Manual laps refine the block boundaries. Use it to check compliance with a structured workout",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"activity_id": map[string]interface{}{
+								"type":        "string",
+								"description": "The ID of the activity",
+							},
+						},
+						"required": []string{"activity_id"},
+					},
+				},
+				{
+					"name":        "get_splits",
+					"description": "Kilometer or mile splits of an activity with moving time, pace, grade-adjusted pace, average heart rate and elevation change per split, the fastest and slowest split, and whether the second half was faster (negative split), slower (positive) or even",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"activity_id": map[string]interface{}{
+								"type":        "string",
+								"description": "The ID of the activity",
+							},
+							"unit": map[string]interface{}{
+								"type":        "string",
+								"enum":        []string{"km", "mi"},
+								"description": "Split distance, kilometers (default) or miles",
+							},
+						},
+						"required": []string{"activity_id"},
+					},
+				},
+				{
+					"name":        "get_climbs",
+					"description": "Climbs of an activity detected from its altitude and distance streams, with start and end, length, elevation gain, average and max gradient, time, VAM and a Strava-like category (4 to HC), plus the elevation gain of the smoothed profile to compare with Strava's total",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"activity_id": map[string]interface{}{
+								"type":        "string",
+								"description": "The ID of the activity",
+							},
+						},
+						"required": []string{"activity_id"},
+					},
+				},
+				{
+					"name":        "get_personal_records",
+					"description": "All-time and per-year personal records from the cached streams: fastest 1 km, 5 km, 10 km, half marathon and marathon within runs, best 5 s, 1 min, 5 min and 20 min power and the longest ride, with the activity each was set in",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"year": map[string]interface{}{
+								"type":        "integer",
+								"description": "Only return the bests of this year next to the all-time records",
+							},
+						},
+					},
+				},
+				{
+					"name":        "get_summary",
+					"description": "Totals of cached activities per week, month or year and per sport type by local start date: count, distance, moving time, elevation gain, kilojoules and average heart rate, with the change from the previous period. Use it instead of adding up get_activities",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"group_by": map[string]interface{}{
+								"type":        "string",
+								"enum":        []string{"week", "month", "year"},
+								"description": "Aggregate by ISO week (default), calendar month or year",
+							},
+							"after": map[string]interface{}{
+								"type":        "string",
+								"description": "Start with the period containing this date (ISO 8601 format). Defaults to 12 weeks, 12 months or 5 years before 'before'",
+							},
+							"before": map[string]interface{}{
+								"type":        "string",
+								"description": "End with the period containing this date (ISO 8601 format). Defaults to now",
+							},
+							"sport": map[string]interface{}{
+								"type":        "string",
+								"description": "Only include a sport or sport group, e.g. 'running' or 'Ride'",
 							},
 						},
 					},
 				},
+				{
+					"name":        "find_similar_activities",
+					"description": "Other efforts of the same sport type on the route of an activity, matched by comparing summary polylines, with moving time, speed, power and heart rate of each and the time difference, to compare efforts on a regular route",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"activity_id": map[string]interface{}{
+								"type":        "string",
+								"description": "The ID of the activity",
+							},
+							"limit": map[string]interface{}{
+								"type":        "integer",
+								"description": "Maximum number of efforts to return, newest first. Defaults to 20",
+							},
+						},
+						"required": []string{"activity_id"},
+					},
+				},
+				{
+					"name":        "search_activities_by_location",
+					"description": "Find cached activities by where they went: routes passing within a radius of a point, or through or completely inside a bounding box. Routes come from the summary polyline, or the start and end position for activities without a map",
+					"inputSchema": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"lat": map[string]interface{}{
+								"type":        "number",
+								"description": "Latitude of the point in degrees",
+							},
+							"lng": map[string]interface{}{
+								"type":        "number",
+								"description": "Longitude of the point in degrees",
+							},
+							"radius": map[string]interface{}{
+								"type":        "number",
+								"description": "Distance from the point in meters, at most 50000. Defaults to 500",
+							},
+							"bbox": map[string]interface{}{
+								"type":        "string",
+								"description": "Bounding box as 'south,west,north,east' in degrees, instead of a point",
+							},
+							"within": map[string]interface{}{
+								"type":        "boolean",
+								"description": "Only return activities completely inside the bounding box instead of those passing through it",
+							},
+							"sport": map[string]interface{}{
+								"type":        "string",
+								"description": "Only include a sport or sport group, e.g. 'running' or 'Ride'",
+							},
+							"after": map[string]interface{}{
+								"type":        "string",
+								"description": "Only include activities after this date (ISO 8601 format)",
+							},
+							"before": map[string]interface{}{
+								"type":        "string",
+								"description": "Only include activities before this date (ISO 8601 format)",
+							},
+							"limit": map[string]interface{}{
+								"type":        "integer",
+								"description": "Maximum number of activities to return. Defaults to 20",
+							},
+						},
+					},
+				},
+				{
+					"name":        "get_goal_progress",
+					"description": "Progress towards the goals configured in the data folder (e.g. 5000 km cycling in 2026, 3 runs per week): period-to-date total, percentage, the same date last year and the projected total at the end of the period",
+					"inputSchema": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{},
+					},
+				},
 			},
 		},
 	}
 }
 
-func (s *MCPServer) handleToolCall(req MCPRequest) MCPResponse {
+// handleToolCall dispatches a tools/call request. A panic in a tool is answered as an internal
+// error instead of taking the stdio server down.
+func (s *MCPServer) handleToolCall(req MCPRequest) (response MCPResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Tool call panicked", "request_id", req.ID, "panic", r, "stack", string(debug.Stack()))
+			response = MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32603,
+					Message: fmt.Sprintf("Internal error: %v", r),
+				},
+			}
+		}
+	}()
+
 	params, ok := req.Params.(map[string]interface{})
 	if !ok {
 		return MCPResponse{
@@ -188,6 +544,57 @@ func (s *MCPServer) handleToolCall(req MCPRequest) MCPResponse {
 	case "refresh_activities":
 		return s.refreshActivities(req, arguments)
 
+	case "analyze_fit_file":
+		return s.analyzeFitFile(req, arguments)
+
+	case "export_activity":
+		return s.exportActivity(req, arguments, c)
+
+	case "reconcile_activities":
+		return s.reconcileActivities(req, arguments)
+
+	case "start_backfill":
+		return s.startBackfill(req, arguments)
+
+	case "get_sync_status":
+		return s.getSyncStatus(req)
+
+	case "get_training_load":
+		return s.getTrainingLoad(req, arguments, c)
+
+	case "get_power_analysis":
+		return s.getPowerAnalysis(req, arguments, c)
+
+	case "get_zone_distribution":
+		return s.getZoneDistribution(req, arguments, c)
+
+	case "get_aerobic_decoupling":
+		return s.getAerobicDecoupling(req, arguments, c)
+
+	case "detect_intervals":
+		return s.detectIntervals(req, arguments, c)
+
+	case "get_splits":
+		return s.getSplits(req, arguments, c)
+
+	case "get_climbs":
+		return s.getClimbs(req, arguments, c)
+
+	case "get_personal_records":
+		return s.getPersonalRecords(req, arguments, c)
+
+	case "get_summary":
+		return s.getSummary(req, arguments, c)
+
+	case "get_goal_progress":
+		return s.getGoalProgress(req, arguments, c)
+
+	case "find_similar_activities":
+		return s.findSimilarActivities(req, arguments, c)
+
+	case "search_activities_by_location":
+		return s.searchActivitiesByLocation(req, arguments, c)
+
 	default:
 		return MCPResponse{
 			JSONRPC: "2.0",
@@ -223,35 +630,74 @@ func (s *MCPServer) getActivities(req MCPRequest, arguments map[string]interface
 		}
 	}
 
-	// Parse after date
-	if a, ok := arguments["after"].(string); ok && a != "" {
-		if parsed, err := time.Parse(time.RFC3339, a); err == nil {
-			after = &parsed
-		} else {
+	// Parse after date
+	if a, ok := arguments["after"].(string); ok && a != "" {
+		if parsed, err := time.Parse(time.RFC3339, a); err == nil {
+			after = &parsed
+		} else {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32602,
+					Message: "Invalid 'after' date format. Use ISO 8601 format (e.g., 2024-01-15T00:00:00Z)",
+				},
+			}
+		}
+	}
+
+	// Validate date range
+	if before != nil && after != nil && before.Before(*after) {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: "'before' date must be after 'after' date",
+			},
+		}
+	}
+
+	queryText, _ := arguments["query"].(string)
+	q, err := query.Parse(queryText)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	var maxStaleness time.Duration
+	if m, ok := arguments["max_staleness"].(string); ok && m != "" {
+		parsed, err := time.ParseDuration(m)
+		if err != nil {
 			return MCPResponse{
 				JSONRPC: "2.0",
 				ID:      req.ID,
 				Error: &MCPError{
 					Code:    -32602,
-					Message: "Invalid 'after' date format. Use ISO 8601 format (e.g., 2024-01-15T00:00:00Z)",
+					Message: "Invalid 'max_staleness'. Use a duration such as '30m' or '6h'",
 				},
 			}
 		}
+		maxStaleness = parsed
 	}
 
-	// Validate date range
-	if before != nil && after != nil && before.Before(*after) {
+	list, err := s.activityService.GetAllActivities(c, filter, q, before, after, maxStaleness)
+	if errors.Is(err, sport.ErrUnknown) {
 		return MCPResponse{
 			JSONRPC: "2.0",
 			ID:      req.ID,
 			Error: &MCPError{
 				Code:    -32602,
-				Message: "'before' date must be after 'after' date",
+				Message: err.Error(),
 			},
 		}
 	}
-
-	activities, err := s.activityService.GetAllActivities(c, filter, before, after)
 	if err != nil {
 		return MCPResponse{
 			JSONRPC: "2.0",
@@ -263,6 +709,19 @@ func (s *MCPServer) getActivities(req MCPRequest, arguments map[string]interface
 		}
 	}
 
+	activities := list.Activities
+	climbProfiles, err := s.activityService.GetCachedClimbs(c, activities)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to get climbs: %v", err),
+			},
+		}
+	}
+
 	// Create descriptive summary
 	summary := fmt.Sprintf("Retrieved %d activities", len(activities))
 
@@ -276,10 +735,14 @@ func (s *MCPServer) getActivities(req MCPRequest, arguments map[string]interface
 	if before != nil {
 		filters = append(filters, fmt.Sprintf("before: %s", before.Format("2006-01-02")))
 	}
+	if q != nil {
+		filters = append(filters, fmt.Sprintf("query: %s", q))
+	}
 
 	if len(filters) > 0 {
 		summary += fmt.Sprintf(" (filtered by %s)", strings.Join(filters, ", "))
 	}
+	summary += "\n" + describeFreshness(list.Freshness)
 
 	// Format activities for display
 	var contentItems []map[string]interface{}
@@ -297,8 +760,8 @@ func (s *MCPServer) getActivities(req MCPRequest, arguments map[string]interface
 		// Format the activity details in a readable way
 		activityText.WriteString(fmt.Sprintf("🏃 %s (ID: %d)\n", activity.Name, activity.ID))
 
-		if activity.Type != "" {
-			activityText.WriteString(fmt.Sprintf("   Type: %s\n", activity.Type))
+		if sportType := sport.Of(&activity); sportType != "" {
+			activityText.WriteString(fmt.Sprintf("   Type: %s\n", sportType))
 		}
 
 		if activity.Distance > 0 {
@@ -340,6 +803,14 @@ func (s *MCPServer) getActivities(req MCPRequest, arguments map[string]interface
 			activityText.WriteString(fmt.Sprintf("   Elevation Gain: %.0f m\n", activity.TotalElevationGain))
 		}
 
+		if profile, ok := climbProfiles[activity.ID]; ok && len(profile.Climbs) > 0 {
+			climbs := make([]string, len(profile.Climbs))
+			for i, climb := range profile.Climbs {
+				climbs[i] = describeClimb(climb)
+			}
+			activityText.WriteString(fmt.Sprintf("   Climbs: %s\n", strings.Join(climbs, "; ")))
+		}
+
 		if activity.StartDate != "" {
 			activityText.WriteString(fmt.Sprintf("   Date: %s\n", activity.StartDate))
 		}
@@ -358,8 +829,10 @@ func (s *MCPServer) getActivities(req MCPRequest, arguments map[string]interface
 		JSONRPC: "2.0",
 		ID:      req.ID,
 		Result: map[string]interface{}{
-			"content": contentItems,
-			"data":    activities, // Keep the raw data for programmatic access if needed
+			"content":   contentItems,
+			"data":      activities, // Keep the raw data for programmatic access if needed
+			"freshness": list.Freshness,
+			"climbs":    climbProfiles,
 		},
 	}
 }
@@ -402,15 +875,23 @@ func (s *MCPServer) getActivityStream(req MCPRequest, arguments map[string]inter
 	// Add details about available data types
 	if streamCount > 0 {
 		var dataTypes []string
-		firstPoint := activityStream.Streams[0]
-		if firstPoint.Time != nil {
-			dataTypes = append(dataTypes, "time")
-		}
-		if firstPoint.Watts != nil {
-			dataTypes = append(dataTypes, "power")
-		}
-		if firstPoint.Heartrate != nil {
-			dataTypes = append(dataTypes, "heart rate")
+		for _, dataType := range []struct {
+			name      string
+			available func(point service.StreamDataPoint) bool
+		}{
+			{"time", func(p service.StreamDataPoint) bool { return p.Time != nil }},
+			{"distance", func(p service.StreamDataPoint) bool { return p.Distance != nil }},
+			{"speed", func(p service.StreamDataPoint) bool { return p.VelocitySmooth != nil }},
+			{"altitude", func(p service.StreamDataPoint) bool { return p.Altitude != nil }},
+			{"grade", func(p service.StreamDataPoint) bool { return p.GradeSmooth != nil }},
+			{"power", func(p service.StreamDataPoint) bool { return p.Watts != nil }},
+			{"heart rate", func(p service.StreamDataPoint) bool { return p.Heartrate != nil }},
+			{"cadence", func(p service.StreamDataPoint) bool { return p.Cadence != nil }},
+			{"temperature", func(p service.StreamDataPoint) bool { return p.Temp != nil }},
+		} {
+			if slices.ContainsFunc(activityStream.Streams, dataType.available) {
+				dataTypes = append(dataTypes, dataType.name)
+			}
 		}
 
 		if len(dataTypes) > 0 {
@@ -434,11 +915,11 @@ func (s *MCPServer) getActivityStream(req MCPRequest, arguments map[string]inter
 }
 
 func (s *MCPServer) refreshActivities(req MCPRequest, arguments map[string]interface{}) MCPResponse {
-	afterDate := time.Now().Add(time.Hour * 24 * -30)
+	var afterDate *time.Time
 
 	if a, ok := arguments["after"].(string); ok && a != "" {
 		if parsed, err := time.Parse(time.RFC3339, a); err == nil {
-			afterDate = parsed
+			afterDate = &parsed
 		} else {
 			return MCPResponse{
 				JSONRPC: "2.0",
@@ -451,7 +932,13 @@ func (s *MCPServer) refreshActivities(req MCPRequest, arguments map[string]inter
 		}
 	}
 
-	err := s.activityService.ProcessActivities(afterDate)
+	var result *service.SyncResult
+	var err error
+	if afterDate != nil {
+		result, err = s.activityService.ProcessActivities(*afterDate)
+	} else {
+		result, err = s.activityService.SyncActivities()
+	}
 	if err != nil {
 		return MCPResponse{
 			JSONRPC: "2.0",
@@ -464,7 +951,386 @@ func (s *MCPServer) refreshActivities(req MCPRequest, arguments map[string]inter
 	}
 
 	// Create a more descriptive response
-	responseText := fmt.Sprintf("Activities refreshed successfully from Strava API (after: %s)", afterDate.Format("2006-01-02"))
+	var text strings.Builder
+	if afterDate != nil {
+		text.WriteString(fmt.Sprintf("Activities refreshed from Strava API (after: %s)\n", afterDate.Format("2006-01-02")))
+	} else {
+		text.WriteString("Activities refreshed from Strava API (new since last sync)\n")
+	}
+	text.WriteString(fmt.Sprintf("   Listed: %d, new or updated: %d\n", result.Listed, result.Updated))
+	text.WriteString(fmt.Sprintf("   Streams fetched: %d, already cached: %d, failed: %d\n", result.Synced, result.Skipped, len(result.Failed)))
+	if result.Refetched > 0 {
+		text.WriteString(fmt.Sprintf("   Legacy streams re-fetched: %d\n", result.Refetched))
+	}
+	for _, change := range result.Changed {
+		text.WriteString(fmt.Sprintf("   %s (ID: %d) changed: %s\n", change.Name, change.ActivityID, strings.Join(change.Fields, ", ")))
+	}
+	if result.Reconciled {
+		text.WriteString(fmt.Sprintf("   Reconciled recent activities, removed %d no longer listed on Strava\n", result.Deleted))
+	}
+	if result.RateLimited {
+		text.WriteString("   Rate limit budget reached, remaining streams will be fetched by the next sync\n")
+	}
+	for _, failure := range result.Failed {
+		text.WriteString(fmt.Sprintf("   %d (%s): %s\n", failure.ActivityID, failure.StartDate, failure.Error))
+	}
+	for _, record := range result.NewRecords {
+		text.WriteString(fmt.Sprintf("   New %s: %s\n", describeNewRecord(record), describeRecord(record.Record)))
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": result,
+		},
+	}
+}
+
+func (s *MCPServer) analyzeFitFile(req MCPRequest, arguments map[string]interface{}) MCPResponse {
+	path, ok := arguments["path"].(string)
+	if !ok || path == "" {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: "Missing or invalid path parameter",
+			},
+		}
+	}
+
+	analysis, err := s.archiveService.AnalyzeFitFile(path)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to analyze FIT file: %v", err),
+			},
+		}
+	}
+
+	activity := analysis.Activity
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("FIT file %s\n", analysis.FileName))
+	text.WriteString(fmt.Sprintf("   Type: %s\n", activity.SportType))
+	text.WriteString(fmt.Sprintf("   Date: %s\n", activity.StartDate))
+	if activity.Distance > 0 {
+		text.WriteString(fmt.Sprintf("   Distance: %.2f km\n", activity.Distance/1000))
+	}
+	if activity.MovingTime > 0 {
+		text.WriteString(fmt.Sprintf("   Duration: %s (elapsed %s)\n", formatDuration(activity.MovingTime), formatDuration(activity.ElapsedTime)))
+	}
+	if activity.AverageSpeed > 0 {
+		text.WriteString(fmt.Sprintf("   Avg Speed: %.2f km/h\n", activity.AverageSpeed*3.6))
+	}
+	if activity.AverageHeartrate != nil {
+		text.WriteString(fmt.Sprintf("   Avg heart rate: %.0f bpm\n", *activity.AverageHeartrate))
+	}
+	if activity.MaxHeartrate != nil {
+		text.WriteString(fmt.Sprintf("   Max heart rate: %.0f bpm\n", *activity.MaxHeartrate))
+	}
+	if activity.AverageWatts != nil {
+		text.WriteString(fmt.Sprintf("   Average Watts (Power): %.0f\n", *activity.AverageWatts))
+	}
+	if activity.WeightedAverageWatts != nil {
+		text.WriteString(fmt.Sprintf("   Normalized Power: %d\n", *activity.WeightedAverageWatts))
+	}
+	if activity.AverageCadence != nil {
+		text.WriteString(fmt.Sprintf("   Avg Cadence: %.0f\n", *activity.AverageCadence))
+	}
+	if activity.TotalElevationGain > 0 {
+		text.WriteString(fmt.Sprintf("   Elevation Gain: %.0f m\n", activity.TotalElevationGain))
+	}
+	if activity.Kilojoules != nil {
+		text.WriteString(fmt.Sprintf("   Work: %.0f kJ\n", *activity.Kilojoules))
+	}
+	text.WriteString(fmt.Sprintf("   Available data: %s\n", strings.Join(analysis.AvailableStreams, ", ")))
+
+	for i, lap := range analysis.Laps {
+		text.WriteString(fmt.Sprintf("   Lap %d: %s, %.2f km", i+1, formatDuration(int(lap.TotalTimerTime)), lap.TotalDistance/1000))
+		if lap.AvgPower != nil {
+			text.WriteString(fmt.Sprintf(", %.0f W", *lap.AvgPower))
+		}
+		if lap.AvgHeartrate != nil {
+			text.WriteString(fmt.Sprintf(", %.0f bpm", *lap.AvgHeartrate))
+		}
+		text.WriteString("\n")
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": analysis,
+		},
+	}
+}
+
+func (s *MCPServer) exportActivity(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	activityID, ok := arguments["activity_id"].(string)
+	if !ok || activityID == "" {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: "Missing or invalid activity_id parameter",
+			},
+		}
+	}
+	formatArg, _ := arguments["format"].(string)
+	format, err := trackfile.ParseFormat(formatArg)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	export, err := s.activityService.ExportActivity(c, activityID, format)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to export activity: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Exported activity %s as %s (%d bytes)\n", activityID, strings.ToUpper(string(format)), len(export.Data)))
+	if export.Approximate {
+		text.WriteString("Note: the activity has no GPS stream, positions are approximated from the summary map polyline.\n")
+	}
+	content := []map[string]interface{}{}
+	if fileName, _ := arguments["file_name"].(string); fileName != "" {
+		path, err := s.activityService.SaveExport(c, export, fileName)
+		if errors.Is(err, service.ErrInvalidFileName) {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32602,
+					Message: err.Error(),
+				},
+			}
+		}
+		if err != nil {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32603,
+					Message: fmt.Sprintf("Failed to write export: %v", err),
+				},
+			}
+		}
+		text.WriteString(fmt.Sprintf("Written to %s\n", path))
+		content = append(content, map[string]interface{}{"type": "text", "text": text.String()})
+	} else {
+		content = append(content,
+			map[string]interface{}{"type": "text", "text": text.String()},
+			map[string]interface{}{
+				"type": "resource",
+				"resource": map[string]interface{}{
+					"uri":      "file:///" + export.FileName,
+					"mimeType": export.ContentType,
+					"text":     string(export.Data),
+				},
+			},
+		)
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": content,
+		},
+	}
+}
+
+func (s *MCPServer) reconcileActivities(req MCPRequest, arguments map[string]interface{}) MCPResponse {
+	before := time.Now()
+	after := before.Add(-30 * 24 * time.Hour)
+	for name, target := range map[string]*time.Time{"after": &after, "before": &before} {
+		if value, ok := arguments[name].(string); ok && value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return MCPResponse{
+					JSONRPC: "2.0",
+					ID:      req.ID,
+					Error: &MCPError{
+						Code:    -32602,
+						Message: fmt.Sprintf("Invalid '%s' date format. Use ISO 8601 format (e.g., 2024-01-15T00:00:00Z)", name),
+					},
+				}
+			}
+			*target = parsed
+		}
+	}
+	modeArg, _ := arguments["mode"].(string)
+	mode, err := service.ParseReconcileMode(modeArg)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	result, err := s.activityService.ReconcileActivities(after, before, mode)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to reconcile activities: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Reconciled %s to %s: %d on Strava, %d cached\n", after.Format("2006-01-02"), before.Format("2006-01-02"), result.Remote, result.Local))
+	text.WriteString(fmt.Sprintf("   New or updated summaries: %d\n", result.Updated))
+	for _, change := range result.Changed {
+		text.WriteString(fmt.Sprintf("   %s (ID: %d) changed: %s\n", change.Name, change.ActivityID, strings.Join(change.Fields, ", ")))
+	}
+	if len(result.Tombstoned) > 0 {
+		text.WriteString(fmt.Sprintf("   Tombstoned (missing on Strava): %v\n", result.Tombstoned))
+	}
+	if len(result.Purged) > 0 {
+		text.WriteString(fmt.Sprintf("   Purged (missing on Strava): %v\n", result.Purged))
+	}
+	if len(result.Restored) > 0 {
+		text.WriteString(fmt.Sprintf("   Visible on Strava again: %v\n", result.Restored))
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": result,
+		},
+	}
+}
+
+func (s *MCPServer) startBackfill(req MCPRequest, arguments map[string]interface{}) MCPResponse {
+	since := time.Unix(0, 0)
+	if value, ok := arguments["since"].(string); ok && value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32602,
+					Message: "Invalid 'since' date format. Use ISO 8601 format (e.g., 2020-01-01T00:00:00Z)",
+				},
+			}
+		}
+		since = parsed
+	}
+
+	state, err := s.backfillService.Start(since)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to start backfill: %v", err),
+			},
+		}
+	}
+
+	text := fmt.Sprintf("Backfill started for activities since %s, continuing before %s. Use get_sync_status to follow progress.", state.Since[:10], state.Before)
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text,
+				},
+			},
+			"data": state,
+		},
+	}
+}
+
+func (s *MCPServer) getSyncStatus(req MCPRequest) MCPResponse {
+	status, err := s.backfillService.Status()
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to get sync status: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString("Sync status\n")
+	if sync := status.Sync; sync != nil {
+		text.WriteString(fmt.Sprintf("   Newest synced activity: %s\n", sync.LastActivityStart))
+		text.WriteString(fmt.Sprintf("   Last sync: %s\n", sync.LastSyncAt))
+		if sync.LastFullScanAt != "" {
+			text.WriteString(fmt.Sprintf("   Last reconciliation: %s\n", sync.LastFullScanAt))
+		}
+	} else {
+		text.WriteString("   Never synced\n")
+	}
+	if backfill := status.Backfill; backfill != nil {
+		text.WriteString(fmt.Sprintf("Backfill since %s: %s\n", backfill.Since, backfill.Status))
+		text.WriteString(fmt.Sprintf("   Cursor: activities before %s still to do\n", backfill.Before))
+		text.WriteString(fmt.Sprintf("   Activities: %d listed, %d streams fetched, %d already cached, %d failed\n",
+			backfill.Listed, backfill.Fetched, backfill.Skipped, backfill.Failed))
+		if backfill.ResumeAt != "" {
+			text.WriteString(fmt.Sprintf("   Paused on rate limit, resumes at %s\n", backfill.ResumeAt))
+		}
+		if backfill.LastError != "" {
+			text.WriteString(fmt.Sprintf("   Last error: %s\n", backfill.LastError))
+		}
+	}
+	if limit := status.RateLimit; limit != nil {
+		text.WriteString(fmt.Sprintf("Rate limit: %d/%d in 15 minutes, %d/%d today\n",
+			limit.ShortUsage, limit.ShortLimit, limit.DailyUsage, limit.DailyLimit))
+	}
 
 	return MCPResponse{
 		JSONRPC: "2.0",
@@ -473,9 +1339,33 @@ func (s *MCPServer) refreshActivities(req MCPRequest, arguments map[string]inter
 			"content": []map[string]interface{}{
 				{
 					"type": "text",
-					"text": responseText,
+					"text": text.String(),
 				},
 			},
+			"data": status,
 		},
 	}
 }
+
+func describeFreshness(freshness service.Freshness) string {
+	var text string
+	if freshness.LastSyncAt == "" {
+		text = "Local cache has never been synced with Strava; use refresh_activities or start_backfill to fill it."
+	} else {
+		text = fmt.Sprintf("Local cache last synced %s ago (%s).", formatDuration(int(*freshness.AgeSeconds)), freshness.LastSyncAt)
+	}
+	if freshness.Refreshing {
+		text += " A refresh is running in the background; ask again shortly for newer activities."
+	}
+	return text
+}
+
+func formatDuration(seconds int) string {
+	hours := seconds / 3600
+	minutes := (seconds % 3600) / 60
+	secs := seconds % 60
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm %ds", hours, minutes, secs)
+	}
+	return fmt.Sprintf("%dm %ds", minutes, secs)
+}
@@ -0,0 +1,1084 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"maps"
+	"math"
+	"slices"
+	"stravamcp/pkg/analytics"
+	"stravamcp/pkg/geo"
+	"stravamcp/pkg/sport"
+	"stravamcp/service"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateRangeArguments reads the optional 'after' and 'before' ISO 8601 arguments of the analytics tools.
+func dateRangeArguments(arguments map[string]interface{}) (*time.Time, *time.Time, error) {
+	var after, before *time.Time
+	for name, target := range map[string]**time.Time{"after": &after, "before": &before} {
+		value, ok := arguments[name].(string)
+		if !ok || value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid '%s' date format. Use ISO 8601 format (e.g., 2024-01-15T00:00:00Z)", name)
+		}
+		*target = &parsed
+	}
+	if after != nil && before != nil && before.Before(*after) {
+		return nil, nil, fmt.Errorf("'before' date must be after 'after' date")
+	}
+	return after, before, nil
+}
+
+func (s *MCPServer) getTrainingLoad(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	after, before, err := dateRangeArguments(arguments)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	load, err := s.analyticsService.GetTrainingLoad(c, after, before)
+	if errors.Is(err, service.ErrInvalidRange) {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to compute training load: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Training load from %s to %s\n", load.From, load.To))
+	if current := load.Current; current != nil {
+		text.WriteString(fmt.Sprintf("   Fitness (CTL): %.1f, fatigue (ATL): %.1f, form (TSB): %.1f\n", current.CTL, current.ATL, current.TSB))
+		text.WriteString(fmt.Sprintf("   Form: %s\n", current.Form))
+		text.WriteString(fmt.Sprintf("   CTL ramp over the last 7 days: %+.1f\n", current.RampRate))
+	}
+	thresholds := load.Thresholds
+	text.WriteString(fmt.Sprintf("   Thresholds: FTP %s, max HR %s, resting HR %s, LTHR %s\n",
+		describeThreshold(thresholds.FTP, "W", thresholds.Sources["ftp"]),
+		describeThreshold(thresholds.MaxHR, "bpm", thresholds.Sources["max_hr"]),
+		describeThreshold(thresholds.RestingHR, "bpm", thresholds.Sources["resting_hr"]),
+		describeThreshold(thresholds.LTHR, "bpm", thresholds.Sources["lthr"])))
+
+	methods := map[string]int{}
+	var total float64
+	for _, activity := range load.Activities {
+		methods[activity.Method]++
+		total += activity.TSS
+	}
+	text.WriteString(fmt.Sprintf("   %d activities, %.0f TSS in total (scored by power: %d, power summary: %d, heart rate: %d, heart rate summary: %d, unscored: %d)\n",
+		len(load.Activities), total, methods["power"], methods["power_summary"], methods["heart_rate"], methods["heart_rate_summary"], methods["none"]))
+
+	// The last two weeks are enough for the text; the full series is in the data.
+	days := load.Days
+	if len(days) > 14 {
+		days = days[len(days)-14:]
+	}
+	if len(days) > 0 {
+		text.WriteString("\nDate        TSS    CTL    ATL    TSB\n")
+		for _, day := range days {
+			text.WriteString(fmt.Sprintf("%s %5.0f %6.1f %6.1f %6.1f\n", day.Date, day.TSS, day.CTL, day.ATL, day.TSB))
+		}
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": load,
+		},
+	}
+}
+
+func describeThreshold(value float64, unit, source string) string {
+	if value == 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%.0f %s (%s)", value, unit, source)
+}
+
+func (s *MCPServer) getPowerAnalysis(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	var text strings.Builder
+	var data interface{}
+	if activityID, ok := arguments["activity_id"].(string); ok && activityID != "" {
+		analysis, err := s.analyticsService.GetPowerAnalysis(c, activityID)
+		if err != nil {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32603,
+					Message: fmt.Sprintf("Failed to analyse power: %v", err),
+				},
+			}
+		}
+		text.WriteString(fmt.Sprintf("Power analysis of %s (ID: %d, %s, %s)\n", analysis.Name, analysis.ActivityID, analysis.SportType, analysis.Date))
+		text.WriteString(fmt.Sprintf("   Duration with power: %s\n", formatDuration(analysis.Seconds)))
+		text.WriteString(fmt.Sprintf("   Average: %.0f W, max: %.0f W, normalized: %.0f W\n", analysis.AverageWatts, analysis.MaxWatts, analysis.NP))
+		text.WriteString(fmt.Sprintf("   Variability index: %.2f, work: %.0f kJ\n", analysis.VI, analysis.Kilojoules))
+		if analysis.FTP > 0 {
+			text.WriteString(fmt.Sprintf("   Intensity factor: %.2f, TSS: %.0f (FTP %.0f W)\n", analysis.IF, analysis.TSS, analysis.FTP))
+		} else {
+			text.WriteString("   Set ATHLETE_FTP for intensity factor and TSS\n")
+		}
+		text.WriteString("\nMean-maximal power\n")
+		for _, point := range analysis.Curve {
+			text.WriteString(fmt.Sprintf("   %-6s %4.0f W\n", formatCurveDuration(point.Seconds), point.Watts))
+		}
+		data = analysis
+	} else {
+		after, before, err := dateRangeArguments(arguments)
+		if err != nil {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32602,
+					Message: err.Error(),
+				},
+			}
+		}
+		curve, err := s.analyticsService.GetPowerCurve(c, after, before)
+		if err != nil {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32603,
+					Message: fmt.Sprintf("Failed to compute power curve: %v", err),
+				},
+			}
+		}
+		text.WriteString(fmt.Sprintf("Best power curve across %d activities with power", curve.Activities))
+		if curve.After != "" || curve.Before != "" {
+			text.WriteString(fmt.Sprintf(" (%s to %s)", orDefault(curve.After, "start"), orDefault(curve.Before, "now")))
+		}
+		text.WriteString("\n")
+		for _, point := range curve.Curve {
+			text.WriteString(fmt.Sprintf("   %-6s %4.0f W  %s %s (ID: %d)\n", formatCurveDuration(point.Seconds), point.Watts, point.Date, point.Name, point.ActivityID))
+		}
+		if curve.EstimatedFTP > 0 {
+			text.WriteString(fmt.Sprintf("Estimated FTP (95%% of best 20min): %.0f W\n", curve.EstimatedFTP))
+		}
+		data = curve
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": data,
+		},
+	}
+}
+
+func formatCurveDuration(seconds int) string {
+	switch {
+	case seconds < 60:
+		return fmt.Sprintf("%ds", seconds)
+	case seconds < 3600:
+		return fmt.Sprintf("%dmin", seconds/60)
+	}
+	return fmt.Sprintf("%dh", seconds/3600)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func (s *MCPServer) getZoneDistribution(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	var text strings.Builder
+	var data interface{}
+	if activityID, ok := arguments["activity_id"].(string); ok && activityID != "" {
+		zones, err := s.analyticsService.GetActivityZones(c, activityID)
+		if err != nil {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32603,
+					Message: fmt.Sprintf("Failed to compute heart rate zones: %v", err),
+				},
+			}
+		}
+		text.WriteString(fmt.Sprintf("Heart rate zones of %s (ID: %d, %s, %s), zones from %s\n", zones.Name, zones.ActivityID, zones.SportType, zones.Date, zones.Zones.Source))
+		writeTimeInZones(&text, zones.Zones.Zones, zones.TimeInZones)
+		data = zones
+	} else {
+		after, before, err := dateRangeArguments(arguments)
+		if err != nil {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32602,
+					Message: err.Error(),
+				},
+			}
+		}
+		groupValue, _ := arguments["group_by"].(string)
+		groupBy, err := service.ParseGrouping(groupValue)
+		if err != nil {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32602,
+					Message: err.Error(),
+				},
+			}
+		}
+		filter, _ := arguments["sport"].(string)
+		distribution, err := s.analyticsService.GetZoneDistribution(c, filter, after, before, groupBy)
+		if errors.Is(err, sport.ErrUnknown) {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32602,
+					Message: err.Error(),
+				},
+			}
+		}
+		if err != nil {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32603,
+					Message: fmt.Sprintf("Failed to compute zone distribution: %v", err),
+				},
+			}
+		}
+		text.WriteString(fmt.Sprintf("Heart rate zone distribution from %s to %s", distribution.After, distribution.Before))
+		if distribution.Sport != "" {
+			text.WriteString(fmt.Sprintf(" (%s)", distribution.Sport))
+		}
+		text.WriteString(fmt.Sprintf(", zones from %s\n", distribution.Zones.Source))
+		text.WriteString(fmt.Sprintf("   %d activities with heart rate, %d without\n", distribution.Activities, distribution.WithoutHeartRate))
+		writeTimeInZones(&text, distribution.Zones.Zones, distribution.Total)
+		if len(distribution.Periods) > 0 {
+			text.WriteString(fmt.Sprintf("\n%-9s", "Period"))
+			for _, zone := range distribution.Zones.Zones {
+				text.WriteString(fmt.Sprintf(" %5s", zone.Name))
+			}
+			text.WriteString("  Type\n")
+			for _, period := range distribution.Periods {
+				text.WriteString(fmt.Sprintf("%-9s", period.Period))
+				for _, percent := range period.Percent {
+					text.WriteString(fmt.Sprintf(" %4.0f%%", percent))
+				}
+				text.WriteString(fmt.Sprintf("  %s\n", period.Distribution.Type))
+			}
+		}
+		data = distribution
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": data,
+		},
+	}
+}
+
+func writeTimeInZones(text *strings.Builder, zones []analytics.Zone, spent service.TimeInZones) {
+	for i, zone := range zones {
+		bounds := fmt.Sprintf("%.0f+ bpm", zone.Min)
+		if zone.Max > 0 {
+			bounds = fmt.Sprintf("%.0f-%.0f bpm", zone.Min, zone.Max)
+		}
+		text.WriteString(fmt.Sprintf("   %s %-12s %8s %5.1f%%\n", zone.Name, bounds, formatDuration(int(spent.Seconds[i])), spent.Percent[i]))
+	}
+	d := spent.Distribution
+	if d.Type == "" {
+		return
+	}
+	text.WriteString(fmt.Sprintf("   Low %.0f%%, moderate %.0f%%, high %.0f%%: %s", d.Low*100, d.Moderate*100, d.High*100, d.Type))
+	if d.PolarizationIndex != nil {
+		text.WriteString(fmt.Sprintf(" (polarization index %.2f)", *d.PolarizationIndex))
+	}
+	text.WriteString("\n")
+}
+
+func (s *MCPServer) getAerobicDecoupling(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	activityID, ok := arguments["activity_id"].(string)
+	if !ok || activityID == "" {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: "Missing or invalid activity_id parameter",
+			},
+		}
+	}
+
+	decoupling, err := s.activityService.GetDecoupling(c, activityID)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to compute aerobic decoupling: %v", err),
+			},
+		}
+	}
+
+	method, unit := "Pw:HR", "W"
+	if decoupling.Method == analytics.PaceHR {
+		method, unit = "Pace:HR", "m/min"
+	}
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Aerobic decoupling of %s (ID: %d, %s, %s)\n", decoupling.Name, decoupling.ActivityID, decoupling.SportType, decoupling.Date))
+	text.WriteString(fmt.Sprintf("   %s over %s of moving time", method, formatDuration(decoupling.Seconds)))
+	if decoupling.StoppedSeconds > 0 {
+		text.WriteString(fmt.Sprintf(" (%s stopped left out)", formatDuration(decoupling.StoppedSeconds)))
+	}
+	text.WriteString("\n")
+	for _, half := range []struct {
+		name string
+		analytics.EfficiencyHalf
+	}{{"First half", decoupling.FirstHalf}, {"Second half", decoupling.SecondHalf}} {
+		text.WriteString(fmt.Sprintf("   %-11s %6.1f %s at %3.0f bpm, EF %.3f\n", half.name, half.Output, unit, half.Heartrate, half.EF))
+	}
+	text.WriteString(fmt.Sprintf("   Decoupling: %.1f%% (%s), EF over the whole activity %.3f\n", decoupling.Percent, decoupling.Assessment, decoupling.EF))
+
+	trend := decoupling.Trend
+	if len(trend.Activities) > 1 {
+		text.WriteString(fmt.Sprintf("\nEfficiency factor of %d similar activities\n", len(trend.Activities)))
+		for _, point := range trend.Activities {
+			text.WriteString(fmt.Sprintf("   %s EF %.3f, decoupling %5.1f%%  %s (ID: %d)\n", point.Date, point.EF, point.Decoupling, point.Name, point.ActivityID))
+		}
+		if trend.ChangePerMonth != nil {
+			text.WriteString(fmt.Sprintf("   EF trend: %+.1f%% per month\n", *trend.ChangePerMonth))
+		}
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": decoupling,
+		},
+	}
+}
+
+func (s *MCPServer) detectIntervals(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	activityID, ok := arguments["activity_id"].(string)
+	if !ok || activityID == "" {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: "Missing or invalid activity_id parameter",
+			},
+		}
+	}
+
+	intervals, err := s.activityService.DetectIntervals(c, activityID)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to detect intervals: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Intervals of %s (ID: %d, %s, %s)\n", intervals.Name, intervals.ActivityID, intervals.SportType, intervals.Date))
+	threshold := fmt.Sprintf("%.0f W", intervals.Threshold)
+	if intervals.Signal == analytics.SignalPace {
+		threshold = formatPace(intervals.Threshold)
+	}
+	switch {
+	case intervals.Work == 0:
+		text.WriteString("   No distinct work and rest blocks, the session was steady\n")
+	case intervals.Source == analytics.SourceLaps:
+		text.WriteString(fmt.Sprintf("   %d work blocks split by %s at %s, refined with %d laps\n", intervals.Work, intervals.Signal, threshold, intervals.Laps))
+	default:
+		text.WriteString(fmt.Sprintf("   %d work blocks split by %s at %s\n", intervals.Work, intervals.Signal, threshold))
+	}
+	text.WriteString("\n#   Type      Start    Duration  Distance  Power      Pace      HR        Cadence\n")
+	for i, block := range intervals.Blocks {
+		power := "-"
+		if block.AverageWatts != nil {
+			power = fmt.Sprintf("%.0f/%.0f W", *block.AverageWatts, *block.MaxWatts)
+		}
+		pace := "-"
+		if block.AverageSpeed != nil {
+			pace = formatPace(*block.AverageSpeed)
+		}
+		hr := "-"
+		if block.AverageHeartrate != nil {
+			hr = fmt.Sprintf("%.0f/%.0f", *block.AverageHeartrate, *block.MaxHeartrate)
+		}
+		cadence := "-"
+		if block.AverageCadence != nil {
+			cadence = fmt.Sprintf("%.0f", *block.AverageCadence)
+		}
+		distance := "-"
+		if block.Distance != nil {
+			distance = fmt.Sprintf("%.2f km", *block.Distance/1000)
+		}
+		text.WriteString(fmt.Sprintf("%-3d %-9s %8s %9s %9s  %-10s %-9s %-9s %s\n", i+1, block.Type, formatDuration(block.Start), formatDuration(block.Seconds), distance, power, pace, hr, cadence))
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": intervals,
+		},
+	}
+}
+
+// formatPace formats a speed in meters per second as minutes per kilometer.
+func formatPace(speed float64) string {
+	if speed <= 0 {
+		return "-"
+	}
+	seconds := int(math.Round(1000 / speed))
+	return fmt.Sprintf("%d:%02d/km", seconds/60, seconds%60)
+}
+
+func (s *MCPServer) getSplits(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	activityID, ok := arguments["activity_id"].(string)
+	if !ok || activityID == "" {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: "Missing or invalid activity_id parameter",
+			},
+		}
+	}
+	unitValue, _ := arguments["unit"].(string)
+	unit, err := analytics.ParseSplitUnit(unitValue)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	splits, err := s.activityService.GetSplits(c, activityID, unit)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to compute splits: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Splits of %s (ID: %d, %s, %s)\n", splits.Name, splits.ActivityID, splits.SportType, splits.Date))
+	text.WriteString(fmt.Sprintf("   %.2f %s in %s moving, %s", splits.Distance/unit.Meters(), unit, formatDuration(int(splits.Seconds)), formatSplitPace(splits.Pace, unit)))
+	if splits.GradeAdjustedPace != nil {
+		text.WriteString(fmt.Sprintf(" (grade-adjusted %s)", formatSplitPace(*splits.GradeAdjustedPace, unit)))
+	}
+	text.WriteString("\n")
+	text.WriteString(fmt.Sprintf("   Halves: %s and %s, a %s split (%+.1f%%)\n", formatDuration(int(splits.FirstHalf)), formatDuration(int(splits.SecondHalf)), splits.Type, splits.Difference))
+	if splits.Fastest > 0 {
+		text.WriteString(fmt.Sprintf("   Fastest split %d, slowest split %d\n", splits.Fastest, splits.Slowest))
+	}
+	text.WriteString(fmt.Sprintf("\n%-4s %-9s %-8s %-11s %-11s %-5s %s\n", strings.ToUpper(string(unit)), "Distance", "Time", "Pace", "GAP", "HR", "Elevation"))
+	for _, split := range splits.Splits {
+		gap := "-"
+		if split.GradeAdjustedPace != nil {
+			gap = formatSplitPace(*split.GradeAdjustedPace, unit)
+		}
+		hr := "-"
+		if split.AverageHeartrate != nil {
+			hr = fmt.Sprintf("%.0f", *split.AverageHeartrate)
+		}
+		elevation := "-"
+		if split.ElevationChange != nil {
+			elevation = fmt.Sprintf("%+.0f m (+%.0f m)", *split.ElevationChange, *split.ElevationGain)
+		}
+		text.WriteString(fmt.Sprintf("%-4d %-9s %-8s %-11s %-11s %-5s %s\n", split.Split, fmt.Sprintf("%.2f", split.Distance/unit.Meters()), formatDuration(int(split.Seconds)), formatSplitPace(split.Pace, unit), gap, hr, elevation))
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": splits,
+		},
+	}
+}
+
+// formatSplitPace formats seconds per split unit as minutes, e.g. 4:35/km.
+func formatSplitPace(seconds float64, unit analytics.SplitUnit) string {
+	total := int(math.Round(seconds))
+	return fmt.Sprintf("%d:%02d/%s", total/60, total%60, unit)
+}
+
+func (s *MCPServer) getClimbs(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	activityID, ok := arguments["activity_id"].(string)
+	if !ok || activityID == "" {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: "Missing or invalid activity_id parameter",
+			},
+		}
+	}
+
+	climbs, err := s.activityService.GetClimbs(c, activityID)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to detect climbs: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Climbs of %s (ID: %d, %s, %s)\n", climbs.Name, climbs.ActivityID, climbs.SportType, climbs.Date))
+	text.WriteString(fmt.Sprintf("   Smoothed elevation gain: %.0f m, loss: %.0f m (Strava reports %.0f m gain)\n", climbs.SmoothedGain, climbs.SmoothedLoss, climbs.ReportedGain))
+	if len(climbs.Climbs) == 0 {
+		text.WriteString("   No categorized climbs\n")
+	}
+	for i, climb := range climbs.Climbs {
+		text.WriteString(fmt.Sprintf("\n%d. %s from km %.1f to %.1f\n", i+1, describeClimb(climb), climb.Start/1000, climb.End/1000))
+		text.WriteString(fmt.Sprintf("   %.0f m to %.0f m altitude, max gradient %.1f%%\n", climb.StartAltitude, climb.EndAltitude, climb.MaxGrade))
+		text.WriteString(fmt.Sprintf("   Climbed in %s, VAM %.0f m/h\n", formatDuration(climb.Seconds), climb.VAM))
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": climbs,
+		},
+	}
+}
+
+// describeClimb summarises a climb as e.g. "Cat 3, 4.2 km at 5.1% (214 m)".
+func describeClimb(climb analytics.Climb) string {
+	category := "Cat " + climb.Category
+	if climb.Category == "HC" {
+		category = "HC"
+	}
+	return fmt.Sprintf("%s, %.1f km at %.1f%% (%.0f m)", category, climb.Length/1000, climb.AverageGrade, climb.ElevationGain)
+}
+
+func (s *MCPServer) getPersonalRecords(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	year := 0
+	switch value := arguments["year"].(type) {
+	case float64:
+		year = int(value)
+	case string:
+		if value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return MCPResponse{
+					JSONRPC: "2.0",
+					ID:      req.ID,
+					Error: &MCPError{
+						Code:    -32602,
+						Message: "Invalid 'year' parameter, use e.g. 2024",
+					},
+				}
+			}
+			year = parsed
+		}
+	}
+
+	records, err := s.activityService.GetPersonalRecords(c, year)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to get personal records: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Personal records from %d activities with cached streams\n", records.Activities))
+	text.WriteString("\nAll time:\n")
+	if len(records.AllTime) == 0 {
+		text.WriteString("   No records yet\n")
+	}
+	for _, record := range records.AllTime {
+		text.WriteString(fmt.Sprintf("   %s\n", describeRecord(record)))
+	}
+	years := slices.Sorted(maps.Keys(records.Years))
+	slices.Reverse(years)
+	for _, y := range years {
+		text.WriteString(fmt.Sprintf("\n%s:\n", y))
+		for _, record := range records.Years[y] {
+			text.WriteString(fmt.Sprintf("   %s\n", describeRecord(record)))
+		}
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": records,
+		},
+	}
+}
+
+// describeRecord formats a record as e.g. "5 km: 21m 34s in Parkrun (ID: 123, 2024-05-04)".
+func describeRecord(record service.Record) string {
+	value := formatDuration(int(record.Value))
+	switch record.Unit {
+	case "watts":
+		value = fmt.Sprintf("%.0f W", record.Value)
+	case "meters":
+		value = fmt.Sprintf("%.1f km", record.Value/1000)
+	}
+	return fmt.Sprintf("%s: %s in %s (ID: %d, %s)", record.Name, value, record.ActivityName, record.ActivityID, record.Date)
+}
+
+// describeNewRecord names the kind of a record set in a sync, e.g. "all-time record" or "2024 best".
+func describeNewRecord(record service.NewRecord) string {
+	if record.AllTime {
+		return "all-time record"
+	}
+	return record.Year + " best"
+}
+
+func (s *MCPServer) getSummary(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	after, before, err := dateRangeArguments(arguments)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+	groupValue, _ := arguments["group_by"].(string)
+	groupBy, err := service.ParseGrouping(groupValue)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+	filter, _ := arguments["sport"].(string)
+	summary, err := s.analyticsService.GetSummary(c, filter, after, before, groupBy)
+	if errors.Is(err, sport.ErrUnknown) || errors.Is(err, service.ErrInvalidRange) {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to compute summary: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Summary per %s from %s to %s", summary.GroupBy, summary.After, summary.Before))
+	if summary.Sport != "" {
+		text.WriteString(fmt.Sprintf(" (%s)", summary.Sport))
+	}
+	text.WriteString(fmt.Sprintf("\n   Total: %s\n", describeTotals(summary.Total)))
+	for i := len(summary.Periods) - 1; i >= 0; i-- {
+		period := summary.Periods[i]
+		text.WriteString(fmt.Sprintf("\n%s (%s to %s): %s\n", period.Period, period.Start, period.End, describeTotals(period.SummaryTotals)))
+		text.WriteString(fmt.Sprintf("   vs previous: %s\n", describeChange(period.Change)))
+		for _, sportSummary := range period.Sports {
+			text.WriteString(fmt.Sprintf("   %s: %s (%s)\n", sportSummary.SportType, describeTotals(sportSummary.SummaryTotals), describeChange(sportSummary.Change)))
+		}
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": summary,
+		},
+	}
+}
+
+// describeTotals formats summary totals as e.g. "3 activities, 85.2 km, 3h 12m 5s, 640 m, 1850 kJ, 142 bpm".
+func describeTotals(totals service.SummaryTotals) string {
+	text := fmt.Sprintf("%d activities, %.1f km, %s, %.0f m", totals.Activities, totals.Distance/1000, formatDuration(totals.MovingTime), totals.ElevationGain)
+	if totals.Kilojoules > 0 {
+		text += fmt.Sprintf(", %.0f kJ", totals.Kilojoules)
+	}
+	if totals.AverageHeartrate != nil {
+		text += fmt.Sprintf(", %.0f bpm", *totals.AverageHeartrate)
+	}
+	return text
+}
+
+// describeChange formats the change from the previous period as e.g. "+1 activities, +12.5 km (+17.2%), +45m 0s".
+func describeChange(change service.SummaryChange) string {
+	text := fmt.Sprintf("%+d activities, %+.1f km", change.Activities, change.Distance/1000)
+	if change.DistancePercent != nil {
+		text += fmt.Sprintf(" (%+.1f%%)", *change.DistancePercent)
+	}
+	duration := "+" + formatDuration(change.MovingTime)
+	if change.MovingTime < 0 {
+		duration = "-" + formatDuration(-change.MovingTime)
+	}
+	return text + ", " + duration + fmt.Sprintf(", %+.0f m", change.ElevationGain)
+}
+
+func (s *MCPServer) getGoalProgress(req MCPRequest, _ map[string]interface{}, c *gin.Context) MCPResponse {
+	progress, err := s.analyticsService.GetGoalProgress(c)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to compute goal progress: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("Goal progress as of %s\n", progress.AsOf))
+	if len(progress.Goals) == 0 {
+		text.WriteString("   No goals configured, add them to data/goals.json or with PUT /api/goals\n")
+	}
+	for _, goal := range progress.Goals {
+		text.WriteString(fmt.Sprintf("\n%s (%s to %s, day %d of %d)\n", goal.Description, goal.Start, goal.End, goal.ElapsedDays, goal.TotalDays))
+		text.WriteString(fmt.Sprintf("   %g of %g %s (%.1f%%), %g to go\n", goal.Current, goal.Goal.Target, goal.Unit, goal.Percent, goal.Remaining))
+		text.WriteString(fmt.Sprintf("   Same date last year: %g %s (%+g", goal.LastYear, goal.Unit, goal.Change))
+		if goal.ChangePercent != nil {
+			text.WriteString(fmt.Sprintf(", %+.1f%%", *goal.ChangePercent))
+		}
+		text.WriteString(")\n")
+		if goal.Projected != nil {
+			status := "behind"
+			if *goal.OnTrack {
+				status = "on track"
+			}
+			text.WriteString(fmt.Sprintf("   Projected: %g %s, %s\n", *goal.Projected, goal.Unit, status))
+		}
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": progress,
+		},
+	}
+}
+
+func (s *MCPServer) findSimilarActivities(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	activityID, ok := arguments["activity_id"].(string)
+	if !ok || activityID == "" {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: "Missing or invalid activity_id parameter",
+			},
+		}
+	}
+	limit := 20
+	if value, ok := arguments["limit"].(float64); ok && value > 0 {
+		limit = int(value)
+	}
+
+	similar, err := s.analyticsService.FindSimilarActivities(c, activityID, limit)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to find similar activities: %v", err),
+			},
+		}
+	}
+
+	running, _ := sport.Resolve("running")
+	isRun := running[similar.SportType]
+	var text strings.Builder
+	activity := similar.Activity
+	text.WriteString(fmt.Sprintf("Efforts on the route of %s (ID: %d, %s, %s)\n", activity.Name, activity.ActivityID, similar.SportType, activity.Date))
+	text.WriteString(fmt.Sprintf("   %s\n", describeRouteEffort(activity, isRun)))
+	if similar.Total == 1 {
+		text.WriteString("   No other efforts on this route\n")
+	} else {
+		text.WriteString(fmt.Sprintf("   Ranked %d of %d by moving time\n", similar.Rank, similar.Total))
+	}
+	for _, effort := range similar.Efforts {
+		difference := "+" + formatDuration(effort.TimeDifference)
+		if effort.TimeDifference < 0 {
+			difference = "-" + formatDuration(-effort.TimeDifference)
+		}
+		text.WriteString(fmt.Sprintf("\n%s (ID: %d, %s), %s, route within %.0f m\n", effort.Name, effort.ActivityID, effort.Date, difference, effort.Deviation))
+		text.WriteString(fmt.Sprintf("   %s\n", describeRouteEffort(effort, isRun)))
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": similar,
+		},
+	}
+}
+
+// describeRouteEffort formats an effort as e.g. "12.3 km in 45m 12s, 16.3 km/h, 210 W (NP 225 W), 148 bpm",
+// with the pace instead of the speed for runs.
+func describeRouteEffort(effort service.RouteEffort, running bool) string {
+	speed := fmt.Sprintf("%.1f km/h", effort.AverageSpeed*3.6)
+	if running {
+		speed = formatPace(effort.AverageSpeed)
+	}
+	text := fmt.Sprintf("%.1f km in %s, %s", effort.Distance/1000, formatDuration(effort.MovingTime), speed)
+	if effort.AverageWatts != nil {
+		text += fmt.Sprintf(", %.0f W", *effort.AverageWatts)
+		if effort.WeightedAverageWatts != nil {
+			text += fmt.Sprintf(" (NP %d W)", *effort.WeightedAverageWatts)
+		}
+	}
+	if effort.AverageHeartrate != nil {
+		text += fmt.Sprintf(", %.0f bpm", *effort.AverageHeartrate)
+	}
+	return text
+}
+
+func (s *MCPServer) searchActivitiesByLocation(req MCPRequest, arguments map[string]interface{}, c *gin.Context) MCPResponse {
+	after, before, err := dateRangeArguments(arguments)
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+	query := service.LocationQuery{After: after, Before: before, Limit: 20}
+	query.Sport, _ = arguments["sport"].(string)
+	query.Within, _ = arguments["within"].(bool)
+	query.Radius, _ = arguments["radius"].(float64)
+	if lat, ok := arguments["lat"].(float64); ok {
+		query.Lat = &lat
+	}
+	if lng, ok := arguments["lng"].(float64); ok {
+		query.Lng = &lng
+	}
+	if limit, ok := arguments["limit"].(float64); ok && limit > 0 {
+		query.Limit = int(limit)
+	}
+	if value, _ := arguments["bbox"].(string); value != "" {
+		box, err := geo.ParseBoundingBox(value)
+		if err != nil {
+			return MCPResponse{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+				Error: &MCPError{
+					Code:    -32602,
+					Message: err.Error(),
+				},
+			}
+		}
+		query.Box = &box
+	}
+
+	search, err := s.analyticsService.SearchActivitiesByLocation(c, query)
+	if errors.Is(err, sport.ErrUnknown) || errors.Is(err, service.ErrInvalidLocation) {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32602,
+				Message: err.Error(),
+			},
+		}
+	}
+	if err != nil {
+		return MCPResponse{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+			Error: &MCPError{
+				Code:    -32603,
+				Message: fmt.Sprintf("Failed to search activities by location: %v", err),
+			},
+		}
+	}
+
+	var text strings.Builder
+	if search.Box != nil {
+		verb := "passing through"
+		if search.Within {
+			verb = "inside"
+		}
+		text.WriteString(fmt.Sprintf("Activities %s %.5f,%.5f to %.5f,%.5f", verb, search.Box.South, search.Box.West, search.Box.North, search.Box.East))
+	} else {
+		text.WriteString(fmt.Sprintf("Activities within %.0f m of %.5f,%.5f", search.Radius, search.Point[0], search.Point[1]))
+	}
+	if search.Sport != "" {
+		text.WriteString(fmt.Sprintf(" (%s)", search.Sport))
+	}
+	text.WriteString(fmt.Sprintf("\n   %d found among %d activities with a location", search.Total, search.Indexed))
+	if len(search.Activities) < search.Total {
+		text.WriteString(fmt.Sprintf(", showing %d", len(search.Activities)))
+	}
+	text.WriteString("\n")
+	for _, match := range search.Activities {
+		text.WriteString(fmt.Sprintf("\n%s (ID: %d, %s, %s)\n", match.Name, match.ActivityID, match.SportType, match.Date))
+		text.WriteString(fmt.Sprintf("   %.1f km in %s", match.Length/1000, formatDuration(match.MovingTime)))
+		if match.Distance != nil {
+			text.WriteString(fmt.Sprintf(", passed %.0f m from the point", *match.Distance))
+		}
+		if match.Approximate {
+			text.WriteString(", located by start and end only")
+		}
+		text.WriteString("\n")
+	}
+
+	return MCPResponse{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{
+				{
+					"type": "text",
+					"text": text.String(),
+				},
+			},
+			"data": search,
+		},
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"slices"
+	"stravamcp/model"
+	"testing"
+)
+
+func TestGetActivitiesSportFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := NewMCPServer(newTestActivityService(t), nil, nil, nil)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	tests := []struct {
+		filter string
+		code   int
+		ids    []int64
+	}{
+		{"", 0, []int64{2, 1}},
+		{"runs", 0, []int64{1}},
+		{"gravel ride", 0, []int64{2}},
+		{"GravelRide", 0, []int64{2}},
+		{"cycling", 0, []int64{2}},
+		{"quidditch", -32602, nil},
+		{"runz", -32602, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			response := s.getActivities(MCPRequest{JSONRPC: "2.0", ID: 1}, map[string]interface{}{"filter": tt.filter}, c)
+			code := 0
+			if response.Error != nil {
+				code = response.Error.Code
+			}
+			if code != tt.code {
+				t.Fatalf("filter %q: error code %d, want %d (%+v)", tt.filter, code, tt.code, response.Error)
+			}
+			var ids []int64
+			if result, ok := response.Result.(map[string]interface{}); ok {
+				ids = activityIDs(result["data"].([]model.AthleteActivity))
+			} else if response.Result != nil {
+				t.Fatalf("filter %q: unexpected result %T", tt.filter, response.Result)
+			}
+			if !slices.Equal(ids, tt.ids) {
+				t.Errorf("filter %q returned activities %v, want %v", tt.filter, ids, tt.ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"stravamcp/service"
+	"time"
+)
+
+type SyncController interface {
+	GetStatus(c *gin.Context)
+	GetBackfill(c *gin.Context)
+	StartBackfill(c *gin.Context)
+}
+type syncController struct {
+	backfillService service.BackfillService
+	scheduler       service.SyncScheduler
+}
+
+func NewSyncController(backfillService service.BackfillService, scheduler service.SyncScheduler) SyncController {
+	return &syncController{backfillService: backfillService, scheduler: scheduler}
+}
+
+func (ctrl *syncController) GetStatus(c *gin.Context) {
+	status, err := ctrl.backfillService.Status()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{
+		"scheduler":  ctrl.scheduler.Status(),
+		"sync":       status.Sync,
+		"backfill":   status.Backfill,
+		"rate_limit": status.RateLimit,
+	})
+}
+
+func (ctrl *syncController) GetBackfill(c *gin.Context) {
+	status, err := ctrl.backfillService.Status()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, status)
+}
+
+func (ctrl *syncController) StartBackfill(c *gin.Context) {
+	since := time.Unix(0, 0)
+	if value := c.Query("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid 'since' date, use ISO 8601 (e.g. 2020-01-01T00:00:00Z)"})
+			return
+		}
+		since = parsed
+	}
+	state, err := ctrl.backfillService.Start(since)
+	if errors.Is(err, service.ErrBackfillRunning) {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(202, state)
+}
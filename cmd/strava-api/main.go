@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os/signal"
 	"stravamcp/api"
 	"stravamcp/config"
 	"stravamcp/pkg/client"
 	"stravamcp/repo"
 	"stravamcp/service"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -16,10 +22,58 @@ func main() {
 	}
 	stravaClient := client.NewStravaClient("https://www.strava.com")
 	tokenRepo := repo.NewTokenRepo(stravaClient, cfg.StravaClientID, cfg.StravaClientSecret, cfg.FolderPath, cfg.RefreshTokenFileName)
-	activityService := service.NewActivityService(stravaClient, tokenRepo, repo.NewStorage(cfg.FolderPath))
-	server := api.SetupRouter(activityService)
-	err = server.Run("localhost:8081")
+	storage := repo.NewStorage(cfg.FolderPath)
+	syncConfig, err := service.NewSyncConfig(cfg)
 	if err != nil {
-		log.Fatalf("Unable to start server %s", err)
+		log.Fatalf("Unable to get config %s", err)
+	}
+	activityService := service.NewActivityService(stravaClient, tokenRepo, storage, syncConfig)
+	err = activityService.MigrateStorage()
+	if errors.Is(err, repo.ErrSchemaTooNew) {
+		log.Fatalf("Unable to open data folder %s", err)
+	}
+	if err != nil {
+		log.Printf("Data folder migration incomplete, will retry on next start: %s", err)
+	}
+	backfillService := service.NewBackfillService(activityService, stravaClient, tokenRepo, storage)
+	if err := backfillService.Resume(); err != nil {
+		log.Printf("Unable to resume backfill %s", err)
+	}
+	scheduler := service.NewSyncScheduler(activityService, cfg.SyncInterval)
+	analyticsService := service.NewAnalyticsService(storage, service.NewAthleteConfig(cfg))
+	router := api.SetupRouter(activityService, service.NewArchiveService(storage), backfillService, scheduler, analyticsService)
+	server := &http.Server{Addr: "localhost:8081", Handler: router}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		scheduler.Run(ctx)
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Unable to start server %s", err)
+		}
+	case <-ctx.Done():
+		log.Printf("Shutting down")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown incomplete %s", err)
 	}
+	stop()
+	backfillService.Stop()
+	// A running sync is finished so the sync state is saved consistently.
+	<-schedulerDone
 }
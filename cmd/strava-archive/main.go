@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"stravamcp/config"
+	"stravamcp/pkg/archive"
+	"stravamcp/repo"
+	"stravamcp/service"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	datasetFlag := flags.String("dataset", "activities", "dataset to export or import: activities or streams")
+	formatFlag := flags.String("format", "jsonl", "file format: jsonl, csv or parquet")
+	fileFlag := flags.String("file", "", "file to write to or read from (defaults to stdout/stdin); for import-strava the export zip")
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Unable to parse flags %s", err)
+	}
+
+	dataset, err := archive.ParseDataset(*datasetFlag)
+	if err != nil {
+		log.Fatalf("Invalid dataset %s", err)
+	}
+	format, err := archive.ParseFormat(*formatFlag)
+	if err != nil {
+		log.Fatalf("Invalid format %s", err)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Unable to get config %s", err)
+	}
+	archiveService := service.NewArchiveService(repo.NewStorage(cfg.FolderPath))
+
+	switch command {
+	case "export":
+		var out io.Writer = os.Stdout
+		if *fileFlag != "" {
+			file, err := os.Create(*fileFlag)
+			if err != nil {
+				log.Fatalf("Unable to create file %s", err)
+			}
+			//nolint: errcheck // defer is used to clean up
+			defer file.Close()
+			out = file
+		}
+		count, err := archiveService.Export(out, dataset, format)
+		if err != nil {
+			log.Fatalf("Export failed %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d %s as %s\n", count, dataset, format)
+	case "import":
+		var in io.Reader = os.Stdin
+		if *fileFlag != "" {
+			file, err := os.Open(*fileFlag)
+			if err != nil {
+				log.Fatalf("Unable to open file %s", err)
+			}
+			//nolint: errcheck // defer is used to clean up
+			defer file.Close()
+			in = file
+		}
+		result, err := archiveService.Import(in, dataset, format)
+		if err != nil {
+			log.Fatalf("Import failed %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "Imported %d %s (%d already cached)\n", result.Imported, dataset, result.Skipped)
+	case "import-strava":
+		if *fileFlag == "" {
+			log.Fatalf("import-strava requires -file pointing at the Strava export zip")
+		}
+		result, err := archiveService.ImportStravaArchive(*fileFlag)
+		if err != nil {
+			log.Fatalf("Import failed %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "Imported %d activities and %d streams (%d already cached, %d unsupported files, %d failed)\n",
+			result.Activities, result.Streams, result.Skipped, result.Unsupported, len(result.Failed))
+		for _, failure := range result.Failed {
+			fmt.Fprintf(os.Stderr, "  %d %s: %s\n", failure.ActivityID, failure.File, failure.Error)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: strava-archive export|import [-dataset activities|streams] [-format jsonl|csv|parquet] [-file path]")
+	fmt.Fprintln(os.Stderr, "       strava-archive import-strava -file export.zip")
+}
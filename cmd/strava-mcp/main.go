@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"stravamcp/api"
@@ -21,8 +22,27 @@ func main() {
 
 	stravaClient := client.NewStravaClient("https://www.strava.com")
 	tokenRepo := repo.NewTokenRepo(stravaClient, cfg.StravaClientID, cfg.StravaClientSecret, cfg.FolderPath, cfg.RefreshTokenFileName)
-	activityService := service.NewActivityService(stravaClient, tokenRepo, repo.NewStorage(cfg.FolderPath))
-	mcpServer := api.NewMCPServer(activityService)
+	storage := repo.NewStorage(cfg.FolderPath)
+	syncConfig, err := service.NewSyncConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config error: %v\n", err)
+		os.Exit(1)
+	}
+	activityService := service.NewActivityService(stravaClient, tokenRepo, storage, syncConfig)
+	err = activityService.MigrateStorage()
+	if errors.Is(err, repo.ErrSchemaTooNew) {
+		fmt.Fprintf(os.Stderr, "Data folder error: %v\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Data folder migration incomplete, will retry on next start: %v\n", err)
+	}
+	backfillService := service.NewBackfillService(activityService, stravaClient, tokenRepo, storage)
+	if err := backfillService.Resume(); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to resume backfill: %v\n", err)
+	}
+	analyticsService := service.NewAnalyticsService(storage, service.NewAthleteConfig(cfg))
+	mcpServer := api.NewMCPServer(activityService, service.NewArchiveService(storage), backfillService, analyticsService)
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
 		line := scanner.Text()
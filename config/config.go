@@ -1,12 +1,38 @@
 package config
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"github.com/kelseyhightower/envconfig"
+	"time"
+)
 
 type Config struct {
 	StravaClientID       string `required:"true" split_words:"true"`
 	StravaClientSecret   string `required:"true" split_words:"true"`
 	FolderPath           string `required:"true" split_words:"true"`
 	RefreshTokenFileName string `required:"true" split_words:"true" default:"refresh_token.json"`
+
+	// SyncInterval is how often the API server syncs in the background. Zero disables the scheduler.
+	SyncInterval time.Duration `split_words:"true" default:"15m"`
+	// SyncInitialWindow is how far back the first sync of an empty cache reaches.
+	SyncInitialWindow time.Duration `split_words:"true" default:"720h"`
+	// SyncOverlap is subtracted from the high-water mark so activities uploaded late are still found.
+	SyncOverlap time.Duration `split_words:"true" default:"72h"`
+	// SyncReconcileInterval is how often a sync also re-checks SyncReconcileWindow for edits and deletions.
+	SyncReconcileInterval time.Duration `split_words:"true" default:"24h"`
+	SyncReconcileWindow   time.Duration `split_words:"true" default:"720h"`
+	// SyncReconcileMode is "tombstone" (keep a record of removed activities) or "purge".
+	SyncReconcileMode string `split_words:"true" default:"tombstone"`
+	// SyncConcurrency is the number of activity streams fetched in parallel.
+	SyncConcurrency int `split_words:"true" default:"4"`
+	// SyncRateLimitReserve is the number of requests per rate-limit window a sync leaves unused.
+	SyncRateLimitReserve int `split_words:"true" default:"10"`
+
+	// Athlete thresholds used by the analytics tools. Zero means unknown: max HR and LTHR are then
+	// estimated from the cached activities, and load falls back to heart rate without an FTP.
+	AthleteFtp       int `split_words:"true"`
+	AthleteMaxHr     int `split_words:"true"`
+	AthleteRestingHr int `split_words:"true"`
+	AthleteLthr      int `split_words:"true"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -126,6 +126,28 @@ type AthleteActivity struct {
 	SufferScore                *float64  `json:"suffer_score,omitempty"`
 }
 
+// Lap is a lap of a detailed activity. StartIndex and EndIndex point into the activity streams.
+type Lap struct {
+	ID               int64    `json:"id,omitempty"`
+	Name             string   `json:"name,omitempty"`
+	LapIndex         int      `json:"lap_index,omitempty"`
+	Split            int      `json:"split,omitempty"`
+	StartIndex       int      `json:"start_index"`
+	EndIndex         int      `json:"end_index"`
+	StartDate        string   `json:"start_date,omitempty"`
+	ElapsedTime      int      `json:"elapsed_time,omitempty"`
+	MovingTime       int      `json:"moving_time,omitempty"`
+	Distance         float64  `json:"distance,omitempty"`
+	AverageSpeed     float64  `json:"average_speed,omitempty"`
+	MaxSpeed         float64  `json:"max_speed,omitempty"`
+	AverageCadence   *float64 `json:"average_cadence,omitempty"`
+	AverageWatts     *float64 `json:"average_watts,omitempty"`
+	DeviceWatts      *bool    `json:"device_watts,omitempty"`
+	AverageHeartrate *float64 `json:"average_heartrate,omitempty"`
+	MaxHeartrate     *float64 `json:"max_heartrate,omitempty"`
+	PaceZone         *int     `json:"pace_zone,omitempty"`
+}
+
 type StreamData struct {
 	Data         []*float64 `json:"data,omitempty"`
 	SeriesType   string     `json:"series_type,omitempty"`
@@ -133,9 +155,36 @@ type StreamData struct {
 	Resolution   string     `json:"resolution,omitempty"`
 }
 
+type LatLngStreamData struct {
+	Data         [][]float64 `json:"data,omitempty"`
+	SeriesType   string      `json:"series_type,omitempty"`
+	OriginalSize int32       `json:"original_size,omitempty"`
+	Resolution   string      `json:"resolution,omitempty"`
+}
+
 type ActivityStreams struct {
-	Watts     *StreamData `json:"watts,omitempty"`
-	Time      *StreamData `json:"time,omitempty"`
-	Heartrate *StreamData `json:"heartrate,omitempty"`
-	Cadence   *StreamData `json:"cadence,omitempty"`
+	Watts          *StreamData       `json:"watts,omitempty"`
+	Time           *StreamData       `json:"time,omitempty"`
+	Heartrate      *StreamData       `json:"heartrate,omitempty"`
+	Cadence        *StreamData       `json:"cadence,omitempty"`
+	Distance       *StreamData       `json:"distance,omitempty"`
+	Altitude       *StreamData       `json:"altitude,omitempty"`
+	VelocitySmooth *StreamData       `json:"velocity_smooth,omitempty"`
+	Temp           *StreamData       `json:"temp,omitempty"`
+	GradeSmooth    *StreamData       `json:"grade_smooth,omitempty"`
+	LatLng         *LatLngStreamData `json:"latlng,omitempty"`
+}
+
+type ZoneRange struct {
+	Min int `json:"min"`
+	// Max is -1 for the open-ended top zone.
+	Max int `json:"max"`
+}
+type ZoneRanges struct {
+	CustomZones bool        `json:"custom_zones"`
+	Zones       []ZoneRange `json:"zones"`
+}
+type AthleteZones struct {
+	HeartRate *ZoneRanges `json:"heart_rate,omitempty"`
+	Power     *ZoneRanges `json:"power,omitempty"`
 }
@@ -0,0 +1,213 @@
+package analytics
+
+import (
+	"math"
+	"stravamcp/model"
+)
+
+const (
+	// profileStep is the distance, in meters, between points of the elevation profile.
+	profileStep = 10
+	// profileSmoothing is how many profile points either side are averaged, i.e. 50 m.
+	profileSmoothing = 5
+	// gainHysteresis is the altitude change, in meters, needed before gain or loss is counted,
+	// so that barometer and GPS noise on the flat adds nothing.
+	gainHysteresis = 1
+	// climbDipTolerance is the descent, in meters, a climb may contain before it ends; longer
+	// climbs tolerate a fifth of the height gained so far.
+	climbDipTolerance = 10
+	// climbTrim is the height, in meters, within which the start and end of a climb are moved
+	// to the last point near its low and the first point near its high.
+	climbTrim = 1
+	// minClimbGrade is the lowest average gradient, in percent, of a climb.
+	minClimbGrade = 3
+	// maxGradeWindow is the distance, in meters, the maximum gradient is averaged over.
+	maxGradeWindow = 100
+)
+
+// Climb categories by score, the climb length in meters times its average gradient in percent,
+// following Strava's thresholds.
+var climbCategories = []struct {
+	Name  string
+	Score float64
+}{
+	{"HC", 80000},
+	{"1", 64000},
+	{"2", 32000},
+	{"3", 16000},
+	{"4", 8000},
+}
+
+// Climb is a categorized climb. Start and End are distances from the start of the activity in
+// meters, StartSecond the offset in moving time and VAM the vertical ascent in meters per hour.
+type Climb struct {
+	Category      string  `json:"category"`
+	Start         float64 `json:"start"`
+	End           float64 `json:"end"`
+	StartSecond   int     `json:"start_second"`
+	Length        float64 `json:"length"`
+	ElevationGain float64 `json:"elevation_gain"`
+	StartAltitude float64 `json:"start_altitude"`
+	EndAltitude   float64 `json:"end_altitude"`
+	AverageGrade  float64 `json:"average_grade"`
+	MaxGrade      float64 `json:"max_grade"`
+	Seconds       int     `json:"seconds"`
+	VAM           float64 `json:"vam"`
+}
+
+// ClimbProfile is the elevation analysis of an activity: gain and loss of the smoothed profile,
+// and its climbs in order.
+type ClimbProfile struct {
+	SmoothedGain float64 `json:"smoothed_gain"`
+	SmoothedLoss float64 `json:"smoothed_loss"`
+	Climbs       []Climb `json:"climbs"`
+}
+
+type profilePoint struct {
+	distance, altitude, second float64
+}
+
+// DetectClimbs resamples altitude every 10 m of distance, smooths it over 100 m and finds the
+// climbs that score at least category 4: from a low point, a climb continues while the profile
+// stays within a tolerated dip of its high point, and ends at that high point. It reports false
+// without altitude and distance streams.
+func DetectClimbs(streams *model.ActivityStreams) (ClimbProfile, bool) {
+	if streams == nil {
+		return ClimbProfile{}, false
+	}
+	profile := elevationProfile(carryForward(PerSecond(streams.Time, streams.Distance)), carryForward(PerSecond(streams.Time, streams.Altitude)))
+	if len(profile) < 2 {
+		return ClimbProfile{}, false
+	}
+	result := ClimbProfile{Climbs: []Climb{}}
+	result.SmoothedGain, result.SmoothedLoss = hysteresisGain(profile)
+
+	low, high := 0, 0
+	for i := 1; i <= len(profile); i++ {
+		if i < len(profile) {
+			altitude := profile[i].altitude
+			if altitude < profile[low].altitude {
+				low, high = i, i
+				continue
+			}
+			if altitude >= profile[high].altitude {
+				high = i
+				continue
+			}
+			gained := profile[high].altitude - profile[low].altitude
+			if profile[high].altitude-altitude <= math.Max(climbDipTolerance, gained/5) {
+				continue
+			}
+		}
+		if climb, ok := newClimb(profile, low, high); ok {
+			result.Climbs = append(result.Climbs, climb)
+		}
+		if i < len(profile) {
+			low, high = i, i
+		}
+	}
+	return result, true
+}
+
+func newClimb(profile []profilePoint, low, high int) (Climb, bool) {
+	// Trim flat approaches and plateaus, which the low and high point may lie anywhere on.
+	bottom, top := profile[low].altitude, profile[high].altitude
+	for i := low; i < high; i++ {
+		if profile[i].altitude <= bottom+climbTrim {
+			low = i
+		}
+	}
+	for i := high; i > low; i-- {
+		if profile[i].altitude >= top-climbTrim {
+			high = i
+		}
+	}
+	start, end := profile[low], profile[high]
+	length := end.distance - start.distance
+	gain := end.altitude - start.altitude
+	if length <= 0 {
+		return Climb{}, false
+	}
+	grade := gain / length * 100
+	category := ""
+	for _, c := range climbCategories {
+		if length*grade >= c.Score {
+			category = c.Name
+			break
+		}
+	}
+	if category == "" || grade < minClimbGrade {
+		return Climb{}, false
+	}
+	maxGrade := grade
+	window := maxGradeWindow / profileStep
+	for i := low; i+window <= high; i++ {
+		maxGrade = math.Max(maxGrade, (profile[i+window].altitude-profile[i].altitude)/maxGradeWindow*100)
+	}
+	seconds := end.second - start.second
+	climb := Climb{
+		Category:      category,
+		Start:         round(start.distance, 0),
+		End:           round(end.distance, 0),
+		StartSecond:   int(math.Round(start.second)),
+		Length:        round(length, 0),
+		ElevationGain: round(gain, 0),
+		StartAltitude: round(start.altitude, 0),
+		EndAltitude:   round(end.altitude, 0),
+		AverageGrade:  round(grade, 1),
+		MaxGrade:      round(maxGrade, 1),
+		Seconds:       int(math.Round(seconds)),
+	}
+	if seconds > 0 {
+		climb.VAM = round(gain/seconds*3600, 0)
+	}
+	return climb, true
+}
+
+// elevationProfile interpolates altitude and moving time every profileStep meters of distance
+// and smooths the altitude.
+func elevationProfile(distance, altitude []float64) []profilePoint {
+	n := min(len(distance), len(altitude))
+	if n < 2 || math.IsNaN(distance[0]) || math.IsNaN(altitude[0]) {
+		return nil
+	}
+	var profile []profilePoint
+	target := distance[0]
+	for i := 1; i < n; i++ {
+		for distance[i] >= target && distance[i] > distance[i-1] {
+			f := (target - distance[i-1]) / (distance[i] - distance[i-1])
+			profile = append(profile, profilePoint{
+				distance: target - distance[0],
+				altitude: altitude[i-1] + f*(altitude[i]-altitude[i-1]),
+				second:   float64(i-1) + f,
+			})
+			target += profileStep
+		}
+	}
+	altitudes := make([]float64, len(profile))
+	for i := range profile {
+		altitudes[i] = profile[i].altitude
+	}
+	for i, a := range smooth(altitudes, 2*profileSmoothing) {
+		profile[i].altitude = a
+	}
+	return profile
+}
+
+// hysteresisGain sums ascent and descent once the profile has moved gainHysteresis from the last
+// turning point.
+func hysteresisGain(profile []profilePoint) (float64, float64) {
+	var gain, loss float64
+	reference := profile[0].altitude
+	for _, p := range profile[1:] {
+		switch d := p.altitude - reference; {
+		case d >= gainHysteresis:
+			gain += d
+			reference = p.altitude
+		case d <= -gainHysteresis:
+			loss -= d
+			reference = p.altitude
+		}
+	}
+	return round(gain, 0), round(loss, 0)
+}
@@ -0,0 +1,134 @@
+package analytics
+
+import (
+	"math"
+	"stravamcp/model"
+)
+
+// Decoupling methods: power or speed against heart rate.
+const (
+	PowerHR = "pw:hr"
+	PaceHR  = "pace:hr"
+)
+
+// Decoupling assessments, following Friel: below 5% the aerobic base held up for the duration.
+const (
+	Coupled    = "coupled"
+	Drifting   = "drifting"
+	Decoupled  = "decoupled"
+	coupledMax = 5
+	driftMax   = 10
+)
+
+// MinDecouplingSeconds is the shortest moving time worth comparing halves of.
+const MinDecouplingSeconds = 20 * 60
+
+// StoppedSpeed is the speed, in m/s, below which the athlete is standing still rather than
+// moving slowly. Heart rate keeps falling while stopped, so these seconds are left out.
+const StoppedSpeed = 0.5
+
+// EfficiencyHalf is the efficiency factor of one half of an activity. Output is normalized power
+// in watts for Pw:HR and speed in meters per minute for Pace:HR.
+type EfficiencyHalf struct {
+	Seconds   int     `json:"seconds"`
+	Output    float64 `json:"output"`
+	Heartrate float64 `json:"heartrate"`
+	EF        float64 `json:"ef"`
+}
+
+// Decoupling compares the efficiency factor of the first and second half of the moving time.
+// A positive Percent means heart rate drifted up relative to output.
+type Decoupling struct {
+	Method         string         `json:"method"`
+	Seconds        int            `json:"seconds"`
+	StoppedSeconds int            `json:"stopped_seconds"`
+	EF             float64        `json:"ef"`
+	FirstHalf      EfficiencyHalf `json:"first_half"`
+	SecondHalf     EfficiencyHalf `json:"second_half"`
+	Percent        float64        `json:"percent"`
+	Assessment     string         `json:"assessment"`
+}
+
+// Decouple computes Pw:HR or Pace:HR decoupling over moving time. Seconds without heart rate, and
+// seconds slower than StoppedSpeed when there is a speed stream, are dropped; for Pw:HR missing
+// power counts as zero, as when coasting. It reports false without enough data.
+func Decouple(streams *model.ActivityStreams, method string) (Decoupling, bool) {
+	if streams == nil {
+		return Decoupling{}, false
+	}
+	hr := PerSecond(streams.Time, streams.Heartrate)
+	speed := PerSecond(streams.Time, streams.VelocitySmooth)
+	var output []float64
+	if method == PowerHR {
+		output = PerSecond(streams.Time, streams.Watts)
+	} else {
+		output = speed
+	}
+	if len(hr) == 0 || len(output) == 0 {
+		return Decoupling{}, false
+	}
+
+	var moving, heart []float64
+	stopped := 0
+	for i := range min(len(hr), len(output)) {
+		if math.IsNaN(hr[i]) || hr[i] <= 0 {
+			continue
+		}
+		if i < len(speed) && !math.IsNaN(speed[i]) && speed[i] < StoppedSpeed {
+			stopped++
+			continue
+		}
+		value := output[i]
+		if math.IsNaN(value) {
+			if method != PowerHR {
+				continue
+			}
+			value = 0
+		}
+		moving = append(moving, value)
+		heart = append(heart, hr[i])
+	}
+	if len(moving) < MinDecouplingSeconds {
+		return Decoupling{}, false
+	}
+
+	half := len(moving) / 2
+	d := Decoupling{
+		Method:         method,
+		Seconds:        len(moving),
+		StoppedSeconds: stopped,
+		EF:             efficiency(moving, heart, method).EF,
+		FirstHalf:      efficiency(moving[:half], heart[:half], method),
+		SecondHalf:     efficiency(moving[half:], heart[half:], method),
+	}
+	if d.FirstHalf.EF == 0 {
+		return Decoupling{}, false
+	}
+	d.Percent = round((d.FirstHalf.EF-d.SecondHalf.EF)/d.FirstHalf.EF*100, 1)
+	switch {
+	case d.Percent < coupledMax:
+		d.Assessment = Coupled
+	case d.Percent <= driftMax:
+		d.Assessment = Drifting
+	default:
+		d.Assessment = Decoupled
+	}
+	return d, true
+}
+
+// efficiency is output per heart beat: normalized power or meters per minute over average heart rate.
+func efficiency(output, hr []float64, method string) EfficiencyHalf {
+	var value float64
+	if method == PowerHR {
+		value = NormalizedPower(output)
+	} else {
+		speed, _ := mean(output)
+		value = speed * 60
+	}
+	heart, _ := mean(hr)
+	half := EfficiencyHalf{Seconds: len(output), Output: round(value, 1), Heartrate: round(heart, 1)}
+	if heart > 0 {
+		half.EF = round(value/heart, 3)
+	}
+	return half
+}
@@ -0,0 +1,365 @@
+package analytics
+
+import (
+	"math"
+	"stravamcp/model"
+)
+
+// Block types. The first and last easy blocks of a workout are its warm-up and cool-down, and a
+// session without distinct work and rest is a single steady block.
+const (
+	Work     = "work"
+	Rest     = "rest"
+	WarmUp   = "warmup"
+	CoolDown = "cooldown"
+	Steady   = "steady"
+)
+
+// Interval signals and sources.
+const (
+	SignalPower  = "power"
+	SignalPace   = "pace"
+	SourceLaps   = "laps"
+	SourceDetect = "detected"
+)
+
+const (
+	// MinBlockSeconds is the shortest work or rest block; shorter blips are merged into their
+	// neighbours.
+	MinBlockSeconds = 15
+	// LapSnapSeconds is how far a detected boundary moves to meet a lap boundary.
+	LapSnapSeconds = 15
+	// intervalSmoothing is the centered rolling average, in seconds, applied before splitting.
+	intervalSmoothing = 10
+	// minWorkRestRatio is how much harder work has to be than rest for a session to count as
+	// intervals rather than steady.
+	minWorkRestRatio = 1.3
+)
+
+// Block is a stretch of moving time. Start is the offset in seconds of moving time; averages
+// and maxima are omitted when the stream is missing.
+type Block struct {
+	Type             string   `json:"type"`
+	Lap              int      `json:"lap,omitempty"`
+	Start            int      `json:"start"`
+	Seconds          int      `json:"seconds"`
+	Distance         *float64 `json:"distance,omitempty"`
+	AverageWatts     *float64 `json:"average_watts,omitempty"`
+	MaxWatts         *float64 `json:"max_watts,omitempty"`
+	AverageSpeed     *float64 `json:"average_speed,omitempty"`
+	AverageHeartrate *float64 `json:"average_heartrate,omitempty"`
+	MaxHeartrate     *float64 `json:"max_heartrate,omitempty"`
+	AverageCadence   *float64 `json:"average_cadence,omitempty"`
+}
+
+// Intervals is the segmentation of an activity into work and rest. Threshold is the watts or
+// meters per second separating them.
+type Intervals struct {
+	Signal    string  `json:"signal"`
+	Source    string  `json:"source"`
+	Threshold float64 `json:"threshold"`
+	Work      int     `json:"work"`
+	Blocks    []Block `json:"blocks"`
+}
+
+type span struct {
+	start, end int
+	work       bool
+	lap        int
+}
+
+// DetectIntervals splits the power or speed stream into work and rest at Otsu's threshold of the
+// smoothed signal. Manual laps, at least two that are not automatic laps of equal distance or
+// time, refine the blocks: detected boundaries snap to lap boundaries nearby, and blocks are split
+// at the other lap boundaries so that consecutive workout steps stay apart. It reports false
+// without the signal.
+func DetectIntervals(streams *model.ActivityStreams, laps []model.Lap, signal string) (Intervals, bool) {
+	if streams == nil {
+		return Intervals{}, false
+	}
+	source := streams.VelocitySmooth
+	if signal == SignalPower {
+		source = streams.Watts
+	}
+	values := zeroNaN(PerSecond(streams.Time, source))
+	if len(values) < 2*MinBlockSeconds {
+		return Intervals{}, false
+	}
+	smoothed := smooth(values, intervalSmoothing)
+	threshold := otsu(smoothed)
+	result := Intervals{Signal: signal, Source: SourceDetect, Threshold: round(threshold, 2), Blocks: []Block{}}
+
+	spans := detectSpans(smoothed, threshold)
+	if manualLaps(laps) {
+		result.Source = SourceLaps
+		spans = applyLaps(spans, lapBoundaries(laps, secondOffsets(streams.Time), len(values)))
+	}
+
+	work, rest := splitMeans(values, spans, threshold)
+	steady := work == 0 || (rest > 0 && work < rest*minWorkRestRatio)
+	if steady {
+		spans = []span{{start: 0, end: len(values)}}
+		result.Source = SourceDetect
+	}
+
+	hr := PerSecond(streams.Time, streams.Heartrate)
+	cadence := PerSecond(streams.Time, streams.Cadence)
+	watts := PerSecond(streams.Time, streams.Watts)
+	speed := PerSecond(streams.Time, streams.VelocitySmooth)
+	distance := PerSecond(streams.Time, streams.Distance)
+	for _, s := range spans {
+		block := Block{Type: Rest, Lap: s.lap, Start: s.start, Seconds: s.end - s.start}
+		switch {
+		case steady:
+			block.Type = Steady
+		case s.work:
+			block.Type = Work
+			result.Work++
+		}
+		block.Distance = spanDistance(distance, s)
+		block.AverageWatts, block.MaxWatts = spanStats(zeroNaN(watts), s, 0)
+		block.AverageSpeed, _ = spanStats(speed, s, 2)
+		block.AverageHeartrate, block.MaxHeartrate = spanStats(hr, s, 0)
+		block.AverageCadence, _ = spanStats(cadence, s, 0)
+		result.Blocks = append(result.Blocks, block)
+	}
+	if result.Work > 0 {
+		if first := &result.Blocks[0]; first.Type == Rest {
+			first.Type = WarmUp
+		}
+		if last := &result.Blocks[len(result.Blocks)-1]; last.Type == Rest {
+			last.Type = CoolDown
+		}
+	}
+	return result, true
+}
+
+// detectSpans turns the thresholded signal into runs, repeatedly merging the shortest run under
+// MinBlockSeconds into its neighbours.
+func detectSpans(smoothed []float64, threshold float64) []span {
+	var spans []span
+	for i, v := range smoothed {
+		work := v >= threshold
+		if len(spans) > 0 && spans[len(spans)-1].work == work {
+			spans[len(spans)-1].end = i + 1
+			continue
+		}
+		spans = append(spans, span{start: i, end: i + 1, work: work})
+	}
+	for len(spans) > 1 {
+		shortest := -1
+		for i, s := range spans {
+			if s.end-s.start < MinBlockSeconds && (shortest < 0 || s.end-s.start < spans[shortest].end-spans[shortest].start) {
+				shortest = i
+			}
+		}
+		if shortest < 0 {
+			break
+		}
+		spans[shortest].work = !spans[shortest].work
+		merged := spans[:1]
+		for _, s := range spans[1:] {
+			if last := &merged[len(merged)-1]; last.work == s.work {
+				last.end = s.end
+				continue
+			}
+			merged = append(merged, s)
+		}
+		spans = merged
+	}
+	return spans
+}
+
+// applyLaps moves the boundaries between spans to lap boundaries within LapSnapSeconds, then
+// splits spans at the remaining lap boundaries and numbers every span by the lap it starts in.
+func applyLaps(spans []span, boundaries []int) []span {
+	for i := 1; i < len(spans); i++ {
+		best := -1
+		for _, b := range boundaries {
+			if b <= spans[i-1].start || b >= spans[i].end {
+				continue
+			}
+			if d := abs(b - spans[i].start); d <= LapSnapSeconds && (best < 0 || d < abs(best-spans[i].start)) {
+				best = b
+			}
+		}
+		if best >= 0 {
+			spans[i-1].end, spans[i].start = best, best
+		}
+	}
+	var split []span
+	for _, s := range spans {
+		for _, b := range boundaries {
+			if b-s.start >= MinBlockSeconds && s.end-b >= MinBlockSeconds {
+				split = append(split, span{start: s.start, end: b, work: s.work})
+				s.start = b
+			}
+		}
+		split = append(split, s)
+	}
+	for i := range split {
+		split[i].lap = 1
+		for _, b := range boundaries {
+			if b <= split[i].start {
+				split[i].lap++
+			}
+		}
+	}
+	return split
+}
+
+// manualLaps reports whether the laps were pressed by the athlete rather than recorded
+// automatically every kilometer, mile or fixed time.
+func manualLaps(laps []model.Lap) bool {
+	if len(laps) < 2 {
+		return false
+	}
+	if len(laps) < 3 {
+		return true
+	}
+	sameDistance, sameTime := laps[0].Distance > 0, true
+	for _, lap := range laps[1 : len(laps)-1] {
+		if math.Abs(lap.Distance-laps[0].Distance) > laps[0].Distance*0.02 {
+			sameDistance = false
+		}
+		if abs(lap.ElapsedTime-laps[0].ElapsedTime) > 2 {
+			sameTime = false
+		}
+	}
+	return !sameDistance && !sameTime
+}
+
+func lapBoundaries(laps []model.Lap, offsets []int, n int) []int {
+	var boundaries []int
+	for _, lap := range laps[min(1, len(laps)):] {
+		boundaries = append(boundaries, lapOffset(offsets, lap.StartIndex, n))
+	}
+	return boundaries
+}
+
+func lapOffset(offsets []int, index, n int) int {
+	if index >= len(offsets) {
+		return n
+	}
+	return min(offsets[max(index, 0)], n)
+}
+
+// splitMeans classifies spans by their average against the threshold and returns the average
+// signal of work and of rest.
+func splitMeans(values []float64, spans []span, threshold float64) (float64, float64) {
+	var work, rest []float64
+	for i := range spans {
+		s := &spans[i]
+		avg, _ := mean(values[s.start:s.end])
+		s.work = avg >= threshold
+		if s.work {
+			work = append(work, values[s.start:s.end]...)
+		} else {
+			rest = append(rest, values[s.start:s.end]...)
+		}
+	}
+	w, _ := mean(work)
+	r, _ := mean(rest)
+	return w, r
+}
+
+// otsu is the threshold that best separates the values into two classes, maximising the
+// between-class variance over a 100 bin histogram.
+func otsu(values []float64) float64 {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		low, high = math.Min(low, v), math.Max(high, v)
+	}
+	if high <= low {
+		return high
+	}
+	const bins = 100
+	width := (high - low) / bins
+	var histogram [bins]float64
+	var sum float64
+	for _, v := range values {
+		histogram[min(int((v-low)/width), bins-1)]++
+		sum += v
+	}
+	total := float64(len(values))
+	var weight, weightedSum, best, threshold float64
+	for i, count := range histogram {
+		center := low + (float64(i)+0.5)*width
+		weight += count
+		weightedSum += count * center
+		if weight == 0 || weight == total {
+			continue
+		}
+		meanLow := weightedSum / weight
+		meanHigh := (sum - weightedSum) / (total - weight)
+		between := weight * (total - weight) * (meanLow - meanHigh) * (meanLow - meanHigh)
+		if between > best {
+			best, threshold = between, low+float64(i+1)*width
+		}
+	}
+	return threshold
+}
+
+// smooth is a centered rolling average.
+func smooth(values []float64, window int) []float64 {
+	prefix := make([]float64, len(values)+1)
+	for i, v := range values {
+		prefix[i+1] = prefix[i] + v
+	}
+	out := make([]float64, len(values))
+	for i := range values {
+		from, to := max(i-window/2, 0), min(i+window/2+1, len(values))
+		out[i] = (prefix[to] - prefix[from]) / float64(to-from)
+	}
+	return out
+}
+
+func spanStats(values []float64, s span, decimals int) (*float64, *float64) {
+	if s.end > len(values) {
+		return nil, nil
+	}
+	avg, n := mean(values[s.start:s.end])
+	if n == 0 {
+		return nil, nil
+	}
+	peak := math.Inf(-1)
+	for _, v := range values[s.start:s.end] {
+		if !math.IsNaN(v) {
+			peak = math.Max(peak, v)
+		}
+	}
+	avg, peak = round(avg, decimals), round(peak, decimals)
+	return &avg, &peak
+}
+
+func spanDistance(distance []float64, s span) *float64 {
+	if s.end > len(distance) {
+		return nil
+	}
+	first, last := math.NaN(), math.NaN()
+	for _, v := range distance[s.start:s.end] {
+		if math.IsNaN(v) {
+			continue
+		}
+		if math.IsNaN(first) {
+			first = v
+		}
+		last = v
+	}
+	if math.IsNaN(first) {
+		return nil
+	}
+	// The distance stream is cumulative; include the step into the next block.
+	if s.end < len(distance) && !math.IsNaN(distance[s.end]) {
+		last = distance[s.end]
+	}
+	d := round(last-first, 0)
+	return &d
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
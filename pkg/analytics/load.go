@@ -0,0 +1,147 @@
+package analytics
+
+import (
+	"math"
+	"stravamcp/model"
+	"time"
+)
+
+// Thresholds are the athlete values the load model is scaled with. Zero means unknown.
+type Thresholds struct {
+	FTP       float64 `json:"ftp,omitempty"`
+	MaxHR     float64 `json:"max_hr,omitempty"`
+	RestingHR float64 `json:"resting_hr,omitempty"`
+	LTHR      float64 `json:"lthr,omitempty"`
+}
+
+// Load methods, from most to least accurate.
+const (
+	MethodPower        = "power"
+	MethodPowerSummary = "power_summary"
+	MethodHeartRate    = "heart_rate"
+	MethodHRSummary    = "heart_rate_summary"
+	MethodNone         = "none"
+)
+
+// ActivityLoad is the training stress of one activity.
+type ActivityLoad struct {
+	TSS    float64 `json:"tss"`
+	Method string  `json:"method"`
+	// NP and IF are set for power-based scores, TRIMP for heart-rate based ones.
+	NP    float64 `json:"np,omitempty"`
+	IF    float64 `json:"if,omitempty"`
+	TRIMP float64 `json:"trimp,omitempty"`
+}
+
+// ScoreActivity computes the training stress score of an activity. Power-based TSS is used when
+// FTP is known and the activity has power, either from the watts stream or from Strava's
+// weighted average. Otherwise heart-rate TSS is derived from Banister's TRIMP, scaled so an
+// hour at LTHR scores 100, from the heartrate stream or the average heart rate. streams may
+// be nil.
+func ScoreActivity(activity *model.AthleteActivity, streams *model.ActivityStreams, t Thresholds) ActivityLoad {
+	if t.FTP > 0 {
+		if streams != nil && Has(streams.Watts) {
+			watts := PerSecond(streams.Time, streams.Watts)
+			if len(watts) > 0 {
+				return powerLoad(NormalizedPower(watts), float64(len(watts)), t.FTP, MethodPower)
+			}
+		}
+		if activity.WeightedAverageWatts != nil && activity.DeviceWatts != nil && *activity.DeviceWatts {
+			return powerLoad(float64(*activity.WeightedAverageWatts), float64(activity.MovingTime), t.FTP, MethodPowerSummary)
+		}
+	}
+
+	// An LTHR at or below resting heart rate scores no TRIMP, which heart-rate TSS divides by.
+	if t.MaxHR > t.RestingHR && t.LTHR > 0 && trimpRate(t.LTHR, t) > 0 {
+		if streams != nil && Has(streams.Heartrate) {
+			var trimp float64
+			for _, hr := range PerSecond(streams.Time, streams.Heartrate) {
+				if !math.IsNaN(hr) {
+					trimp += trimpRate(hr, t) / 60
+				}
+			}
+			if trimp > 0 {
+				return hrLoad(trimp, t, MethodHeartRate)
+			}
+		}
+		if activity.AverageHeartrate != nil && activity.MovingTime > 0 {
+			trimp := trimpRate(*activity.AverageHeartrate, t) * float64(activity.MovingTime) / 60
+			return hrLoad(trimp, t, MethodHRSummary)
+		}
+	}
+	return ActivityLoad{Method: MethodNone}
+}
+
+func powerLoad(np, seconds, ftp float64, method string) ActivityLoad {
+	intensity := np / ftp
+	return ActivityLoad{
+		TSS:    round(seconds*np*intensity/(ftp*3600)*100, 1),
+		Method: method,
+		NP:     round(np, 0),
+		IF:     round(intensity, 2),
+	}
+}
+
+func hrLoad(trimp float64, t Thresholds, method string) ActivityLoad {
+	return ActivityLoad{
+		TSS:    round(trimp/(60*trimpRate(t.LTHR, t))*100, 1),
+		Method: method,
+		TRIMP:  round(trimp, 1),
+	}
+}
+
+// trimpRate is Banister's TRIMP per minute at the given heart rate.
+func trimpRate(hr float64, t Thresholds) float64 {
+	reserve := (hr - t.RestingHR) / (t.MaxHR - t.RestingHR)
+	reserve = math.Max(0, math.Min(1, reserve))
+	return reserve * 0.64 * math.Exp(1.92*reserve)
+}
+
+// Time constants of the fitness (chronic) and fatigue (acute) load, in days.
+const (
+	ChronicDays = 42
+	AcuteDays   = 7
+)
+
+// DayLoad is the load on one calendar day.
+type DayLoad struct {
+	Date string  `json:"date"`
+	TSS  float64 `json:"tss"`
+	// CTL (fitness) and ATL (fatigue) are exponentially weighted averages of daily TSS at the
+	// end of the day. TSB (form) is yesterday's CTL minus ATL, i.e. the form going into the day.
+	CTL float64 `json:"ctl"`
+	ATL float64 `json:"atl"`
+	TSB float64 `json:"tsb"`
+}
+
+// LoadSeries builds the daily CTL/ATL/TSB series from the TSS per day ("2006-01-02") between
+// from and to inclusive. Both load values start at zero on the first day.
+func LoadSeries(daily map[string]float64, from, to time.Time) []DayLoad {
+	var series []DayLoad
+	var ctl, atl float64
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		tss := daily[date]
+		form := ctl - atl
+		ctl += (tss - ctl) / ChronicDays
+		atl += (tss - atl) / AcuteDays
+		series = append(series, DayLoad{Date: date, TSS: round(tss, 1), CTL: round(ctl, 1), ATL: round(atl, 1), TSB: round(form, 1)})
+	}
+	return series
+}
+
+// FormStatus describes a TSB value with the usual coaching bands.
+func FormStatus(tsb float64) string {
+	switch {
+	case tsb > 25:
+		return "transition: fresh but losing fitness"
+	case tsb > 5:
+		return "fresh: ready to race"
+	case tsb > -10:
+		return "neutral: maintaining"
+	case tsb > -30:
+		return "optimal: productive training"
+	default:
+		return "high risk: accumulated fatigue"
+	}
+}
@@ -0,0 +1,109 @@
+package analytics
+
+import "math"
+
+// NormalizedPower is the fourth-power mean of the 30 second rolling average of 1 Hz power.
+// Rides shorter than 30 seconds fall back to the plain average.
+func NormalizedPower(watts []float64) float64 {
+	watts = zeroNaN(watts)
+	const window = 30
+	if len(watts) < window {
+		avg, _ := mean(watts)
+		return avg
+	}
+	var rolling, sum float64
+	for i := 0; i < window; i++ {
+		rolling += watts[i]
+	}
+	count := 0
+	for i := window - 1; i < len(watts); i++ {
+		if i >= window {
+			rolling += watts[i] - watts[i-window]
+		}
+		sum += math.Pow(rolling/window, 4)
+		count++
+	}
+	return math.Pow(sum/float64(count), 0.25)
+}
+
+// CurveDurations are the durations, in seconds, of the mean-maximal power curve.
+var CurveDurations = []int{1, 5, 10, 15, 30, 60, 120, 180, 300, 480, 600, 720, 900, 1200, 1800, 2700, 3600}
+
+// CurvePoint is the best average power held for a duration.
+type CurvePoint struct {
+	Seconds int     `json:"seconds"`
+	Watts   float64 `json:"watts"`
+}
+
+// PowerSummary describes the power of one activity.
+type PowerSummary struct {
+	Seconds      int     `json:"seconds"`
+	AverageWatts float64 `json:"average_watts"`
+	MaxWatts     float64 `json:"max_watts"`
+	NP           float64 `json:"np"`
+	// IF and TSS need an FTP.
+	IF  float64 `json:"if,omitempty"`
+	TSS float64 `json:"tss,omitempty"`
+	// VI is the variability index, NP divided by average power.
+	VI         float64      `json:"vi"`
+	Kilojoules float64      `json:"kilojoules"`
+	Curve      []CurvePoint `json:"curve"`
+}
+
+// AnalyzePower summarises 1 Hz power. Missing samples count as zero, as when coasting.
+func AnalyzePower(watts []float64, ftp float64) PowerSummary {
+	watts = zeroNaN(watts)
+	summary := PowerSummary{Seconds: len(watts), Curve: MeanMaximal(watts)}
+	if len(watts) == 0 {
+		return summary
+	}
+	var work float64
+	for _, w := range watts {
+		work += w
+		summary.MaxWatts = math.Max(summary.MaxWatts, w)
+	}
+	average := work / float64(len(watts))
+	np := NormalizedPower(watts)
+	summary.AverageWatts = round(average, 0)
+	summary.NP = round(np, 0)
+	summary.Kilojoules = round(work/1000, 0)
+	if average > 0 {
+		summary.VI = round(np/average, 2)
+	}
+	if ftp > 0 {
+		load := powerLoad(np, float64(len(watts)), ftp, MethodPower)
+		summary.IF, summary.TSS = load.IF, load.TSS
+	}
+	return summary
+}
+
+// MeanMaximal returns the best average power for every curve duration the series is long enough for.
+func MeanMaximal(watts []float64) []CurvePoint {
+	watts = zeroNaN(watts)
+	prefix := make([]float64, len(watts)+1)
+	for i, w := range watts {
+		prefix[i+1] = prefix[i] + w
+	}
+	curve := []CurvePoint{}
+	for _, d := range CurveDurations {
+		if d > len(watts) {
+			break
+		}
+		best := 0.0
+		for end := d; end <= len(watts); end++ {
+			best = math.Max(best, prefix[end]-prefix[end-d])
+		}
+		curve = append(curve, CurvePoint{Seconds: d, Watts: round(best/float64(d), 0)})
+	}
+	return curve
+}
+
+// EstimateFTP is 95% of the best 20 minute power, or zero when the curve does not reach 20 minutes.
+func EstimateFTP(curve []CurvePoint) float64 {
+	for _, point := range curve {
+		if point.Seconds == 1200 {
+			return math.Round(point.Watts * 0.95)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,43 @@
+package analytics
+
+import (
+	"math"
+	"stravamcp/model"
+)
+
+// FastestTimes returns, for every distance in meters, the fastest moving time in seconds the
+// activity covered it in, anywhere in the activity. The start of an effort is interpolated
+// within the second it was crossed. Distances longer than the activity are zero.
+func FastestTimes(streams *model.ActivityStreams, distances []float64) []float64 {
+	times := make([]float64, len(distances))
+	if streams == nil {
+		return times
+	}
+	distance := carryForward(PerSecond(streams.Time, streams.Distance))
+	if len(distance) < 2 || math.IsNaN(distance[0]) {
+		return times
+	}
+	for k, meters := range distances {
+		if meters <= 0 || distance[len(distance)-1]-distance[0] < meters {
+			continue
+		}
+		best := math.Inf(1)
+		start := 0
+		for end := 1; end < len(distance); end++ {
+			if distance[end]-distance[0] < meters {
+				continue
+			}
+			// start is the last second from which the effort still covers the distance.
+			for start+1 < end && distance[end]-distance[start+1] >= meters {
+				start++
+			}
+			offset := 0.0
+			if step := distance[start+1] - distance[start]; step > 0 {
+				offset = math.Min((distance[end]-meters-distance[start])/step, 1)
+			}
+			best = math.Min(best, float64(end-start)-offset)
+		}
+		times[k] = round(best, 0)
+	}
+	return times
+}
@@ -0,0 +1,124 @@
+// Package analytics computes training metrics from cached activity streams. Functions take
+// Strava-shaped streams and plain thresholds and do no I/O.
+package analytics
+
+import (
+	"math"
+	"stravamcp/model"
+)
+
+// MaxGap is the longest gap between samples, in seconds, that is treated as continuous
+// recording. Longer gaps are pauses (auto-pause, stops) and are left out of 1 Hz series.
+const MaxGap = 10
+
+// PerSecond resamples a stream to one value per recorded second, holding each sample until the
+// next one. Gaps longer than MaxGap are dropped, so the result covers moving time only. Missing
+// samples are NaN.
+func PerSecond(timeStream, values *model.StreamData) []float64 {
+	if timeStream == nil || values == nil {
+		return nil
+	}
+	n := min(len(timeStream.Data), len(values.Data))
+	var series []float64
+	for i := 0; i < n; i++ {
+		if timeStream.Data[i] == nil {
+			continue
+		}
+		value := math.NaN()
+		if values.Data[i] != nil {
+			value = *values.Data[i]
+		}
+		for range sampleSteps(timeStream, i, n) {
+			series = append(series, value)
+		}
+	}
+	return series
+}
+
+// sampleSteps is how many seconds of the 1 Hz series sample i covers.
+func sampleSteps(timeStream *model.StreamData, i, n int) int {
+	next := nextTime(timeStream, i, n)
+	if next == nil {
+		return 1
+	}
+	gap := *next - *timeStream.Data[i]
+	switch {
+	case gap <= 0:
+		return 0
+	case gap <= MaxGap:
+		return int(math.Round(gap))
+	}
+	return 1
+}
+
+// secondOffsets maps every sample of a stream to the second of the PerSecond series it starts at,
+// so that sample indices such as lap boundaries can be located in 1 Hz series.
+func secondOffsets(timeStream *model.StreamData) []int {
+	if timeStream == nil {
+		return nil
+	}
+	n := len(timeStream.Data)
+	offsets := make([]int, n)
+	offset := 0
+	for i := 0; i < n; i++ {
+		offsets[i] = offset
+		if timeStream.Data[i] != nil {
+			offset += sampleSteps(timeStream, i, n)
+		}
+	}
+	return offsets
+}
+
+func nextTime(timeStream *model.StreamData, i, n int) *float64 {
+	for j := i + 1; j < n; j++ {
+		if timeStream.Data[j] != nil {
+			return timeStream.Data[j]
+		}
+	}
+	return nil
+}
+
+// Has reports whether a stream has at least one sample.
+func Has(stream *model.StreamData) bool {
+	if stream == nil {
+		return false
+	}
+	for _, v := range stream.Data {
+		if v != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// mean returns the average of the non-NaN values and how many there were.
+func mean(values []float64) (float64, int) {
+	var sum float64
+	var n int
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			sum += v
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return sum / float64(n), n
+}
+
+// zeroNaN replaces missing samples with zero, e.g. power dropouts while coasting.
+func zeroNaN(values []float64) []float64 {
+	out := make([]float64, len(values))
+	for i, v := range values {
+		if !math.IsNaN(v) {
+			out[i] = v
+		}
+	}
+	return out
+}
+
+func round(value float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(value*p) / p
+}
@@ -0,0 +1,263 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"stravamcp/model"
+	"strings"
+)
+
+// SplitUnit is the distance splits are taken over.
+type SplitUnit string
+
+const (
+	Kilometers SplitUnit = "km"
+	Miles      SplitUnit = "mi"
+)
+
+func ParseSplitUnit(value string) (SplitUnit, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "km", "kilometer", "kilometers", "kilometre", "kilometres":
+		return Kilometers, nil
+	case "mi", "mile", "miles":
+		return Miles, nil
+	default:
+		return "", fmt.Errorf("unsupported split unit %q (use km or mi)", value)
+	}
+}
+
+// Meters is the length of one split.
+func (u SplitUnit) Meters() float64 {
+	if u == Miles {
+		return 1609.344
+	}
+	return 1000
+}
+
+// Split types, comparing the second half of the distance to the first.
+const (
+	NegativeSplit = "negative"
+	PositiveSplit = "positive"
+	EvenSplit     = "even"
+	// evenSplitPercent is how far the halves may differ and still count as even.
+	evenSplitPercent = 1
+)
+
+// Split is one unit of distance. Paces are seconds per unit; the last split is usually shorter
+// and its pace is scaled to the full unit.
+type Split struct {
+	Split             int      `json:"split"`
+	Distance          float64  `json:"distance"`
+	Seconds           float64  `json:"seconds"`
+	Pace              float64  `json:"pace"`
+	GradeAdjustedPace *float64 `json:"grade_adjusted_pace,omitempty"`
+	AverageHeartrate  *float64 `json:"average_heartrate,omitempty"`
+	ElevationChange   *float64 `json:"elevation_change,omitempty"`
+	ElevationGain     *float64 `json:"elevation_gain,omitempty"`
+}
+
+// SplitAnalysis describes the splits of an activity. FirstHalf and SecondHalf are the moving
+// seconds over each half of the distance and Difference the second half relative to the first, in
+// percent. Fastest and Slowest are split numbers among the full splits.
+type SplitAnalysis struct {
+	Unit              SplitUnit `json:"unit"`
+	Distance          float64   `json:"distance"`
+	Seconds           float64   `json:"seconds"`
+	Pace              float64   `json:"pace"`
+	GradeAdjustedPace *float64  `json:"grade_adjusted_pace,omitempty"`
+	Splits            []Split   `json:"splits"`
+	FirstHalf         float64   `json:"first_half"`
+	SecondHalf        float64   `json:"second_half"`
+	Difference        float64   `json:"difference"`
+	Type              string    `json:"type"`
+	Fastest           int       `json:"fastest,omitempty"`
+	Slowest           int       `json:"slowest,omitempty"`
+}
+
+// ComputeSplits splits the moving time of an activity at every unit of distance, interpolating
+// the second each boundary was crossed. Grade-adjusted pace, the equivalent pace on flat ground,
+// scales distance by Minetti's energy cost of running at the grade_smooth stream, or at the grade
+// derived from altitude. It reports false without a distance stream.
+func ComputeSplits(streams *model.ActivityStreams, unit SplitUnit) (SplitAnalysis, bool) {
+	if streams == nil {
+		return SplitAnalysis{}, false
+	}
+	distance := carryForward(PerSecond(streams.Time, streams.Distance))
+	if len(distance) < 2 || math.IsNaN(distance[0]) || distance[len(distance)-1]-distance[0] <= 0 {
+		return SplitAnalysis{}, false
+	}
+	start := distance[0]
+	for i := range distance {
+		distance[i] -= start
+	}
+	hr := PerSecond(streams.Time, streams.Heartrate)
+	altitude := carryForward(PerSecond(streams.Time, streams.Altitude))
+	grade := gradeSeries(PerSecond(streams.Time, streams.GradeSmooth), altitude, distance)
+
+	total := distance[len(distance)-1]
+	seconds := float64(len(distance) - 1)
+	result := SplitAnalysis{Unit: unit, Distance: round(total, 0), Seconds: seconds, Splits: []Split{}}
+	result.Pace = round(seconds/total*unit.Meters(), 0)
+	if grade != nil {
+		result.GradeAdjustedPace = gradeAdjust(result.Pace, distance, grade, 0, len(distance)-1)
+	}
+
+	previous := 0.0
+	for n := 1; previous < seconds; n++ {
+		crossing := crossingTime(distance, float64(n)*unit.Meters())
+		from, to := int(math.Floor(previous)), int(math.Ceil(crossing))
+		split := Split{
+			Split:    n,
+			Distance: round(math.Min(float64(n)*unit.Meters(), total)-float64(n-1)*unit.Meters(), 0),
+			Seconds:  round(crossing-previous, 0),
+		}
+		if split.Distance <= 0 {
+			break
+		}
+		split.Pace = round((crossing-previous)/split.Distance*unit.Meters(), 0)
+		if grade != nil {
+			split.GradeAdjustedPace = gradeAdjust(split.Pace, distance, grade, from, to)
+		}
+		if avg, count := mean(sliceRange(hr, from, to)); count > 0 {
+			avg = round(avg, 0)
+			split.AverageHeartrate = &avg
+		}
+		split.ElevationChange, split.ElevationGain = elevation(altitude, from, to)
+		result.Splits = append(result.Splits, split)
+		previous = crossing
+	}
+
+	half := crossingTime(distance, total/2)
+	result.FirstHalf = round(half, 0)
+	result.SecondHalf = round(seconds-half, 0)
+	if half > 0 {
+		result.Difference = round((seconds-2*half)/half*100, 1)
+	}
+	switch {
+	case result.Difference < -evenSplitPercent:
+		result.Type = NegativeSplit
+	case result.Difference > evenSplitPercent:
+		result.Type = PositiveSplit
+	default:
+		result.Type = EvenSplit
+	}
+	for _, split := range result.Splits {
+		if split.Distance < unit.Meters()*0.99 {
+			continue
+		}
+		if result.Fastest == 0 || split.Pace < result.Splits[result.Fastest-1].Pace {
+			result.Fastest = split.Split
+		}
+		if result.Slowest == 0 || split.Pace > result.Splits[result.Slowest-1].Pace {
+			result.Slowest = split.Split
+		}
+	}
+	return result, true
+}
+
+// crossingTime is the interpolated second at which a cumulative distance series reaches target,
+// or its last second when it never does.
+func crossingTime(distance []float64, target float64) float64 {
+	for i := 1; i < len(distance); i++ {
+		if distance[i] >= target {
+			step := distance[i] - distance[i-1]
+			if step <= 0 {
+				return float64(i)
+			}
+			return float64(i-1) + (target-distance[i-1])/step
+		}
+	}
+	return float64(len(distance) - 1)
+}
+
+// runningCost is Minetti's energy cost of running, in J/kg/m, at a grade given as a fraction.
+// The fit holds for grades between -45% and 45%.
+func runningCost(grade float64) float64 {
+	i := math.Max(-0.45, math.Min(0.45, grade))
+	return 155.4*math.Pow(i, 5) - 30.4*math.Pow(i, 4) - 43.3*math.Pow(i, 3) + 46.3*i*i + 19.5*i + 3.6
+}
+
+// gradeAdjust converts a pace to flat ground over the seconds from..to, weighting every second's
+// distance by the energy cost of its grade.
+func gradeAdjust(pace float64, distance, grade []float64, from, to int) *float64 {
+	var covered, flat float64
+	for i := max(from, 1); i <= min(to, len(distance)-1); i++ {
+		step := distance[i] - distance[i-1]
+		covered += step
+		flat += step * runningCost(grade[i]) / runningCost(0)
+	}
+	if covered <= 0 || flat <= 0 {
+		return nil
+	}
+	adjusted := round(pace*covered/flat, 0)
+	return &adjusted
+}
+
+// gradeSeries is the grade as a fraction per second, from Strava's grade_smooth stream or, when
+// it is missing, from the altitude change over 10 seconds either side. It is nil without either.
+func gradeSeries(smooth, altitude, distance []float64) []float64 {
+	grade := make([]float64, len(distance))
+	switch {
+	case len(smooth) >= len(distance):
+		for i := range grade {
+			if !math.IsNaN(smooth[i]) {
+				grade[i] = smooth[i] / 100
+			}
+		}
+	case len(altitude) >= len(distance):
+		const window = 10
+		for i := range grade {
+			from, to := max(i-window, 0), min(i+window, len(distance)-1)
+			run := distance[to] - distance[from]
+			rise := altitude[to] - altitude[from]
+			if run >= 5 && !math.IsNaN(rise) {
+				grade[i] = rise / run
+			}
+		}
+	default:
+		return nil
+	}
+	return grade
+}
+
+// elevation returns the net change and the gain of altitude over the seconds from..to.
+func elevation(altitude []float64, from, to int) (*float64, *float64) {
+	to = min(to, len(altitude)-1)
+	if from >= to || math.IsNaN(altitude[from]) || math.IsNaN(altitude[to]) {
+		return nil, nil
+	}
+	var gain float64
+	for i := from + 1; i <= to; i++ {
+		if d := altitude[i] - altitude[i-1]; d > 0 {
+			gain += d
+		}
+	}
+	change, gain := round(altitude[to]-altitude[from], 0), round(gain, 0)
+	return &change, &gain
+}
+
+// carryForward fills missing samples with the last known value, and leading ones with the first.
+func carryForward(values []float64) []float64 {
+	out := make([]float64, len(values))
+	last := math.NaN()
+	for _, v := range values {
+		if !math.IsNaN(v) {
+			last = v
+			break
+		}
+	}
+	for i, v := range values {
+		if !math.IsNaN(v) {
+			last = v
+		}
+		out[i] = last
+	}
+	return out
+}
+
+func sliceRange(values []float64, from, to int) []float64 {
+	if from >= len(values) {
+		return nil
+	}
+	return values[from:min(to, len(values))]
+}
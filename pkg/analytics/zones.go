@@ -0,0 +1,129 @@
+package analytics
+
+import (
+	"math"
+	"stravamcp/model"
+)
+
+// Zone is a heart rate range. Max is zero for the open-ended top zone.
+type Zone struct {
+	Name string  `json:"name"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max,omitempty"`
+}
+
+// ZonesFromStrava converts the athlete's Strava zones.
+func ZonesFromStrava(ranges *model.ZoneRanges) []Zone {
+	if ranges == nil {
+		return nil
+	}
+	zones := make([]Zone, len(ranges.Zones))
+	for i, r := range ranges.Zones {
+		zones[i] = Zone{Name: zoneName(i), Min: float64(r.Min), Max: float64(max(r.Max, 0))}
+	}
+	return zones
+}
+
+// ZonesFromLTHR builds Friel's five heart rate zones from the lactate threshold heart rate,
+// with zone 4 starting just below threshold.
+func ZonesFromLTHR(lthr float64) []Zone {
+	return zonesFromBounds([]float64{0.85 * lthr, 0.90 * lthr, 0.95 * lthr, lthr})
+}
+
+// ZonesFromMaxHR builds five zones split at 70, 80, 87 and 93% of max heart rate, so that zone 3
+// roughly spans the range between the aerobic and the lactate threshold.
+func ZonesFromMaxHR(maxHR float64) []Zone {
+	return zonesFromBounds([]float64{0.70 * maxHR, 0.80 * maxHR, 0.87 * maxHR, 0.93 * maxHR})
+}
+
+func zonesFromBounds(bounds []float64) []Zone {
+	zones := make([]Zone, len(bounds)+1)
+	low := 0.0
+	for i := range zones {
+		high := 0.0
+		if i < len(bounds) {
+			high = math.Round(bounds[i])
+		}
+		zones[i] = Zone{Name: zoneName(i), Min: low, Max: high}
+		low = high
+	}
+	return zones
+}
+
+func zoneName(i int) string {
+	return "Z" + string(rune('1'+i))
+}
+
+// TimeInZones returns the seconds spent in each zone from 1 Hz heart rate.
+func TimeInZones(hr []float64, zones []Zone) []float64 {
+	seconds := make([]float64, len(zones))
+	for _, value := range hr {
+		if math.IsNaN(value) || value <= 0 {
+			continue
+		}
+		for i := len(zones) - 1; i >= 0; i-- {
+			if value >= zones[i].Min {
+				seconds[i]++
+				break
+			}
+		}
+	}
+	return seconds
+}
+
+// Intensity distributions.
+const (
+	Polarized     = "polarized"
+	Pyramidal     = "pyramidal"
+	Threshold     = "threshold"
+	HighIntensity = "high-intensity"
+)
+
+// IntensityDistribution folds five zones into the three-zone model used in endurance research:
+// low (Z1-Z2, below the first threshold), moderate (Z3, the "grey zone" between the thresholds)
+// and high (Z4-Z5, at or above threshold).
+type IntensityDistribution struct {
+	Low      float64 `json:"low"`
+	Moderate float64 `json:"moderate"`
+	High     float64 `json:"high"`
+	// PolarizationIndex is Treff's log10(low/moderate × high × 100) over fractions; above 2.0 the
+	// distribution is polarized. It is omitted unless there is time at all three intensities.
+	PolarizationIndex *float64 `json:"polarization_index,omitempty"`
+	Type              string   `json:"type"`
+}
+
+// Distribute classifies seconds per zone. Zones beyond the fifth count as high.
+func Distribute(seconds []float64) IntensityDistribution {
+	var low, moderate, high, total float64
+	for i, s := range seconds {
+		switch {
+		case i < 2:
+			low += s
+		case i == 2:
+			moderate += s
+		default:
+			high += s
+		}
+		total += s
+	}
+	if total == 0 {
+		return IntensityDistribution{}
+	}
+	d := IntensityDistribution{Low: round(low/total, 3), Moderate: round(moderate/total, 3), High: round(high/total, 3)}
+	// Computed from the unrounded fractions: a share that rounds to zero would make it infinite.
+	if low > 0 && moderate > 0 && high > 0 {
+		pi := round(math.Log10(low/moderate*(high/total)*100), 2)
+		d.PolarizationIndex = &pi
+	}
+	switch {
+	case d.Moderate >= d.Low && d.Moderate >= d.High:
+		d.Type = Threshold
+	case d.High >= d.Low:
+		d.Type = HighIntensity
+	case d.High > d.Moderate:
+		d.Type = Polarized
+	default:
+		d.Type = Pyramidal
+	}
+	return d
+}
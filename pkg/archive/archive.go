@@ -0,0 +1,316 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/parquet-go/parquet-go"
+	"io"
+	"slices"
+	"stravamcp/model"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatJSONL   Format = "jsonl"
+	FormatCSV     Format = "csv"
+	FormatParquet Format = "parquet"
+)
+
+func ParseFormat(value string) (Format, error) {
+	switch strings.ToLower(value) {
+	case "", "jsonl", "ndjson":
+		return FormatJSONL, nil
+	case "csv":
+		return FormatCSV, nil
+	case "parquet":
+		return FormatParquet, nil
+	default:
+		return "", fmt.Errorf("unsupported format %q (use jsonl, csv or parquet)", value)
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+type Dataset string
+
+const (
+	DatasetActivities Dataset = "activities"
+	DatasetStreams    Dataset = "streams"
+)
+
+func ParseDataset(value string) (Dataset, error) {
+	switch Dataset(strings.ToLower(value)) {
+	case DatasetActivities:
+		return DatasetActivities, nil
+	case DatasetStreams:
+		return DatasetStreams, nil
+	default:
+		return "", fmt.Errorf("unsupported dataset %q (use activities or streams)", value)
+	}
+}
+
+// ActivityWriter writes activities in the requested format. JSON Lines keeps the full cached
+// activity so it can be restored losslessly; CSV and Parquet use the flat ActivityRow columns.
+type ActivityWriter struct {
+	json  *json.Encoder
+	table *table[ActivityRow]
+}
+
+func NewActivityWriter(w io.Writer, format Format) (*ActivityWriter, error) {
+	if format == FormatJSONL {
+		return &ActivityWriter{json: json.NewEncoder(w)}, nil
+	}
+	t, err := newTable(w, format, activityHeader, ActivityRow.record)
+	if err != nil {
+		return nil, err
+	}
+	return &ActivityWriter{table: t}, nil
+}
+
+func (a *ActivityWriter) Write(activity *model.AthleteActivity) error {
+	if a.json != nil {
+		return a.json.Encode(activity)
+	}
+	return a.table.write(NewActivityRow(activity))
+}
+
+func (a *ActivityWriter) Close() error {
+	if a.table != nil {
+		return a.table.close()
+	}
+	return nil
+}
+
+// StreamWriter writes streams as a long-format table with one row per activity sample.
+type StreamWriter struct {
+	table *table[StreamRow]
+}
+
+func NewStreamWriter(w io.Writer, format Format) (*StreamWriter, error) {
+	t, err := newTable(w, format, streamHeader, StreamRow.record)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamWriter{table: t}, nil
+}
+
+func (s *StreamWriter) Write(activityID int64, streams *model.ActivityStreams) error {
+	return s.table.write(NewStreamRows(activityID, streams)...)
+}
+
+func (s *StreamWriter) Close() error {
+	return s.table.close()
+}
+
+// ReadActivities decodes activities written by ActivityWriter and calls fn for each one.
+func ReadActivities(r io.Reader, format Format, fn func(activity *model.AthleteActivity) error) error {
+	if format == FormatJSONL {
+		return readJSONLines(r, func(line []byte) error {
+			var activity model.AthleteActivity
+			if err := json.Unmarshal(line, &activity); err != nil {
+				return fmt.Errorf("failed to decode activity: %w", err)
+			}
+			return fn(&activity)
+		})
+	}
+	return readRows(r, format, parseActivityRecord, func(row ActivityRow) error {
+		return fn(row.Activity())
+	})
+}
+
+// ReadStreams decodes long-format stream rows and calls fn once per activity. Rows of one
+// activity must be contiguous, as StreamWriter produces them.
+func ReadStreams(r io.Reader, format Format, fn func(activityID int64, streams *model.ActivityStreams) error) error {
+	var pending []StreamRow
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		slices.SortFunc(pending, func(a, b StreamRow) int {
+			return cmp.Compare(a.Sample, b.Sample)
+		})
+		err := fn(pending[0].ActivityID, StreamsFromRows(pending))
+		pending = pending[:0]
+		return err
+	}
+	err := readRows(r, format, parseStreamRecord, func(row StreamRow) error {
+		if len(pending) > 0 && pending[0].ActivityID != row.ActivityID {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		pending = append(pending, row)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+type table[T any] struct {
+	json    *json.Encoder
+	csv     *csv.Writer
+	parquet *parquet.GenericWriter[T]
+	record  func(T) []string
+}
+
+func newTable[T any](w io.Writer, format Format, header []string, record func(T) []string) (*table[T], error) {
+	switch format {
+	case FormatJSONL:
+		return &table[T]{json: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		csvWriter := csv.NewWriter(w)
+		if err := csvWriter.Write(header); err != nil {
+			return nil, err
+		}
+		return &table[T]{csv: csvWriter, record: record}, nil
+	case FormatParquet:
+		return &table[T]{parquet: parquet.NewGenericWriter[T](w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func (t *table[T]) write(rows ...T) error {
+	switch {
+	case t.json != nil:
+		for _, row := range rows {
+			if err := t.json.Encode(row); err != nil {
+				return err
+			}
+		}
+	case t.csv != nil:
+		for _, row := range rows {
+			if err := t.csv.Write(t.record(row)); err != nil {
+				return err
+			}
+		}
+	default:
+		if _, err := t.parquet.Write(rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *table[T]) close() error {
+	switch {
+	case t.csv != nil:
+		t.csv.Flush()
+		return t.csv.Error()
+	case t.parquet != nil:
+		return t.parquet.Close()
+	}
+	return nil
+}
+
+func readRows[T any](r io.Reader, format Format, parse func(map[string]string) (T, error), fn func(T) error) error {
+	switch format {
+	case FormatJSONL:
+		return readJSONLines(r, func(line []byte) error {
+			var row T
+			if err := json.Unmarshal(line, &row); err != nil {
+				return fmt.Errorf("failed to decode row: %w", err)
+			}
+			return fn(row)
+		})
+	case FormatCSV:
+		return readCSV(r, parse, fn)
+	case FormatParquet:
+		return readParquet(r, fn)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func readJSONLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func readCSV[T any](r io.Reader, parse func(map[string]string) (T, error), fn func(T) error) error {
+	csvReader := csv.NewReader(r)
+	header, err := csvReader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	line := 1
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line++
+		fields := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(record) {
+				fields[name] = record[i]
+			}
+		}
+		row, err := parse(fields)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+func readParquet[T any](r io.Reader, fn func(T) error) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	reader := parquet.NewGenericReader[T](bytes.NewReader(data))
+	//nolint: errcheck // reader only holds in-memory buffers
+	defer reader.Close()
+
+	for {
+		// The reader decodes optional values into storage owned by the rows it is given, so every
+		// batch gets fresh rows: callers such as ReadStreams keep them beyond the next Read.
+		rows := make([]T, 256)
+		n, err := reader.Read(rows)
+		for _, row := range rows[:n] {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read parquet: %w", err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"bytes"
+	"reflect"
+	"stravamcp/model"
+	"testing"
+)
+
+func testStreams(samples int, offset float64) *model.ActivityStreams {
+	column := func(scale float64) *model.StreamData {
+		data := make([]*float64, samples)
+		for i := range data {
+			v := offset + scale*float64(i)
+			data[i] = &v
+		}
+		return &model.StreamData{Data: data, OriginalSize: int32(samples), SeriesType: "time"}
+	}
+	latlng := make([][]float64, samples)
+	for i := range latlng {
+		latlng[i] = []float64{offset + 0.001*float64(i), -offset - 0.001*float64(i)}
+	}
+	return &model.ActivityStreams{
+		Time:      column(1),
+		Distance:  column(3.5),
+		Heartrate: column(0.25),
+		Watts:     column(2),
+		LatLng:    &model.LatLngStreamData{Data: latlng, OriginalSize: int32(samples), SeriesType: "time"},
+	}
+}
+
+func TestStreamsRoundTrip(t *testing.T) {
+	// More samples than one parquet read batch, so rows of one activity span several reads.
+	want := map[int64]*model.ActivityStreams{
+		1: testStreams(600, 10),
+		2: testStreams(300, 20),
+		3: testStreams(5, 30),
+	}
+	for _, format := range []Format{FormatCSV, FormatParquet} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewStreamWriter(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []int64{1, 2, 3} {
+				if err := w.Write(id, want[id]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[int64]*model.ActivityStreams{}
+			err = ReadStreams(&buf, format, func(activityID int64, streams *model.ActivityStreams) error {
+				got[activityID] = streams
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("read %d activities, want %d", len(got), len(want))
+			}
+			for id, streams := range want {
+				if !reflect.DeepEqual(got[id], streams) {
+					t.Errorf("activity %d: streams differ after round trip", id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package archive
+
+import (
+	"fmt"
+	"stravamcp/model"
+	"strconv"
+)
+
+// ActivityRow is the flat, one-row-per-activity shape used for CSV and Parquet exports.
+type ActivityRow struct {
+	ID                   int64    `json:"id" parquet:"id"`
+	Name                 string   `json:"name" parquet:"name"`
+	Type                 string   `json:"type" parquet:"type"`
+	SportType            string   `json:"sport_type" parquet:"sport_type"`
+	StartDate            string   `json:"start_date" parquet:"start_date"`
+	StartDateLocal       string   `json:"start_date_local" parquet:"start_date_local"`
+	Timezone             string   `json:"timezone" parquet:"timezone"`
+	Distance             float64  `json:"distance" parquet:"distance"`
+	MovingTime           int64    `json:"moving_time" parquet:"moving_time"`
+	ElapsedTime          int64    `json:"elapsed_time" parquet:"elapsed_time"`
+	TotalElevationGain   float64  `json:"total_elevation_gain" parquet:"total_elevation_gain"`
+	AverageSpeed         float64  `json:"average_speed" parquet:"average_speed"`
+	MaxSpeed             float64  `json:"max_speed" parquet:"max_speed"`
+	AverageHeartrate     *float64 `json:"average_heartrate" parquet:"average_heartrate,optional"`
+	MaxHeartrate         *float64 `json:"max_heartrate" parquet:"max_heartrate,optional"`
+	AverageCadence       *float64 `json:"average_cadence" parquet:"average_cadence,optional"`
+	AverageWatts         *float64 `json:"average_watts" parquet:"average_watts,optional"`
+	WeightedAverageWatts *int64   `json:"weighted_average_watts" parquet:"weighted_average_watts,optional"`
+	MaxWatts             *int64   `json:"max_watts" parquet:"max_watts,optional"`
+	Kilojoules           *float64 `json:"kilojoules" parquet:"kilojoules,optional"`
+	SufferScore          *float64 `json:"suffer_score" parquet:"suffer_score,optional"`
+	Trainer              bool     `json:"trainer" parquet:"trainer"`
+	Commute              bool     `json:"commute" parquet:"commute"`
+	Manual               bool     `json:"manual" parquet:"manual"`
+	Private              bool     `json:"private" parquet:"private"`
+	Visibility           string   `json:"visibility" parquet:"visibility"`
+	GearID               *string  `json:"gear_id" parquet:"gear_id,optional"`
+	StartLat             *float64 `json:"start_lat" parquet:"start_lat,optional"`
+	StartLng             *float64 `json:"start_lng" parquet:"start_lng,optional"`
+	EndLat               *float64 `json:"end_lat" parquet:"end_lat,optional"`
+	EndLng               *float64 `json:"end_lng" parquet:"end_lng,optional"`
+	SummaryPolyline      string   `json:"summary_polyline" parquet:"summary_polyline"`
+}
+
+var activityHeader = []string{
+	"id", "name", "type", "sport_type", "start_date", "start_date_local", "timezone",
+	"distance", "moving_time", "elapsed_time", "total_elevation_gain", "average_speed", "max_speed",
+	"average_heartrate", "max_heartrate", "average_cadence", "average_watts", "weighted_average_watts",
+	"max_watts", "kilojoules", "suffer_score", "trainer", "commute", "manual", "private", "visibility",
+	"gear_id", "start_lat", "start_lng", "end_lat", "end_lng", "summary_polyline",
+}
+
+func NewActivityRow(activity *model.AthleteActivity) ActivityRow {
+	row := ActivityRow{
+		ID:                   activity.ID,
+		Name:                 activity.Name,
+		Type:                 activity.Type,
+		SportType:            activity.SportType,
+		StartDate:            activity.StartDate,
+		StartDateLocal:       activity.StartDateLocal,
+		Timezone:             activity.Timezone,
+		Distance:             activity.Distance,
+		MovingTime:           int64(activity.MovingTime),
+		ElapsedTime:          int64(activity.ElapsedTime),
+		TotalElevationGain:   activity.TotalElevationGain,
+		AverageSpeed:         activity.AverageSpeed,
+		MaxSpeed:             activity.MaxSpeed,
+		AverageHeartrate:     activity.AverageHeartrate,
+		MaxHeartrate:         activity.MaxHeartrate,
+		AverageCadence:       activity.AverageCadence,
+		AverageWatts:         activity.AverageWatts,
+		WeightedAverageWatts: intToInt64(activity.WeightedAverageWatts),
+		MaxWatts:             intToInt64(activity.MaxWatts),
+		Kilojoules:           activity.Kilojoules,
+		SufferScore:          activity.SufferScore,
+		Trainer:              activity.Trainer,
+		Commute:              activity.Commute,
+		Manual:               activity.Manual,
+		Private:              activity.Private,
+		Visibility:           activity.Visibility,
+		GearID:               activity.GearID,
+		SummaryPolyline:      activity.Map.SummaryPolyline,
+	}
+	if len(activity.StartLatLng) >= 2 {
+		row.StartLat, row.StartLng = &activity.StartLatLng[0], &activity.StartLatLng[1]
+	}
+	if len(activity.EndLatLng) >= 2 {
+		row.EndLat, row.EndLng = &activity.EndLatLng[0], &activity.EndLatLng[1]
+	}
+	return row
+}
+
+// Activity converts the row back into a cached activity. Fields that are not part of the
+// flat export (kudos, photos, device details) are left empty.
+func (r ActivityRow) Activity() *model.AthleteActivity {
+	activity := &model.AthleteActivity{
+		ID:                   r.ID,
+		Name:                 r.Name,
+		Type:                 r.Type,
+		SportType:            r.SportType,
+		StartDate:            r.StartDate,
+		StartDateLocal:       r.StartDateLocal,
+		Timezone:             r.Timezone,
+		Distance:             r.Distance,
+		MovingTime:           int(r.MovingTime),
+		ElapsedTime:          int(r.ElapsedTime),
+		TotalElevationGain:   r.TotalElevationGain,
+		AverageSpeed:         r.AverageSpeed,
+		MaxSpeed:             r.MaxSpeed,
+		AverageHeartrate:     r.AverageHeartrate,
+		MaxHeartrate:         r.MaxHeartrate,
+		HasHeartrate:         r.AverageHeartrate != nil,
+		AverageCadence:       r.AverageCadence,
+		AverageWatts:         r.AverageWatts,
+		WeightedAverageWatts: int64ToInt(r.WeightedAverageWatts),
+		MaxWatts:             int64ToInt(r.MaxWatts),
+		Kilojoules:           r.Kilojoules,
+		SufferScore:          r.SufferScore,
+		Trainer:              r.Trainer,
+		Commute:              r.Commute,
+		Manual:               r.Manual,
+		Private:              r.Private,
+		Visibility:           r.Visibility,
+		GearID:               r.GearID,
+		Map:                  model.Map{SummaryPolyline: r.SummaryPolyline},
+	}
+	if r.StartLat != nil && r.StartLng != nil {
+		activity.StartLatLng = []float64{*r.StartLat, *r.StartLng}
+	}
+	if r.EndLat != nil && r.EndLng != nil {
+		activity.EndLatLng = []float64{*r.EndLat, *r.EndLng}
+	}
+	return activity
+}
+
+func (r ActivityRow) record() []string {
+	return []string{
+		strconv.FormatInt(r.ID, 10), r.Name, r.Type, r.SportType, r.StartDate, r.StartDateLocal, r.Timezone,
+		formatFloat(r.Distance), strconv.FormatInt(r.MovingTime, 10), strconv.FormatInt(r.ElapsedTime, 10),
+		formatFloat(r.TotalElevationGain), formatFloat(r.AverageSpeed), formatFloat(r.MaxSpeed),
+		formatFloatPtr(r.AverageHeartrate), formatFloatPtr(r.MaxHeartrate), formatFloatPtr(r.AverageCadence),
+		formatFloatPtr(r.AverageWatts), formatIntPtr(r.WeightedAverageWatts), formatIntPtr(r.MaxWatts),
+		formatFloatPtr(r.Kilojoules), formatFloatPtr(r.SufferScore), strconv.FormatBool(r.Trainer),
+		strconv.FormatBool(r.Commute), strconv.FormatBool(r.Manual), strconv.FormatBool(r.Private), r.Visibility,
+		formatStringPtr(r.GearID), formatFloatPtr(r.StartLat), formatFloatPtr(r.StartLng),
+		formatFloatPtr(r.EndLat), formatFloatPtr(r.EndLng), r.SummaryPolyline,
+	}
+}
+
+func parseActivityRecord(fields map[string]string) (ActivityRow, error) {
+	var row ActivityRow
+	var p fieldParser
+	row.ID = p.int64("id", fields["id"])
+	row.Name = fields["name"]
+	row.Type = fields["type"]
+	row.SportType = fields["sport_type"]
+	row.StartDate = fields["start_date"]
+	row.StartDateLocal = fields["start_date_local"]
+	row.Timezone = fields["timezone"]
+	row.Distance = p.float("distance", fields["distance"])
+	row.MovingTime = p.int64("moving_time", fields["moving_time"])
+	row.ElapsedTime = p.int64("elapsed_time", fields["elapsed_time"])
+	row.TotalElevationGain = p.float("total_elevation_gain", fields["total_elevation_gain"])
+	row.AverageSpeed = p.float("average_speed", fields["average_speed"])
+	row.MaxSpeed = p.float("max_speed", fields["max_speed"])
+	row.AverageHeartrate = p.floatPtr("average_heartrate", fields["average_heartrate"])
+	row.MaxHeartrate = p.floatPtr("max_heartrate", fields["max_heartrate"])
+	row.AverageCadence = p.floatPtr("average_cadence", fields["average_cadence"])
+	row.AverageWatts = p.floatPtr("average_watts", fields["average_watts"])
+	row.WeightedAverageWatts = p.int64Ptr("weighted_average_watts", fields["weighted_average_watts"])
+	row.MaxWatts = p.int64Ptr("max_watts", fields["max_watts"])
+	row.Kilojoules = p.floatPtr("kilojoules", fields["kilojoules"])
+	row.SufferScore = p.floatPtr("suffer_score", fields["suffer_score"])
+	row.Trainer = p.bool("trainer", fields["trainer"])
+	row.Commute = p.bool("commute", fields["commute"])
+	row.Manual = p.bool("manual", fields["manual"])
+	row.Private = p.bool("private", fields["private"])
+	row.Visibility = fields["visibility"]
+	if gearID := fields["gear_id"]; gearID != "" {
+		row.GearID = &gearID
+	}
+	row.StartLat = p.floatPtr("start_lat", fields["start_lat"])
+	row.StartLng = p.floatPtr("start_lng", fields["start_lng"])
+	row.EndLat = p.floatPtr("end_lat", fields["end_lat"])
+	row.EndLng = p.floatPtr("end_lng", fields["end_lng"])
+	row.SummaryPolyline = fields["summary_polyline"]
+	return row, p.err
+}
+
+// StreamRow is one sample of an activity stream in long format: one row per activity and sample index.
+type StreamRow struct {
+	ActivityID     int64    `json:"activity_id" parquet:"activity_id"`
+	Sample         int64    `json:"sample" parquet:"sample"`
+	Time           *float64 `json:"time,omitempty" parquet:"time,optional"`
+	Distance       *float64 `json:"distance,omitempty" parquet:"distance,optional"`
+	Altitude       *float64 `json:"altitude,omitempty" parquet:"altitude,optional"`
+	VelocitySmooth *float64 `json:"velocity_smooth,omitempty" parquet:"velocity_smooth,optional"`
+	Heartrate      *float64 `json:"heartrate,omitempty" parquet:"heartrate,optional"`
+	Cadence        *float64 `json:"cadence,omitempty" parquet:"cadence,optional"`
+	Watts          *float64 `json:"watts,omitempty" parquet:"watts,optional"`
+	Temp           *float64 `json:"temp,omitempty" parquet:"temp,optional"`
+	GradeSmooth    *float64 `json:"grade_smooth,omitempty" parquet:"grade_smooth,optional"`
+	Lat            *float64 `json:"lat,omitempty" parquet:"lat,optional"`
+	Lng            *float64 `json:"lng,omitempty" parquet:"lng,optional"`
+}
+
+var streamHeader = []string{
+	"activity_id", "sample", "time", "distance", "altitude", "velocity_smooth", "heartrate",
+	"cadence", "watts", "temp", "grade_smooth", "lat", "lng",
+}
+
+// NewStreamRows flattens an activity's streams into one row per sample.
+func NewStreamRows(activityID int64, streams *model.ActivityStreams) []StreamRow {
+	samples := streamLength(streams)
+	rows := make([]StreamRow, samples)
+	for i := range rows {
+		rows[i] = StreamRow{
+			ActivityID:     activityID,
+			Sample:         int64(i),
+			Time:           sampleAt(streams.Time, i),
+			Distance:       sampleAt(streams.Distance, i),
+			Altitude:       sampleAt(streams.Altitude, i),
+			VelocitySmooth: sampleAt(streams.VelocitySmooth, i),
+			Heartrate:      sampleAt(streams.Heartrate, i),
+			Cadence:        sampleAt(streams.Cadence, i),
+			Watts:          sampleAt(streams.Watts, i),
+			Temp:           sampleAt(streams.Temp, i),
+			GradeSmooth:    sampleAt(streams.GradeSmooth, i),
+		}
+		if streams.LatLng != nil && i < len(streams.LatLng.Data) && len(streams.LatLng.Data[i]) >= 2 {
+			rows[i].Lat = &streams.LatLng.Data[i][0]
+			rows[i].Lng = &streams.LatLng.Data[i][1]
+		}
+	}
+	return rows
+}
+
+// StreamsFromRows rebuilds activity streams from the rows of a single activity, ordered by sample.
+func StreamsFromRows(rows []StreamRow) *model.ActivityStreams {
+	streams := &model.ActivityStreams{}
+	columns := []struct {
+		target **model.StreamData
+		value  func(StreamRow) *float64
+	}{
+		{&streams.Time, func(r StreamRow) *float64 { return r.Time }},
+		{&streams.Distance, func(r StreamRow) *float64 { return r.Distance }},
+		{&streams.Altitude, func(r StreamRow) *float64 { return r.Altitude }},
+		{&streams.VelocitySmooth, func(r StreamRow) *float64 { return r.VelocitySmooth }},
+		{&streams.Heartrate, func(r StreamRow) *float64 { return r.Heartrate }},
+		{&streams.Cadence, func(r StreamRow) *float64 { return r.Cadence }},
+		{&streams.Watts, func(r StreamRow) *float64 { return r.Watts }},
+		{&streams.Temp, func(r StreamRow) *float64 { return r.Temp }},
+		{&streams.GradeSmooth, func(r StreamRow) *float64 { return r.GradeSmooth }},
+	}
+	for _, column := range columns {
+		data := make([]*float64, len(rows))
+		present := false
+		for i, row := range rows {
+			data[i] = column.value(row)
+			present = present || data[i] != nil
+		}
+		if present {
+			*column.target = &model.StreamData{Data: data, OriginalSize: int32(len(rows)), SeriesType: "time"}
+		}
+	}
+
+	latlng := make([][]float64, len(rows))
+	present := false
+	for i, row := range rows {
+		if row.Lat != nil && row.Lng != nil {
+			latlng[i] = []float64{*row.Lat, *row.Lng}
+			present = true
+		}
+	}
+	if present {
+		streams.LatLng = &model.LatLngStreamData{Data: latlng, OriginalSize: int32(len(rows)), SeriesType: "time"}
+	}
+	return streams
+}
+
+func (r StreamRow) record() []string {
+	return []string{
+		strconv.FormatInt(r.ActivityID, 10), strconv.FormatInt(r.Sample, 10), formatFloatPtr(r.Time),
+		formatFloatPtr(r.Distance), formatFloatPtr(r.Altitude), formatFloatPtr(r.VelocitySmooth),
+		formatFloatPtr(r.Heartrate), formatFloatPtr(r.Cadence), formatFloatPtr(r.Watts),
+		formatFloatPtr(r.Temp), formatFloatPtr(r.GradeSmooth), formatFloatPtr(r.Lat), formatFloatPtr(r.Lng),
+	}
+}
+
+func parseStreamRecord(fields map[string]string) (StreamRow, error) {
+	var p fieldParser
+	row := StreamRow{
+		ActivityID:     p.int64("activity_id", fields["activity_id"]),
+		Sample:         p.int64("sample", fields["sample"]),
+		Time:           p.floatPtr("time", fields["time"]),
+		Distance:       p.floatPtr("distance", fields["distance"]),
+		Altitude:       p.floatPtr("altitude", fields["altitude"]),
+		VelocitySmooth: p.floatPtr("velocity_smooth", fields["velocity_smooth"]),
+		Heartrate:      p.floatPtr("heartrate", fields["heartrate"]),
+		Cadence:        p.floatPtr("cadence", fields["cadence"]),
+		Watts:          p.floatPtr("watts", fields["watts"]),
+		Temp:           p.floatPtr("temp", fields["temp"]),
+		GradeSmooth:    p.floatPtr("grade_smooth", fields["grade_smooth"]),
+		Lat:            p.floatPtr("lat", fields["lat"]),
+		Lng:            p.floatPtr("lng", fields["lng"]),
+	}
+	return row, p.err
+}
+
+func streamLength(streams *model.ActivityStreams) int {
+	length := 0
+	for _, stream := range []*model.StreamData{
+		streams.Time, streams.Distance, streams.Altitude, streams.VelocitySmooth, streams.Heartrate,
+		streams.Cadence, streams.Watts, streams.Temp, streams.GradeSmooth,
+	} {
+		if stream != nil {
+			length = max(length, len(stream.Data))
+		}
+	}
+	if streams.LatLng != nil {
+		length = max(length, len(streams.LatLng.Data))
+	}
+	return length
+}
+
+func sampleAt(stream *model.StreamData, i int) *float64 {
+	if stream == nil || i >= len(stream.Data) {
+		return nil
+	}
+	return stream.Data[i]
+}
+
+func intToInt64(v *int) *int64 {
+	if v == nil {
+		return nil
+	}
+	converted := int64(*v)
+	return &converted
+}
+
+func int64ToInt(v *int64) *int {
+	if v == nil {
+		return nil
+	}
+	converted := int(*v)
+	return &converted
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func formatFloatPtr(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatFloat(*v)
+}
+
+func formatIntPtr(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
+
+func formatStringPtr(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+// fieldParser converts CSV cells and remembers the first error so a record can be parsed in one pass.
+type fieldParser struct {
+	err error
+}
+
+func (p *fieldParser) fail(field, value string, err error) {
+	if p.err == nil {
+		p.err = fmt.Errorf("invalid %s %q: %w", field, value, err)
+	}
+}
+
+func (p *fieldParser) int64(field, value string) int64 {
+	if value == "" {
+		return 0
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		p.fail(field, value, err)
+	}
+	return v
+}
+
+func (p *fieldParser) int64Ptr(field, value string) *int64 {
+	if value == "" {
+		return nil
+	}
+	v := p.int64(field, value)
+	return &v
+}
+
+func (p *fieldParser) float(field, value string) float64 {
+	if value == "" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.fail(field, value, err)
+	}
+	return v
+}
+
+func (p *fieldParser) floatPtr(field, value string) *float64 {
+	if value == "" {
+		return nil
+	}
+	v := p.float(field, value)
+	return &v
+}
+
+func (p *fieldParser) bool(field, value string) bool {
+	if value == "" {
+		return false
+	}
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		p.fail(field, value, err)
+	}
+	return v
+}
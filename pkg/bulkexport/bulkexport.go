@@ -0,0 +1,243 @@
+package bulkexport
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"stravamcp/model"
+	"stravamcp/pkg/fit"
+	"stravamcp/pkg/trackfile"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const activitiesCSV = "activities.csv"
+
+// activityDateLayout is the UTC timestamp format used in the "Activity Date" column.
+const activityDateLayout = "Jan 2, 2006, 3:04:05 PM"
+
+var ErrUnsupportedFile = errors.New("unsupported activity file format")
+
+// Archive is the zip produced by Strava's "Download your data" page.
+type Archive struct {
+	reader *zip.ReadCloser
+	files  map[string]*zip.File
+}
+
+// Entry is one row of activities.csv together with the activity file it references, if any.
+type Entry struct {
+	Activity *model.AthleteActivity
+	FileName string
+}
+
+func Open(fileName string) (*Archive, error) {
+	reader, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	files := make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		files[strings.TrimPrefix(file.Name, "./")] = file
+	}
+	return &Archive{reader: reader, files: files}, nil
+}
+
+func (a *Archive) Close() error {
+	return a.reader.Close()
+}
+
+// Entries maps every row of activities.csv onto a cached activity summary.
+func (a *Archive) Entries() ([]Entry, error) {
+	file, ok := a.files[activitiesCSV]
+	if !ok {
+		return nil, fmt.Errorf("archive has no %s", activitiesCSV)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	//nolint: errcheck // defer is used to clean up
+	defer rc.Close()
+
+	reader := csv.NewReader(rc)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s header: %w", activitiesCSV, err)
+	}
+
+	var entries []Entry
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", activitiesCSV, line, err)
+		}
+		entry, err := parseEntry(newRow(header, record))
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", activitiesCSV, line, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Track decodes the activity file referenced by an entry, transparently handling gzip.
+func (a *Archive) Track(entry Entry) (*trackfile.Track, error) {
+	file, ok := a.files[entry.FileName]
+	if !ok {
+		return nil, fmt.Errorf("archive has no %s", entry.FileName)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	//nolint: errcheck // defer is used to clean up
+	defer rc.Close()
+
+	var r io.Reader = rc
+	name := strings.ToLower(entry.FileName)
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", entry.FileName, err)
+		}
+		//nolint: errcheck // defer is used to clean up
+		defer gz.Close()
+		r = gz
+		name = strings.TrimSuffix(name, ".gz")
+	}
+
+	switch path.Ext(name) {
+	case ".gpx":
+		return trackfile.ParseGPX(r)
+	case ".tcx":
+		return trackfile.ParseTCX(r)
+	case ".fit":
+		activity, err := fit.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		return activity.Track(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFile, entry.FileName)
+	}
+}
+
+// row gives access to a CSV record by column name. activities.csv repeats some headers
+// (Distance, Elapsed Time, Max Heart Rate, Commute); the later column holds the raw value in
+// SI units, so the last non-empty occurrence wins.
+type row struct {
+	columns map[string][]int
+	record  []string
+}
+
+func newRow(header, record []string) row {
+	columns := make(map[string][]int, len(header))
+	for i, name := range header {
+		columns[name] = append(columns[name], i)
+	}
+	return row{columns: columns, record: record}
+}
+
+func (r row) get(name string) string {
+	indexes := r.columns[name]
+	for i := len(indexes) - 1; i >= 0; i-- {
+		if idx := indexes[i]; idx < len(r.record) && strings.TrimSpace(r.record[idx]) != "" {
+			return strings.TrimSpace(r.record[idx])
+		}
+	}
+	return ""
+}
+
+func (r row) float(name string) *float64 {
+	v, err := strconv.ParseFloat(strings.ReplaceAll(r.get(name), ",", ""), 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+func (r row) floatOrZero(name string) float64 {
+	if v := r.float(name); v != nil {
+		return *v
+	}
+	return 0
+}
+
+func (r row) int(name string) *int {
+	v := r.float(name)
+	if v == nil {
+		return nil
+	}
+	rounded := int(*v + 0.5)
+	return &rounded
+}
+
+func (r row) bool(name string) bool {
+	v, _ := strconv.ParseBool(r.get(name))
+	return v
+}
+
+func parseEntry(r row) (Entry, error) {
+	id, err := strconv.ParseInt(r.get("Activity ID"), 10, 64)
+	if err != nil {
+		return Entry{}, fmt.Errorf("invalid Activity ID %q", r.get("Activity ID"))
+	}
+	startDate, err := time.Parse(activityDateLayout, r.get("Activity Date"))
+	if err != nil {
+		return Entry{}, fmt.Errorf("invalid Activity Date %q: %w", r.get("Activity Date"), err)
+	}
+
+	sportType := sportTypeFromDisplayName(r.get("Activity Type"))
+	activity := &model.AthleteActivity{
+		ID:                   id,
+		Name:                 r.get("Activity Name"),
+		Type:                 sportType,
+		SportType:            sportType,
+		StartDate:            startDate.UTC().Format(time.RFC3339),
+		Distance:             r.floatOrZero("Distance"),
+		ElapsedTime:          int(r.floatOrZero("Elapsed Time")),
+		MovingTime:           int(r.floatOrZero("Moving Time")),
+		TotalElevationGain:   r.floatOrZero("Elevation Gain"),
+		ElevHigh:             r.float("Elevation High"),
+		ElevLow:              r.float("Elevation Low"),
+		AverageSpeed:         r.floatOrZero("Average Speed"),
+		MaxSpeed:             r.floatOrZero("Max Speed"),
+		AverageCadence:       r.float("Average Cadence"),
+		AverageHeartrate:     r.float("Average Heart Rate"),
+		MaxHeartrate:         r.float("Max Heart Rate"),
+		AverageWatts:         r.float("Average Watts"),
+		MaxWatts:             r.int("Max Watts"),
+		WeightedAverageWatts: r.int("Weighted Average Power"),
+		AverageTemp:          r.int("Average Temperature"),
+		SufferScore:          r.float("Relative Effort"),
+		Commute:              r.bool("Commute"),
+		Manual:               r.get("Filename") == "",
+		ResourceState:        2,
+	}
+	if work := r.float("Total Work"); work != nil {
+		kilojoules := *work / 1000
+		activity.Kilojoules = &kilojoules
+	}
+	activity.HasHeartrate = activity.AverageHeartrate != nil
+	if activity.MovingTime == 0 {
+		activity.MovingTime = activity.ElapsedTime
+	}
+	if activity.AverageSpeed == 0 && activity.MovingTime > 0 {
+		activity.AverageSpeed = activity.Distance / float64(activity.MovingTime)
+	}
+	return Entry{Activity: activity, FileName: r.get("Filename")}, nil
+}
+
+// sportTypeFromDisplayName turns the display names used in the export ("Virtual Ride",
+// "E-Bike Ride", "Weight Training") into API sport types ("VirtualRide", "EBikeRide", "WeightTraining").
+func sportTypeFromDisplayName(name string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(name)
+}
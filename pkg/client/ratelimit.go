@@ -0,0 +1,111 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("strava rate limit exceeded")
+
+// RateLimit is the usage Strava reported on the most recent response. Strava counts requests per
+// 15 minute window (reset at :00, :15, :30 and :45) and per day (reset at midnight UTC).
+type RateLimit struct {
+	ShortLimit int       `json:"short_limit"`
+	ShortUsage int       `json:"short_usage"`
+	DailyLimit int       `json:"daily_limit"`
+	DailyUsage int       `json:"daily_usage"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Known reports whether any response carried rate-limit headers yet.
+func (r RateLimit) Known() bool {
+	return !r.UpdatedAt.IsZero()
+}
+
+// Remaining is the number of requests left before either window is exhausted. Usage reported
+// in an earlier window no longer counts.
+func (r RateLimit) Remaining(now time.Time) int {
+	short := r.ShortLimit - r.ShortUsage
+	if !ShortWindowReset(r.UpdatedAt).After(now) {
+		short = r.ShortLimit
+	}
+	daily := r.DailyLimit - r.DailyUsage
+	if !DailyWindowReset(r.UpdatedAt).After(now) {
+		daily = r.DailyLimit
+	}
+	return min(short, daily)
+}
+
+// ResetAt returns when enough budget is available again: the end of the daily window when the
+// daily limit is spent, otherwise the end of the current 15 minute window.
+func (r RateLimit) ResetAt() time.Time {
+	if r.DailyUsage >= r.DailyLimit {
+		return DailyWindowReset(r.UpdatedAt)
+	}
+	return ShortWindowReset(r.UpdatedAt)
+}
+
+func ShortWindowReset(t time.Time) time.Time {
+	return t.UTC().Truncate(15 * time.Minute).Add(15 * time.Minute)
+}
+
+func DailyWindowReset(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+type rateLimitTracker struct {
+	mu    sync.Mutex
+	limit RateLimit
+}
+
+// update records the limits of a response. The read limits, which apply to every GET, are
+// preferred over the overall limits when Strava sends both.
+func (t *rateLimitTracker) update(header http.Header) {
+	limit, usage := header.Get("X-ReadRateLimit-Limit"), header.Get("X-ReadRateLimit-Usage")
+	if limit == "" || usage == "" {
+		limit, usage = header.Get("X-RateLimit-Limit"), header.Get("X-RateLimit-Usage")
+	}
+	shortLimit, dailyLimit, ok := parsePair(limit)
+	if !ok {
+		return
+	}
+	shortUsage, dailyUsage, ok := parsePair(usage)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limit = RateLimit{
+		ShortLimit: shortLimit,
+		ShortUsage: shortUsage,
+		DailyLimit: dailyLimit,
+		DailyUsage: dailyUsage,
+		UpdatedAt:  time.Now(),
+	}
+}
+
+func (t *rateLimitTracker) get() RateLimit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+func parsePair(value string) (int, int, bool) {
+	first, second, found := strings.Cut(value, ",")
+	if !found {
+		return 0, 0, false
+	}
+	a, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return 0, 0, false
+	}
+	b, err := strconv.Atoi(strings.TrimSpace(second))
+	if err != nil {
+		return 0, 0, false
+	}
+	return a, b, true
+}
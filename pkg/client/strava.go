@@ -17,19 +17,30 @@ type StravaClient interface {
 	RefreshToken(clientID, clientSecret, refreshToken string) (*model.TokenResponse, error)
 	GetAthleteActivityByID(id, accessToken string) (*model.AthleteActivity, error)
 	GetAllAthleteActivities(after int, accessToken string) ([]model.AthleteActivity, error)
+	GetAthleteActivitiesBefore(after, before int, accessToken string) ([]model.AthleteActivity, error)
+	GetAllAthleteActivitiesBetween(after, before int, accessToken string) ([]model.AthleteActivity, error)
 	FetchStreams(activityID string, keys []string, accessToken string) (*model.ActivityStreams, error)
+	GetActivityLaps(activityID, accessToken string) ([]model.Lap, error)
+	// GetAthleteZones needs the profile:read_all scope.
+	GetAthleteZones(accessToken string) (*model.AthleteZones, error)
+	RateLimit() RateLimit
 }
 
 type stravaClient struct {
 	client       *http.Client
 	baseUrl      string
 	perPageLimit int // maximum number of activities per page
+	rateLimit    rateLimitTracker
 }
 
 func NewStravaClient(baseUrl string) StravaClient {
 	return &stravaClient{client: &http.Client{}, baseUrl: baseUrl, perPageLimit: 200}
 }
 
+func (s *stravaClient) RateLimit() RateLimit {
+	return s.rateLimit.get()
+}
+
 func (s *stravaClient) makeRequest(method, url string, body io.Reader, headers map[string]string) (*http.Response, error) {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
@@ -44,6 +55,7 @@ func (s *stravaClient) makeRequest(method, url string, body io.Reader, headers m
 	if err != nil {
 		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
+	s.rateLimit.update(resp.Header)
 
 	return resp, nil
 }
@@ -57,6 +69,10 @@ func (s *stravaClient) makeJSONRequest(method, url string, body io.Reader, heade
 	//nolint: errcheck // defer handles after function exit
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: HTTP %d: %s", ErrRateLimited, resp.StatusCode, string(body))
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
@@ -171,6 +187,51 @@ func (s *stravaClient) GetAllAthleteActivities(after int, accessToken string) ([
 	return allActivities, nil
 }
 
+// GetAthleteActivitiesBefore returns one page of the activities that started between after and
+// before (Unix seconds). An after of 0 means no lower bound; only then does Strava list the
+// activities newest first, with both bounds it lists them oldest first.
+func (s *stravaClient) GetAthleteActivitiesBefore(after, before int, accessToken string) ([]model.AthleteActivity, error) {
+	return s.getAthleteActivitiesPage(after, before, 1, accessToken)
+}
+
+// GetAllAthleteActivitiesBetween returns every activity that started between after and before
+// (Unix seconds).
+func (s *stravaClient) GetAllAthleteActivitiesBetween(after, before int, accessToken string) ([]model.AthleteActivity, error) {
+	var allActivities []model.AthleteActivity
+	page := 1
+
+	for {
+		activities, err := s.getAthleteActivitiesPage(after, before, page, accessToken)
+		if err != nil {
+			return nil, fmt.Errorf("fetching page %d: %w", page, err)
+		}
+
+		if len(activities) == 0 {
+			break
+		}
+		allActivities = append(allActivities, activities...)
+		page++
+	}
+
+	return allActivities, nil
+}
+
+func (s *stravaClient) getAthleteActivitiesPage(after, before, page int, accessToken string) ([]model.AthleteActivity, error) {
+	athleteActivityUrl := fmt.Sprintf("%s/api/v3/athlete/activities?page=%d&per_page=%d&before=%d",
+		s.baseUrl, page, s.perPageLimit, before)
+	if after > 0 {
+		athleteActivityUrl += fmt.Sprintf("&after=%d", after)
+	}
+
+	var activities []model.AthleteActivity
+	err := s.makeAuthenticatedRequest("GET", athleteActivityUrl, accessToken, &activities)
+	if err != nil {
+		return nil, fmt.Errorf("fetching activities: %w", err)
+	}
+
+	return activities, nil
+}
+
 func (s *stravaClient) FetchStreams(activityID string, keys []string, accessToken string) (*model.ActivityStreams, error) {
 	keysStr := strings.Join(keys, ",")
 	url := fmt.Sprintf(
@@ -187,3 +248,27 @@ func (s *stravaClient) FetchStreams(activityID string, keys []string, accessToke
 
 	return &streams, nil
 }
+
+func (s *stravaClient) GetActivityLaps(activityID, accessToken string) ([]model.Lap, error) {
+	url := fmt.Sprintf("%s/api/v3/activities/%s/laps", s.baseUrl, activityID)
+
+	laps := []model.Lap{}
+	err := s.makeAuthenticatedRequest("GET", url, accessToken, &laps)
+	if err != nil {
+		return nil, fmt.Errorf("fetching laps: %w", err)
+	}
+
+	return laps, nil
+}
+
+func (s *stravaClient) GetAthleteZones(accessToken string) (*model.AthleteZones, error) {
+	url := fmt.Sprintf("%s/api/v3/athlete/zones", s.baseUrl)
+
+	var zones model.AthleteZones
+	err := s.makeAuthenticatedRequest("GET", url, accessToken, &zones)
+	if err != nil {
+		return nil, fmt.Errorf("fetching athlete zones: %w", err)
+	}
+
+	return &zones, nil
+}
@@ -0,0 +1,325 @@
+package fit
+
+import (
+	"math"
+	"stravamcp/model"
+	"stravamcp/pkg/trackfile"
+	"time"
+)
+
+// fitEpoch is 1989-12-31T00:00:00Z, the zero point of FIT timestamps.
+var fitEpoch = time.Date(1989, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+const semicirclesToDegrees = 180.0 / (1 << 31)
+
+// Activity is the decoded content of a FIT activity file.
+type Activity struct {
+	Sport    string
+	Session  *Summary
+	Laps     []Summary
+	Points   []trackfile.Point
+	sport    int
+	subSport int
+}
+
+// Summary holds the totals of a session or lap message. Nil fields were not recorded.
+type Summary struct {
+	StartTime        time.Time `json:"start_time"`
+	TotalElapsedTime float64   `json:"total_elapsed_time"`
+	TotalTimerTime   float64   `json:"total_timer_time"`
+	TotalDistance    float64   `json:"total_distance"`
+	TotalAscent      *float64  `json:"total_ascent,omitempty"`
+	TotalDescent     *float64  `json:"total_descent,omitempty"`
+	TotalCalories    *float64  `json:"total_calories,omitempty"`
+	TotalWork        *float64  `json:"total_work,omitempty"`
+	AvgSpeed         *float64  `json:"avg_speed,omitempty"`
+	MaxSpeed         *float64  `json:"max_speed,omitempty"`
+	AvgHeartrate     *float64  `json:"avg_heartrate,omitempty"`
+	MaxHeartrate     *float64  `json:"max_heartrate,omitempty"`
+	AvgCadence       *float64  `json:"avg_cadence,omitempty"`
+	MaxCadence       *float64  `json:"max_cadence,omitempty"`
+	AvgPower         *float64  `json:"avg_power,omitempty"`
+	MaxPower         *float64  `json:"max_power,omitempty"`
+	NormalizedPower  *float64  `json:"normalized_power,omitempty"`
+	AvgTemperature   *float64  `json:"avg_temperature,omitempty"`
+}
+
+// summaryFields maps Summary values onto field numbers, which differ between session and lap messages.
+type summaryFields struct {
+	startTime, elapsed, timer, distance, ascent, descent, calories, work byte
+	avgSpeed, maxSpeed, enhancedAvgSpeed, enhancedMaxSpeed               byte
+	avgHR, maxHR, avgCadence, maxCadence, avgPower, maxPower, np, temp   byte
+}
+
+var sessionFields = summaryFields{
+	startTime: 2, elapsed: 7, timer: 8, distance: 9, calories: 11, avgSpeed: 14, maxSpeed: 15,
+	avgHR: 16, maxHR: 17, avgCadence: 18, maxCadence: 19, avgPower: 20, maxPower: 21,
+	ascent: 22, descent: 23, np: 34, work: 48, temp: 57, enhancedAvgSpeed: 124, enhancedMaxSpeed: 125,
+}
+
+var lapFields = summaryFields{
+	startTime: 2, elapsed: 7, timer: 8, distance: 9, calories: 11, avgSpeed: 13, maxSpeed: 14,
+	avgHR: 15, maxHR: 16, avgCadence: 17, maxCadence: 18, avgPower: 19, maxPower: 20,
+	ascent: 21, descent: 22, np: 33, work: 41, temp: 50, enhancedAvgSpeed: 110, enhancedMaxSpeed: 111,
+}
+
+func (a *Activity) add(global uint16, msg message) {
+	switch global {
+	case mesgRecord:
+		a.addRecord(msg)
+	case mesgLap:
+		a.Laps = append(a.Laps, msg.summary(lapFields))
+	case mesgSession:
+		if a.Session == nil {
+			summary := msg.summary(sessionFields)
+			a.Session = &summary
+			a.sport = int(msg.value(5, -1))
+			a.subSport = int(msg.value(6, 0))
+			a.Sport = sportType(a.sport, a.subSport)
+		}
+	}
+}
+
+func (a *Activity) addRecord(msg message) {
+	timestamp, ok := msg[fieldTimestamp]
+	if !ok {
+		return
+	}
+	point := trackfile.Point{
+		Time:      toTime(timestamp),
+		Distance:  msg.scaled(5, 100, 0),
+		Heartrate: msg.scaled(3, 1, 0),
+		Cadence:   msg.scaled(4, 1, 0),
+		Watts:     msg.scaled(7, 1, 0),
+		Temp:      msg.scaled(13, 1, 0),
+		Speed:     msg.scaled(73, 1000, 0),
+		Altitude:  msg.scaled(78, 5, 500),
+	}
+	if point.Speed == nil {
+		point.Speed = msg.scaled(6, 1000, 0)
+	}
+	if point.Altitude == nil {
+		point.Altitude = msg.scaled(2, 5, 500)
+	}
+	if lat, ok := msg[0]; ok {
+		if lng, ok := msg[1]; ok {
+			point.Lat = float(lat * semicirclesToDegrees)
+			point.Lng = float(lng * semicirclesToDegrees)
+		}
+	}
+	a.Points = append(a.Points, point)
+}
+
+// StartTime is the session start, falling back to the first record.
+func (a *Activity) StartTime() time.Time {
+	if a.Session != nil && !a.Session.StartTime.IsZero() {
+		return a.Session.StartTime
+	}
+	if len(a.Points) > 0 {
+		return a.Points[0].Time
+	}
+	return time.Time{}
+}
+
+// Track converts the records into Strava-shaped streams.
+func (a *Activity) Track() *trackfile.Track {
+	return &trackfile.Track{
+		Sport:     a.Sport,
+		StartTime: a.StartTime(),
+		Streams:   trackfile.BuildStreams(a.Points),
+	}
+}
+
+// AthleteActivity builds an activity summary from the session message, or from the records
+// when the file has no session.
+func (a *Activity) AthleteActivity() *model.AthleteActivity {
+	start := a.StartTime()
+	activity := &model.AthleteActivity{
+		Type:      a.Sport,
+		SportType: a.Sport,
+		StartDate: start.UTC().Format(time.RFC3339),
+		Trainer:   a.subSport == 6 || a.subSport == 58,
+	}
+	if activity.Type == "" {
+		activity.Type, activity.SportType = "Workout", "Workout"
+	}
+
+	if session := a.Session; session != nil {
+		activity.Distance = session.TotalDistance
+		activity.ElapsedTime = int(math.Round(session.TotalElapsedTime))
+		activity.MovingTime = int(math.Round(session.TotalTimerTime))
+		activity.TotalElevationGain = valueOrZero(session.TotalAscent)
+		activity.AverageSpeed = valueOrZero(session.AvgSpeed)
+		activity.MaxSpeed = valueOrZero(session.MaxSpeed)
+		activity.AverageHeartrate = session.AvgHeartrate
+		activity.MaxHeartrate = session.MaxHeartrate
+		activity.AverageCadence = session.AvgCadence
+		activity.AverageWatts = session.AvgPower
+		activity.MaxWatts = roundedInt(session.MaxPower)
+		activity.WeightedAverageWatts = roundedInt(session.NormalizedPower)
+		activity.AverageTemp = roundedInt(session.AvgTemperature)
+		if session.TotalWork != nil {
+			kilojoules := *session.TotalWork / 1000
+			activity.Kilojoules = &kilojoules
+		}
+	} else if len(a.Points) > 0 {
+		last := a.Points[len(a.Points)-1]
+		activity.ElapsedTime = int(last.Time.Sub(start).Seconds())
+		activity.MovingTime = activity.ElapsedTime
+		activity.Distance = valueOrZero(last.Distance)
+	}
+	if activity.AverageSpeed == 0 && activity.MovingTime > 0 {
+		activity.AverageSpeed = activity.Distance / float64(activity.MovingTime)
+	}
+	activity.HasHeartrate = activity.AverageHeartrate != nil
+	activity.DeviceWatts = boolPtr(activity.AverageWatts != nil)
+
+	for _, point := range a.Points {
+		if point.Lat != nil {
+			activity.StartLatLng = []float64{*point.Lat, *point.Lng}
+			break
+		}
+	}
+	for i := len(a.Points) - 1; i >= 0; i-- {
+		if point := a.Points[i]; point.Lat != nil {
+			activity.EndLatLng = []float64{*point.Lat, *point.Lng}
+			break
+		}
+	}
+	return activity
+}
+
+func (m message) value(num byte, fallback float64) float64 {
+	if v, ok := m[num]; ok {
+		return v
+	}
+	return fallback
+}
+
+func (m message) scaled(num byte, scale, offset float64) *float64 {
+	v, ok := m[num]
+	if !ok {
+		return nil
+	}
+	return float(v/scale - offset)
+}
+
+func (m message) summary(f summaryFields) Summary {
+	summary := Summary{
+		TotalElapsedTime: m.value(f.elapsed, 0) / 1000,
+		TotalTimerTime:   m.value(f.timer, 0) / 1000,
+		TotalDistance:    m.value(f.distance, 0) / 100,
+		TotalAscent:      m.scaled(f.ascent, 1, 0),
+		TotalDescent:     m.scaled(f.descent, 1, 0),
+		TotalCalories:    m.scaled(f.calories, 1, 0),
+		TotalWork:        m.scaled(f.work, 1, 0),
+		AvgSpeed:         m.scaled(f.enhancedAvgSpeed, 1000, 0),
+		MaxSpeed:         m.scaled(f.enhancedMaxSpeed, 1000, 0),
+		AvgHeartrate:     m.scaled(f.avgHR, 1, 0),
+		MaxHeartrate:     m.scaled(f.maxHR, 1, 0),
+		AvgCadence:       m.scaled(f.avgCadence, 1, 0),
+		MaxCadence:       m.scaled(f.maxCadence, 1, 0),
+		AvgPower:         m.scaled(f.avgPower, 1, 0),
+		MaxPower:         m.scaled(f.maxPower, 1, 0),
+		NormalizedPower:  m.scaled(f.np, 1, 0),
+		AvgTemperature:   m.scaled(f.temp, 1, 0),
+	}
+	if startTime, ok := m[f.startTime]; ok {
+		summary.StartTime = toTime(startTime)
+	}
+	if summary.AvgSpeed == nil {
+		summary.AvgSpeed = m.scaled(f.avgSpeed, 1000, 0)
+	}
+	if summary.MaxSpeed == nil {
+		summary.MaxSpeed = m.scaled(f.maxSpeed, 1000, 0)
+	}
+	return summary
+}
+
+// sportType maps the FIT sport and sub_sport enums onto Strava sport types.
+func sportType(sport, subSport int) string {
+	switch sport {
+	case 1: // running
+		switch subSport {
+		case 3: // trail
+			return "TrailRun"
+		case 58: // virtual_activity
+			return "VirtualRun"
+		}
+		return "Run"
+	case 2: // cycling
+		switch subSport {
+		case 8: // mountain
+			return "MountainBikeRide"
+		case 46: // gravel_cycling
+			return "GravelRide"
+		case 58: // virtual_activity
+			return "VirtualRide"
+		}
+		return "Ride"
+	case 5:
+		return "Swim"
+	case 10: // training
+		if subSport == 20 { // strength_training
+			return "WeightTraining"
+		}
+		return "Workout"
+	case 11:
+		return "Walk"
+	case 12:
+		return "NordicSki"
+	case 13:
+		return "AlpineSki"
+	case 14:
+		return "Snowboard"
+	case 15:
+		return "Rowing"
+	case 17:
+		return "Hike"
+	case 19:
+		return "Canoeing"
+	case 21:
+		return "EBikeRide"
+	case 4: // fitness_equipment
+		switch subSport {
+		case 14: // indoor_rowing
+			return "Rowing"
+		case 15:
+			return "Elliptical"
+		case 16:
+			return "StairStepper"
+		}
+		return "Workout"
+	case -1:
+		return ""
+	default:
+		return "Workout"
+	}
+}
+
+func toTime(timestamp float64) time.Time {
+	return fitEpoch.Add(time.Duration(timestamp) * time.Second)
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func valueOrZero(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+func roundedInt(v *float64) *int {
+	if v == nil {
+		return nil
+	}
+	rounded := int(math.Round(*v))
+	return &rounded
+}
@@ -0,0 +1,318 @@
+package fit
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Global message numbers from the FIT profile that the decoder understands.
+const (
+	mesgSession = 18
+	mesgLap     = 19
+	mesgRecord  = 20
+)
+
+const fieldTimestamp = 253
+
+var ErrInvalidFile = errors.New("not a valid FIT file")
+
+type fieldDef struct {
+	num      byte
+	size     int
+	baseType byte
+}
+
+type messageDef struct {
+	global    uint16
+	bigEndian bool
+	fields    []fieldDef
+	devSize   int
+}
+
+// message holds the valid numeric fields of one data message, keyed by field number.
+type message map[byte]float64
+
+type decoder struct {
+	data          []byte
+	pos           int
+	defs          [16]*messageDef
+	lastTimestamp uint32
+}
+
+// DecodeFile decodes a .fit or .fit.gz file from disk.
+func DecodeFile(fileName string) (*Activity, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	//nolint: errcheck // defer is used to clean up
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(strings.ToLower(fileName), ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", fileName, err)
+		}
+		//nolint: errcheck // defer is used to clean up
+		defer gz.Close()
+		r = gz
+	}
+	return Decode(r)
+}
+
+// Decode reads a FIT activity file and collects its record, lap and session messages.
+// Only the first FIT file of a chained file is read.
+func Decode(r io.Reader) (*Activity, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 12 {
+		return nil, fmt.Errorf("%w: file too short", ErrInvalidFile)
+	}
+	headerSize := int(raw[0])
+	if headerSize < 12 || len(raw) < headerSize || string(raw[8:12]) != ".FIT" {
+		return nil, fmt.Errorf("%w: missing .FIT signature", ErrInvalidFile)
+	}
+	dataSize := int(binary.LittleEndian.Uint32(raw[4:8]))
+	end := headerSize + dataSize
+	if len(raw) < end+2 {
+		return nil, fmt.Errorf("%w: truncated data", ErrInvalidFile)
+	}
+	if fileCRC := binary.LittleEndian.Uint16(raw[end : end+2]); fileCRC != 0 && fileCRC != crc(raw[:end]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidFile)
+	}
+
+	d := &decoder{data: raw[headerSize:end]}
+	activity := &Activity{}
+	for d.pos < len(d.data) {
+		global, msg, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if msg == nil {
+			continue
+		}
+		activity.add(global, msg)
+	}
+	return activity, nil
+}
+
+// next decodes one record. Definition messages return a nil message.
+func (d *decoder) next() (uint16, message, error) {
+	header, err := d.read(1)
+	if err != nil {
+		return 0, nil, err
+	}
+	h := header[0]
+
+	if h&0x80 != 0 {
+		// Compressed timestamp header: a 5 bit offset from the last full timestamp.
+		local := (h >> 5) & 0x03
+		offset := uint32(h & 0x1F)
+		timestamp := (d.lastTimestamp &^ 0x1F) + offset
+		if offset < d.lastTimestamp&0x1F {
+			timestamp += 0x20
+		}
+		d.lastTimestamp = timestamp
+		global, msg, err := d.readData(local)
+		if err != nil {
+			return 0, nil, err
+		}
+		msg[fieldTimestamp] = float64(timestamp)
+		return global, msg, nil
+	}
+
+	local := h & 0x0F
+	if h&0x40 != 0 {
+		return 0, nil, d.readDefinition(local, h&0x20 != 0)
+	}
+	return d.readData(local)
+}
+
+func (d *decoder) readDefinition(local byte, developerData bool) error {
+	fixed, err := d.read(5)
+	if err != nil {
+		return err
+	}
+	def := &messageDef{bigEndian: fixed[1] == 1}
+	if def.bigEndian {
+		def.global = binary.BigEndian.Uint16(fixed[2:4])
+	} else {
+		def.global = binary.LittleEndian.Uint16(fixed[2:4])
+	}
+	fields, err := d.read(int(fixed[4]) * 3)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(fields); i += 3 {
+		def.fields = append(def.fields, fieldDef{num: fields[i], size: int(fields[i+1]), baseType: fields[i+2]})
+	}
+	if developerData {
+		count, err := d.read(1)
+		if err != nil {
+			return err
+		}
+		devFields, err := d.read(int(count[0]) * 3)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(devFields); i += 3 {
+			def.devSize += int(devFields[i+1])
+		}
+	}
+	d.defs[local] = def
+	return nil
+}
+
+func (d *decoder) readData(local byte) (uint16, message, error) {
+	def := d.defs[local]
+	if def == nil {
+		return 0, nil, fmt.Errorf("%w: data message for undefined local type %d", ErrInvalidFile, local)
+	}
+	msg := message{}
+	for _, field := range def.fields {
+		raw, err := d.read(field.size)
+		if err != nil {
+			return 0, nil, err
+		}
+		if value, ok := decodeValue(raw, field.baseType, def.bigEndian); ok {
+			msg[field.num] = value
+		}
+	}
+	// Developer fields are not interpreted, only skipped.
+	if _, err := d.read(def.devSize); err != nil {
+		return 0, nil, err
+	}
+	if timestamp, ok := msg[fieldTimestamp]; ok {
+		d.lastTimestamp = uint32(timestamp)
+	}
+	return def.global, msg, nil
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if d.pos+n > len(d.data) {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrInvalidFile)
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// decodeValue returns the first element of a field, or false for the base type's invalid value.
+func decodeValue(raw []byte, baseType byte, bigEndian bool) (float64, bool) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	switch baseType & 0x1F {
+	case 0x00, 0x02, 0x0D: // enum, uint8, byte
+		if len(raw) < 1 || raw[0] == 0xFF {
+			return 0, false
+		}
+		return float64(raw[0]), true
+	case 0x0A: // uint8z
+		if len(raw) < 1 || raw[0] == 0 {
+			return 0, false
+		}
+		return float64(raw[0]), true
+	case 0x01: // sint8
+		if len(raw) < 1 || raw[0] == 0x7F {
+			return 0, false
+		}
+		return float64(int8(raw[0])), true
+	case 0x03: // sint16
+		if len(raw) < 2 {
+			return 0, false
+		}
+		v := order.Uint16(raw)
+		return float64(int16(v)), v != 0x7FFF
+	case 0x04: // uint16
+		if len(raw) < 2 {
+			return 0, false
+		}
+		v := order.Uint16(raw)
+		return float64(v), v != 0xFFFF
+	case 0x0B: // uint16z
+		if len(raw) < 2 {
+			return 0, false
+		}
+		v := order.Uint16(raw)
+		return float64(v), v != 0
+	case 0x05: // sint32
+		if len(raw) < 4 {
+			return 0, false
+		}
+		v := order.Uint32(raw)
+		return float64(int32(v)), v != 0x7FFFFFFF
+	case 0x06: // uint32
+		if len(raw) < 4 {
+			return 0, false
+		}
+		v := order.Uint32(raw)
+		return float64(v), v != 0xFFFFFFFF
+	case 0x0C: // uint32z
+		if len(raw) < 4 {
+			return 0, false
+		}
+		v := order.Uint32(raw)
+		return float64(v), v != 0
+	case 0x08: // float32
+		if len(raw) < 4 {
+			return 0, false
+		}
+		v := order.Uint32(raw)
+		return float64(math.Float32frombits(v)), v != 0xFFFFFFFF
+	case 0x09: // float64
+		if len(raw) < 8 {
+			return 0, false
+		}
+		v := order.Uint64(raw)
+		return math.Float64frombits(v), v != 0xFFFFFFFFFFFFFFFF
+	case 0x0E: // sint64
+		if len(raw) < 8 {
+			return 0, false
+		}
+		v := order.Uint64(raw)
+		return float64(int64(v)), v != 0x7FFFFFFFFFFFFFFF
+	case 0x0F: // uint64
+		if len(raw) < 8 {
+			return 0, false
+		}
+		v := order.Uint64(raw)
+		return float64(v), v != 0xFFFFFFFFFFFFFFFF
+	case 0x10: // uint64z
+		if len(raw) < 8 {
+			return 0, false
+		}
+		v := order.Uint64(raw)
+		return float64(v), v != 0
+	default: // strings and unknown types carry nothing the decoder uses
+		return 0, false
+	}
+}
+
+var crcTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+func crc(data []byte) uint16 {
+	var sum uint16
+	for _, b := range data {
+		tmp := crcTable[sum&0xF]
+		sum = (sum >> 4) & 0x0FFF
+		sum = sum ^ tmp ^ crcTable[b&0xF]
+		tmp = crcTable[sum&0xF]
+		sum = (sum >> 4) & 0x0FFF
+		sum = sum ^ tmp ^ crcTable[(b>>4)&0xF]
+	}
+	return sum
+}
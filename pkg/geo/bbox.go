@@ -0,0 +1,122 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// metersPerDegree is the length of a degree of latitude, and of longitude at the equator.
+const metersPerDegree = earthRadiusMeters * math.Pi / 180
+
+// BoundingBox is an area between two latitudes and two longitudes in degrees. Boxes crossing the
+// antimeridian are not supported.
+type BoundingBox struct {
+	South float64 `json:"south"`
+	West  float64 `json:"west"`
+	North float64 `json:"north"`
+	East  float64 `json:"east"`
+}
+
+// ParseBoundingBox reads a box given as "south,west,north,east".
+func ParseBoundingBox(value string) (BoundingBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, fmt.Errorf("invalid bounding box %q, use south,west,north,east", value)
+	}
+	var coordinates [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BoundingBox{}, fmt.Errorf("invalid bounding box %q, use south,west,north,east", value)
+		}
+		coordinates[i] = v
+	}
+	box := BoundingBox{South: coordinates[0], West: coordinates[1], North: coordinates[2], East: coordinates[3]}
+	return box, box.Validate()
+}
+
+func (b BoundingBox) Validate() error {
+	if b.South < -90 || b.North > 90 || b.West < -180 || b.East > 180 {
+		return fmt.Errorf("bounding box out of range")
+	}
+	if b.South > b.North || b.West > b.East {
+		return fmt.Errorf("bounding box must have south <= north and west <= east")
+	}
+	return nil
+}
+
+// NewBoundingBox returns the smallest box containing all points.
+func NewBoundingBox(points [][]float64) BoundingBox {
+	if len(points) == 0 {
+		return BoundingBox{}
+	}
+	box := BoundingBox{South: points[0][0], West: points[0][1], North: points[0][0], East: points[0][1]}
+	for _, p := range points[1:] {
+		box.South = math.Min(box.South, p[0])
+		box.North = math.Max(box.North, p[0])
+		box.West = math.Min(box.West, p[1])
+		box.East = math.Max(box.East, p[1])
+	}
+	return box
+}
+
+// Around returns the box enclosing a circle of radius meters around a point.
+func Around(lat, lng, radius float64) BoundingBox {
+	dLat := radius / metersPerDegree
+	dLng := 180.0
+	if c := math.Cos(lat * math.Pi / 180); c > 1e-6 {
+		dLng = math.Min(radius/(metersPerDegree*c), 180)
+	}
+	return BoundingBox{
+		South: math.Max(lat-dLat, -90),
+		West:  math.Max(lng-dLng, -180),
+		North: math.Min(lat+dLat, 90),
+		East:  math.Min(lng+dLng, 180),
+	}
+}
+
+func (b BoundingBox) Contains(lat, lng float64) bool {
+	return lat >= b.South && lat <= b.North && lng >= b.West && lng <= b.East
+}
+
+// ContainsBox reports whether other lies completely inside the box.
+func (b BoundingBox) ContainsBox(other BoundingBox) bool {
+	return other.South >= b.South && other.North <= b.North && other.West >= b.West && other.East <= b.East
+}
+
+func (b BoundingBox) Intersects(other BoundingBox) bool {
+	return other.South <= b.North && other.North >= b.South && other.West <= b.East && other.East >= b.West
+}
+
+// IntersectsSegment reports whether the straight segment between two [lat, lng] points passes
+// through the box, clipping it against every side.
+func (b BoundingBox) IntersectsSegment(from, to []float64) bool {
+	t0, t1 := 0.0, 1.0
+	dLat, dLng := to[0]-from[0], to[1]-from[1]
+	for _, edge := range [][2]float64{
+		{-dLat, from[0] - b.South},
+		{dLat, b.North - from[0]},
+		{-dLng, from[1] - b.West},
+		{dLng, b.East - from[1]},
+	} {
+		p, q := edge[0], edge[1]
+		if p == 0 {
+			if q < 0 {
+				return false
+			}
+			continue
+		}
+		r := q / p
+		if p < 0 {
+			t0 = math.Max(t0, r)
+		} else {
+			t1 = math.Min(t1, r)
+		}
+		if t0 > t1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,16 @@
+package geo
+
+import "math"
+
+const earthRadiusMeters = 6371008.8
+
+// Haversine returns the great-circle distance in meters between two points given in degrees.
+func Haversine(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lng2 - lng1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
@@ -0,0 +1,173 @@
+package geo
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// DefaultCellDegrees is the grid cell size of an Index, about 1 km north to south.
+const DefaultCellDegrees = 0.01
+
+// Index is a grid index of tracks, lists of [lat, lng] points keyed by an ID. Every segment of a
+// track is filed under the cells its bounding box covers, so queries only measure the segments
+// near the area they ask about.
+type Index struct {
+	cell   float64
+	tracks map[int64][][]float64
+	cells  map[[2]int][]segmentRef
+	// extent is the range of occupied cells, as south and west, north and east row and column.
+	extent [2][2]int
+}
+
+type segmentRef struct {
+	id    int64
+	index int
+}
+
+// Match is a track found by a query. Distance is the shortest distance in meters from the
+// query point to the track; it is zero for box queries.
+type Match struct {
+	ID       int64   `json:"id"`
+	Distance float64 `json:"distance"`
+}
+
+func NewIndex(cellDegrees float64) *Index {
+	if cellDegrees <= 0 {
+		cellDegrees = DefaultCellDegrees
+	}
+	return &Index{cell: cellDegrees, tracks: map[int64][][]float64{}, cells: map[[2]int][]segmentRef{}}
+}
+
+// Add indexes a track. A single point is indexed as a segment of zero length.
+func (x *Index) Add(id int64, points [][]float64) {
+	if len(points) == 0 {
+		return
+	}
+	x.tracks[id] = points
+	if len(points) == 1 {
+		points = [][]float64{points[0], points[0]}
+		x.tracks[id] = points
+	}
+	for i := 1; i < len(points); i++ {
+		low, high := x.cellRange(NewBoundingBox(points[i-1 : i+1]))
+		if len(x.cells) == 0 {
+			x.extent = [2][2]int{low, high}
+		}
+		for k := range 2 {
+			x.extent[0][k] = min(x.extent[0][k], low[k])
+			x.extent[1][k] = max(x.extent[1][k], high[k])
+		}
+		for row := low[0]; row <= high[0]; row++ {
+			for column := low[1]; column <= high[1]; column++ {
+				key := [2]int{row, column}
+				x.cells[key] = append(x.cells[key], segmentRef{id: id, index: i})
+			}
+		}
+	}
+}
+
+func (x *Index) Len() int {
+	return len(x.tracks)
+}
+
+// Near returns the tracks that pass within radius meters of a point, nearest first.
+func (x *Index) Near(lat, lng, radius float64) []Match {
+	best := map[int64]float64{}
+	x.eachCell(Around(lat, lng, radius), func(key [2]int) {
+		for _, ref := range x.cells[key] {
+			track := x.tracks[ref.id]
+			d := segmentDistance(lat, lng, track[ref.index-1], track[ref.index])
+			if current, ok := best[ref.id]; d <= radius && (!ok || d < current) {
+				best[ref.id] = d
+			}
+		}
+	})
+	matches := make([]Match, 0, len(best))
+	for id, d := range best {
+		matches = append(matches, Match{ID: id, Distance: math.Round(d)})
+	}
+	slices.SortFunc(matches, func(a, b Match) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), cmp.Compare(a.ID, b.ID))
+	})
+	return matches
+}
+
+// InBox returns the tracks that pass through a box or, with within set, lie completely inside it.
+func (x *Index) InBox(box BoundingBox, within bool) []Match {
+	found := map[int64]bool{}
+	x.eachCell(box, func(key [2]int) {
+		for _, ref := range x.cells[key] {
+			if found[ref.id] {
+				continue
+			}
+			track := x.tracks[ref.id]
+			if box.IntersectsSegment(track[ref.index-1], track[ref.index]) {
+				found[ref.id] = !within || box.ContainsBox(NewBoundingBox(track))
+			}
+		}
+	})
+	matches := []Match{}
+	for id, ok := range found {
+		if ok {
+			matches = append(matches, Match{ID: id})
+		}
+	}
+	slices.SortFunc(matches, func(a, b Match) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return matches
+}
+
+// cellRange returns the south-west and the north-east cell of a box.
+func (x *Index) cellRange(box BoundingBox) (low, high [2]int) {
+	low = [2]int{int(math.Floor(box.South / x.cell)), int(math.Floor(box.West / x.cell))}
+	high = [2]int{int(math.Floor(box.North / x.cell)), int(math.Floor(box.East / x.cell))}
+	return low, high
+}
+
+// eachCell visits the occupied cells of a query box. The box is clipped to the extent of the
+// index first, and when it still spans more cells than are occupied, the occupied cells are
+// checked instead of walking the grid, so large boxes cost no more than a full scan.
+func (x *Index) eachCell(box BoundingBox, visit func(key [2]int)) {
+	if len(x.cells) == 0 {
+		return
+	}
+	low, high := x.cellRange(box)
+	for k := range 2 {
+		low[k] = max(low[k], x.extent[0][k])
+		high[k] = min(high[k], x.extent[1][k])
+		if low[k] > high[k] {
+			return
+		}
+	}
+	if (high[0]-low[0]+1)*(high[1]-low[1]+1) > len(x.cells) {
+		for key := range x.cells {
+			if key[0] >= low[0] && key[0] <= high[0] && key[1] >= low[1] && key[1] <= high[1] {
+				visit(key)
+			}
+		}
+		return
+	}
+	for row := low[0]; row <= high[0]; row++ {
+		for column := low[1]; column <= high[1]; column++ {
+			if _, ok := x.cells[[2]int{row, column}]; ok {
+				visit([2]int{row, column})
+			}
+		}
+	}
+}
+
+// segmentDistance is the distance in meters from a point to a segment, on a plane tangent at the
+// point, which is accurate for the short distances of proximity queries.
+func segmentDistance(lat, lng float64, from, to []float64) float64 {
+	scale := math.Cos(lat * math.Pi / 180)
+	ax, ay := (from[1]-lng)*scale, from[0]-lat
+	bx, by := (to[1]-lng)*scale, to[0]-lat
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy) * metersPerDegree
+}
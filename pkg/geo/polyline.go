@@ -0,0 +1,77 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+)
+
+// DecodePolyline decodes a Google encoded polyline, as used by Strava's map.summary_polyline,
+// into [lat, lng] pairs in degrees.
+func DecodePolyline(encoded string) ([][]float64, error) {
+	var points [][]float64
+	var lat, lng int
+	for i := 0; i < len(encoded); {
+		dLat, next, err := decodeValue(encoded, i)
+		if err != nil {
+			return nil, err
+		}
+		dLng, next, err := decodeValue(encoded, next)
+		if err != nil {
+			return nil, err
+		}
+		i = next
+		lat += dLat
+		lng += dLng
+		points = append(points, []float64{float64(lat) / 1e5, float64(lng) / 1e5})
+	}
+	return points, nil
+}
+
+func decodeValue(encoded string, i int) (int, int, error) {
+	var result, shift int
+	for {
+		if i >= len(encoded) {
+			return 0, i, fmt.Errorf("truncated polyline")
+		}
+		b := int(encoded[i]) - 63
+		i++
+		if b < 0 || b > 63 {
+			return 0, i, fmt.Errorf("invalid polyline character %q", encoded[i-1])
+		}
+		result |= (b & 0x1f) << shift
+		shift += 5
+		if b < 0x20 {
+			break
+		}
+	}
+	if result&1 != 0 {
+		return ^(result >> 1), i, nil
+	}
+	return result >> 1, i, nil
+}
+
+// EncodePolyline encodes [lat, lng] pairs in degrees as a Google encoded polyline with five
+// decimals of precision.
+func EncodePolyline(points [][]float64) string {
+	var encoded []byte
+	var lat, lng int
+	for _, p := range points {
+		nextLat, nextLng := int(math.Round(p[0]*1e5)), int(math.Round(p[1]*1e5))
+		encoded = encodeValue(encoded, nextLat-lat)
+		encoded = encodeValue(encoded, nextLng-lng)
+		lat, lng = nextLat, nextLng
+	}
+	return string(encoded)
+}
+
+func encodeValue(encoded []byte, value int) []byte {
+	value <<= 1
+	if value < 0 {
+		value = ^value
+	}
+	for value >= 0x20 {
+		encoded = append(encoded, byte(0x20|value&0x1f)+63)
+		value >>= 5
+	}
+	return append(encoded, byte(value)+63)
+}
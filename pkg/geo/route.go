@@ -0,0 +1,69 @@
+package geo
+
+import "math"
+
+// Length returns the length in meters of a route of [lat, lng] points.
+func Length(points [][]float64) float64 {
+	var length float64
+	for i := 1; i < len(points); i++ {
+		length += Haversine(points[i-1][0], points[i-1][1], points[i][0], points[i][1])
+	}
+	return length
+}
+
+// Resample returns n points spaced evenly by distance along a route, so that routes recorded or
+// simplified with different point densities can be compared point by point. Routes with fewer
+// than two points are returned as they are.
+func Resample(points [][]float64, n int) [][]float64 {
+	if len(points) < 2 || n < 2 {
+		return points
+	}
+	cumulative := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		cumulative[i] = cumulative[i-1] + Haversine(points[i-1][0], points[i-1][1], points[i][0], points[i][1])
+	}
+	total := cumulative[len(points)-1]
+	resampled := make([][]float64, 0, n)
+	j := 1
+	for k := range n {
+		target := total * float64(k) / float64(n-1)
+		for j < len(points)-1 && cumulative[j] < target {
+			j++
+		}
+		f := 0.0
+		if step := cumulative[j] - cumulative[j-1]; step > 0 {
+			f = math.Max(0, math.Min(1, (target-cumulative[j-1])/step))
+		}
+		a, b := points[j-1], points[j]
+		resampled = append(resampled, []float64{a[0] + f*(b[0]-a[0]), a[1] + f*(b[1]-a[1])})
+	}
+	return resampled
+}
+
+// Frechet returns the discrete Fréchet distance in meters between two routes: the shortest leash
+// that lets one walker on each route go from start to finish without ever stepping back. Unlike
+// the distance between the sets of points it tells apart routes that run in opposite directions.
+func Frechet(a, b [][]float64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return math.Inf(1)
+	}
+	previous := make([]float64, len(b))
+	current := make([]float64, len(b))
+	for i := range a {
+		for j := range b {
+			d := Haversine(a[i][0], a[i][1], b[j][0], b[j][1])
+			switch {
+			case i == 0 && j == 0:
+				current[j] = d
+			case i == 0:
+				current[j] = math.Max(current[j-1], d)
+			case j == 0:
+				current[j] = math.Max(previous[j], d)
+			default:
+				current[j] = math.Max(math.Min(previous[j], math.Min(previous[j-1], current[j-1])), d)
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)-1]
+}
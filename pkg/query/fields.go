@@ -0,0 +1,290 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"stravamcp/model"
+	"stravamcp/pkg/sport"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kind decides how literals compared with a field are parsed. Numeric kinds are compared in the
+// unit Strava stores (meters, seconds, m/s); literals are converted into it.
+type kind int
+
+const (
+	kindString kind = iota
+	kindNumber
+	kindDistance
+	kindElevation
+	kindDuration
+	kindSpeed
+	kindPace
+	kindDate
+	kindBool
+	// kindSport matches sport names and groups through the sport taxonomy.
+	kindSport
+)
+
+type field struct {
+	name   string
+	kind   kind
+	str    func(a *model.AthleteActivity) (string, bool)
+	num    func(a *model.AthleteActivity) (float64, bool)
+	truthy func(a *model.AthleteActivity) bool
+}
+
+var fields = map[string]*field{}
+
+func init() {
+	for _, f := range []struct {
+		names []string
+		field field
+	}{
+		{[]string{"name"}, field{kind: kindString, str: func(a *model.AthleteActivity) (string, bool) { return a.Name, true }}},
+		{[]string{"type"}, field{kind: kindString, str: func(a *model.AthleteActivity) (string, bool) { return a.Type, a.Type != "" }}},
+		{[]string{"sport_type"}, field{kind: kindString, str: func(a *model.AthleteActivity) (string, bool) { return a.SportType, a.SportType != "" }}},
+		{[]string{"sport"}, field{kind: kindSport, str: func(a *model.AthleteActivity) (string, bool) { return sport.Of(a), sport.Of(a) != "" }}},
+		{[]string{"gear_id", "gear"}, field{kind: kindString, str: func(a *model.AthleteActivity) (string, bool) { return optionalString(a.GearID) }}},
+		{[]string{"visibility"}, field{kind: kindString, str: func(a *model.AthleteActivity) (string, bool) { return a.Visibility, a.Visibility != "" }}},
+		{[]string{"city"}, field{kind: kindString, str: func(a *model.AthleteActivity) (string, bool) { return optionalString(a.LocationCity) }}},
+		{[]string{"country"}, field{kind: kindString, str: func(a *model.AthleteActivity) (string, bool) { return optionalString(a.LocationCountry) }}},
+		{[]string{"id"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return float64(a.ID), true }}},
+		{[]string{"distance"}, field{kind: kindDistance, num: func(a *model.AthleteActivity) (float64, bool) { return a.Distance, true }}},
+		{[]string{"elevation", "elevation_gain"}, field{kind: kindElevation, num: func(a *model.AthleteActivity) (float64, bool) { return a.TotalElevationGain, true }}},
+		{[]string{"moving_time", "time"}, field{kind: kindDuration, num: func(a *model.AthleteActivity) (float64, bool) { return float64(a.MovingTime), true }}},
+		{[]string{"elapsed_time"}, field{kind: kindDuration, num: func(a *model.AthleteActivity) (float64, bool) { return float64(a.ElapsedTime), true }}},
+		{[]string{"avg_speed", "speed"}, field{kind: kindSpeed, num: func(a *model.AthleteActivity) (float64, bool) { return a.AverageSpeed, a.AverageSpeed > 0 }}},
+		{[]string{"max_speed"}, field{kind: kindSpeed, num: func(a *model.AthleteActivity) (float64, bool) { return a.MaxSpeed, a.MaxSpeed > 0 }}},
+		{[]string{"pace"}, field{kind: kindPace, num: func(a *model.AthleteActivity) (float64, bool) {
+			if a.AverageSpeed <= 0 {
+				return 0, false
+			}
+			return 1000 / a.AverageSpeed, true
+		}}},
+		{[]string{"avg_hr", "hr"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return optionalFloat(a.AverageHeartrate) }}},
+		{[]string{"max_hr"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return optionalFloat(a.MaxHeartrate) }}},
+		{[]string{"avg_watts", "watts", "power"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return optionalFloat(a.AverageWatts) }}},
+		{[]string{"max_watts"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return optionalInt(a.MaxWatts) }}},
+		{[]string{"weighted_watts", "np"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return optionalInt(a.WeightedAverageWatts) }}},
+		{[]string{"cadence"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return optionalFloat(a.AverageCadence) }}},
+		{[]string{"temp"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return optionalInt(a.AverageTemp) }}},
+		{[]string{"kilojoules", "kj"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return optionalFloat(a.Kilojoules) }}},
+		{[]string{"suffer_score"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return optionalFloat(a.SufferScore) }}},
+		{[]string{"kudos"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return float64(a.KudosCount), true }}},
+		{[]string{"achievements"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return float64(a.AchievementCount), true }}},
+		{[]string{"prs", "pr_count"}, field{kind: kindNumber, num: func(a *model.AthleteActivity) (float64, bool) { return float64(a.PRCount), true }}},
+		{[]string{"date", "start_date"}, field{kind: kindDate, num: func(a *model.AthleteActivity) (float64, bool) {
+			// start_date_local carries the local wall-clock time with a Z suffix, so a date
+			// literal matches the day the activity took place where it was recorded.
+			value := a.StartDateLocal
+			if value == "" {
+				value = a.StartDate
+			}
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return 0, false
+			}
+			return float64(t.Unix()), true
+		}}},
+		{[]string{"commute"}, field{kind: kindBool, truthy: func(a *model.AthleteActivity) bool { return a.Commute }}},
+		{[]string{"trainer"}, field{kind: kindBool, truthy: func(a *model.AthleteActivity) bool { return a.Trainer }}},
+		{[]string{"manual"}, field{kind: kindBool, truthy: func(a *model.AthleteActivity) bool { return a.Manual }}},
+		{[]string{"private"}, field{kind: kindBool, truthy: func(a *model.AthleteActivity) bool { return a.Private }}},
+		{[]string{"has_hr"}, field{kind: kindBool, truthy: func(a *model.AthleteActivity) bool { return a.HasHeartrate }}},
+		{[]string{"has_power"}, field{kind: kindBool, truthy: func(a *model.AthleteActivity) bool { return a.AverageWatts != nil }}},
+	} {
+		for _, name := range f.names {
+			registered := f.field
+			registered.name = f.names[0]
+			fields[name] = &registered
+		}
+	}
+}
+
+func lookupField(name string) (*field, bool) {
+	f, ok := fields[strings.ToLower(name)]
+	return f, ok
+}
+
+// FieldNames lists the fields a query can use, without aliases.
+func FieldNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, f := range fields {
+		if !seen[f.name] {
+			seen[f.name] = true
+			names = append(names, f.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// literal is a parsed value. Numeric kinds are normalised into value; dayPrecision marks a date
+// given without a time of day.
+type literal struct {
+	text         string
+	value        float64
+	dayPrecision bool
+	truth        bool
+	sports       sport.Set
+}
+
+var distanceUnits = map[string]float64{"m": 1, "km": 1000, "mi": 1609.344, "ft": 0.3048, "yd": 0.9144}
+
+var speedUnits = map[string]float64{"kmh": 1 / 3.6, "km/h": 1 / 3.6, "kph": 1 / 3.6, "mph": 1609.344 / 3600, "m/s": 1}
+
+// parseLiteral converts a literal with an optional unit into the field's storage unit. Bare
+// numbers use the unit the tools display: km for distance, m for elevation, minutes for
+// durations, km/h for speed and min/km for pace.
+func parseLiteral(f *field, text string) (literal, error) {
+	switch f.kind {
+	case kindString:
+		return literal{text: text}, nil
+	case kindSport:
+		sports, err := sport.Resolve(text)
+		if err != nil {
+			return literal{}, err
+		}
+		return literal{text: text, sports: sports}, nil
+	case kindBool:
+		switch strings.ToLower(text) {
+		case "true", "yes":
+			return literal{text: text, truth: true}, nil
+		case "false", "no":
+			return literal{text: text}, nil
+		}
+		return literal{}, fmt.Errorf("%s expects true or false, got %q", f.name, text)
+	case kindDate:
+		if t, err := time.Parse("2006-01-02", text); err == nil {
+			return literal{text: text, value: float64(t.Unix()), dayPrecision: true}, nil
+		}
+		if t, err := time.Parse(time.RFC3339, text); err == nil {
+			return literal{text: text, value: float64(t.Unix())}, nil
+		}
+		return literal{}, fmt.Errorf("%s expects a date such as 2024-06-01, got %q", f.name, text)
+	case kindDuration:
+		value, err := parseDuration(text)
+		if err != nil {
+			return literal{}, fmt.Errorf("%s expects a duration such as 45min, 1h30m or 1:30:00, got %q", f.name, text)
+		}
+		return literal{text: text, value: value}, nil
+	case kindPace:
+		value, err := parsePace(text)
+		if err != nil {
+			return literal{}, fmt.Errorf("%s expects a pace such as 5:00/km or 8:30/mi, got %q", f.name, text)
+		}
+		return literal{text: text, value: value}, nil
+	}
+
+	number, unit := splitUnit(text)
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return literal{}, fmt.Errorf("%s expects a number, got %q", f.name, text)
+	}
+	var units map[string]float64
+	defaultUnit := ""
+	switch f.kind {
+	case kindDistance:
+		units, defaultUnit = distanceUnits, "km"
+	case kindElevation:
+		units, defaultUnit = distanceUnits, "m"
+	case kindSpeed:
+		units, defaultUnit = speedUnits, "kmh"
+	}
+	if unit == "" {
+		unit = defaultUnit
+	}
+	if unit == "" {
+		return literal{text: text, value: value}, nil
+	}
+	factor, ok := units[strings.ToLower(unit)]
+	if !ok {
+		return literal{}, fmt.Errorf("unknown unit %q for %s", unit, f.name)
+	}
+	return literal{text: text, value: value * factor}, nil
+}
+
+// splitUnit separates a leading number from a trailing unit, e.g. "10.5km".
+func splitUnit(text string) (string, string) {
+	i := 0
+	for i < len(text) && (text[i] >= '0' && text[i] <= '9' || text[i] == '.' || text[i] == '-' || text[i] == '+') {
+		i++
+	}
+	return text[:i], text[i:]
+}
+
+// parseDuration accepts Go durations (1h30m, 90s), minutes (45min, 45) and clock times
+// (1:30:00, 45:00) and returns seconds.
+func parseDuration(text string) (float64, error) {
+	if strings.Contains(text, ":") {
+		return parseClock(text)
+	}
+	lower := strings.ToLower(text)
+	if number, unit := splitUnit(lower); unit == "" || unit == "min" || unit == "mins" {
+		minutes, err := strconv.ParseFloat(number, 64)
+		return minutes * 60, err
+	}
+	d, err := time.ParseDuration(lower)
+	return d.Seconds(), err
+}
+
+// parsePace accepts m:ss per km or mile ("5:00/km", "8:30/mi", "5:00") and returns seconds per km.
+func parsePace(text string) (float64, error) {
+	clock, unit, _ := strings.Cut(strings.ToLower(text), "/")
+	seconds, err := parseClock(clock)
+	if err != nil {
+		return 0, err
+	}
+	switch unit {
+	case "", "km":
+		return seconds, nil
+	case "mi":
+		return seconds / 1.609344, nil
+	}
+	return 0, fmt.Errorf("unknown pace unit %q", unit)
+}
+
+func parseClock(text string) (float64, error) {
+	parts := strings.Split(text, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", text)
+	}
+	var seconds float64
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid time %q", text)
+		}
+		seconds = seconds*60 + value
+	}
+	if math.IsNaN(seconds) {
+		return 0, fmt.Errorf("invalid time %q", text)
+	}
+	return seconds, nil
+}
+
+func optionalString(v *string) (string, bool) {
+	if v == nil || *v == "" {
+		return "", false
+	}
+	return *v, true
+}
+
+func optionalFloat(v *float64) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	return *v, true
+}
+
+func optionalInt(v *int) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	return float64(*v), true
+}
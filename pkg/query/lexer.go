@@ -0,0 +1,91 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits an expression into words, quoted strings, operators and punctuation. Words run
+// until whitespace or a delimiter, so literals such as 10km, 5:00/km and 2024-06-01 stay whole.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			var text strings.Builder
+			i++
+			for i < len(input) && input[i] != c {
+				if input[i] == '\\' && i+1 < len(input) {
+					i++
+				}
+				text.WriteByte(input[i])
+				i++
+			}
+			if i >= len(input) {
+				return nil, &Error{Pos: start, Msg: "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, token{tokenString, text.String(), start})
+		case strings.IndexByte("<>=!~", c) >= 0:
+			start := i
+			i++
+			if i < len(input) && (input[i] == '=' && c != '=' && c != '~' || input[i] == '~' && c == '!') {
+				i++
+			}
+			op := input[start:i]
+			if op == "!" {
+				return nil, &Error{Pos: start, Msg: "unexpected '!', use != or not"}
+			}
+			tokens = append(tokens, token{tokenOperator, op, start})
+		default:
+			start := i
+			for i < len(input) && strings.IndexByte(" \t\n\r(),\"'<>=!~", input[i]) < 0 {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, input[start:i], start})
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(input)}), nil
+}
+
+// Error is a syntax or type error in a query, with the byte offset where it was found.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos+1, e.Msg)
+}
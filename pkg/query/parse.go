@@ -0,0 +1,368 @@
+package query
+
+import (
+	"fmt"
+	"stravamcp/model"
+	"strconv"
+	"strings"
+)
+
+type expr interface {
+	match(a *model.AthleteActivity) bool
+}
+
+type andExpr struct{ left, right expr }
+
+func (e andExpr) match(a *model.AthleteActivity) bool { return e.left.match(a) && e.right.match(a) }
+
+type orExpr struct{ left, right expr }
+
+func (e orExpr) match(a *model.AthleteActivity) bool { return e.left.match(a) || e.right.match(a) }
+
+type notExpr struct{ inner expr }
+
+func (e notExpr) match(a *model.AthleteActivity) bool { return !e.inner.match(a) }
+
+// compareExpr compares a field with a literal. Activities without a value for the field never
+// match, whatever the operator.
+type compareExpr struct {
+	field *field
+	op    string
+	lit   literal
+}
+
+const day = 24 * 60 * 60
+
+func (e compareExpr) match(a *model.AthleteActivity) bool {
+	switch e.field.kind {
+	case kindBool:
+		equal := e.field.truthy(a) == e.lit.truth
+		return equal == (e.op == "=")
+	case kindSport:
+		return e.lit.sports.Contains(a) == (e.op == "=")
+	case kindString:
+		value, ok := e.field.str(a)
+		if !ok {
+			return false
+		}
+		switch e.op {
+		case "~":
+			return strings.Contains(strings.ToLower(value), strings.ToLower(e.lit.text))
+		case "!~":
+			return !strings.Contains(strings.ToLower(value), strings.ToLower(e.lit.text))
+		case "!=":
+			return !strings.EqualFold(value, e.lit.text)
+		}
+		return strings.EqualFold(value, e.lit.text)
+	}
+
+	value, ok := e.field.num(a)
+	if !ok {
+		return false
+	}
+	low, high := e.lit.value, e.lit.value
+	if e.lit.dayPrecision {
+		// A date covers the whole day: date = 2024-06-01 matches any time on that day.
+		high = low + day
+		switch e.op {
+		case "=":
+			return value >= low && value < high
+		case "!=":
+			return value < low || value >= high
+		case "<=":
+			return value < high
+		case ">":
+			return value >= high
+		}
+	}
+	switch e.op {
+	case "=":
+		return value == low
+	case "!=":
+		return value != low
+	case "<":
+		return value < low
+	case "<=":
+		return value <= low
+	case ">":
+		return value > low
+	case ">=":
+		return value >= low
+	}
+	return false
+}
+
+type inExpr struct {
+	field    *field
+	literals []literal
+}
+
+func (e inExpr) match(a *model.AthleteActivity) bool {
+	for _, lit := range e.literals {
+		if (compareExpr{field: e.field, op: "=", lit: lit}).match(a) {
+			return true
+		}
+	}
+	return false
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword reports whether the next token is the given case-insensitive keyword and consumes it.
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokenWord && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &Error{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func describe(t token) string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// parseQuery parses [condition] [sort by field [asc|desc], ...] [limit n].
+func (p *parser) parseQuery() (*Query, error) {
+	q := &Query{}
+	if !p.atClause() {
+		where, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		q.where = where
+	}
+	if p.keyword("sort") || p.keyword("order") {
+		p.keyword("by")
+		for {
+			t := p.next()
+			f, ok := lookupField(t.text)
+			if t.kind != tokenWord || !ok {
+				return nil, p.errorf(t, "expected a field to sort by, got %s", describe(t))
+			}
+			key := sortKey{field: f}
+			if p.keyword("desc") {
+				key.descending = true
+			} else {
+				p.keyword("asc")
+			}
+			q.sort = append(q.sort, key)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.keyword("limit") {
+		t := p.next()
+		limit, err := strconv.Atoi(t.text)
+		if t.kind != tokenWord || err != nil || limit <= 0 {
+			return nil, p.errorf(t, "limit expects a positive number, got %s", describe(t))
+		}
+		q.limit = limit
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s, expected and, or, sort by or limit", describe(t))
+	}
+	return q, nil
+}
+
+func (p *parser) atClause() bool {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return true
+	}
+	if t.kind != tokenWord {
+		return false
+	}
+	switch strings.ToLower(t.text) {
+	case "sort", "order", "limit":
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.keyword("not") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner}, nil
+	}
+	if p.peek().kind == tokenLParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenRParen {
+			return nil, p.errorf(t, "expected ')', got %s", describe(t))
+		}
+		return inner, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *parser) parseCondition() (expr, error) {
+	t := p.next()
+	if t.kind != tokenWord {
+		return nil, p.errorf(t, "expected a field, got %s", describe(t))
+	}
+	f, ok := lookupField(t.text)
+	if !ok {
+		return nil, p.errorf(t, "unknown field %q (fields: %s)", t.text, strings.Join(FieldNames(), ", "))
+	}
+
+	negate := false
+	if p.peek().kind == tokenWord && strings.EqualFold(p.peek().text, "not") && p.pos+1 < len(p.tokens) &&
+		strings.EqualFold(p.tokens[p.pos+1].text, "in") {
+		p.next()
+		negate = true
+	}
+	if p.keyword("in") {
+		in, err := p.parseList(f)
+		if err != nil {
+			return nil, err
+		}
+		if negate {
+			return notExpr{in}, nil
+		}
+		return in, nil
+	}
+
+	opToken := p.peek()
+	if opToken.kind != tokenOperator {
+		if f.kind == kindBool {
+			return compareExpr{field: f, op: "=", lit: literal{text: "true", truth: true}}, nil
+		}
+		return nil, p.errorf(opToken, "expected an operator after %s, got %s", f.name, describe(opToken))
+	}
+	p.next()
+	op := opToken.text
+	switch {
+	case (op == "~" || op == "!~") && f.kind != kindString:
+		return nil, p.errorf(opToken, "%s only applies to text fields, not %s", op, f.name)
+	case (f.kind == kindString || f.kind == kindBool || f.kind == kindSport) && op != "=" && op != "!=" && op != "~" && op != "!~":
+		return nil, p.errorf(opToken, "%s cannot be compared with %s", f.name, op)
+	}
+	lit, err := p.parseValue(f)
+	if err != nil {
+		return nil, err
+	}
+	return compareExpr{field: f, op: op, lit: lit}, nil
+}
+
+func (p *parser) parseList(f *field) (expr, error) {
+	if t := p.next(); t.kind != tokenLParen {
+		return nil, p.errorf(t, "expected '(' after in, got %s", describe(t))
+	}
+	in := inExpr{field: f}
+	for {
+		lit, err := p.parseValue(f)
+		if err != nil {
+			return nil, err
+		}
+		in.literals = append(in.literals, lit)
+		t := p.next()
+		if t.kind == tokenRParen {
+			return in, nil
+		}
+		if t.kind != tokenComma {
+			return nil, p.errorf(t, "expected ',' or ')', got %s", describe(t))
+		}
+	}
+}
+
+// parseValue reads a literal for the field. A unit may follow a number as a separate word, so
+// "10 km" reads the same as "10km".
+func (p *parser) parseValue(f *field) (literal, error) {
+	t := p.next()
+	if t.kind != tokenWord && t.kind != tokenString {
+		return literal{}, p.errorf(t, "expected a value for %s, got %s", f.name, describe(t))
+	}
+	text := t.text
+	if t.kind == tokenWord && f.kind != kindString && f.kind != kindSport && f.kind != kindBool && f.kind != kindDate {
+		if unit := p.peek(); unit.kind == tokenWord && isUnit(f.kind, unit.text) {
+			if number, suffix := splitUnit(text); number != "" && suffix == "" {
+				text += unit.text
+				p.next()
+			}
+		}
+	}
+	lit, err := parseLiteral(f, text)
+	if err != nil {
+		return literal{}, &Error{Pos: t.pos, Msg: err.Error()}
+	}
+	return lit, nil
+}
+
+func isUnit(k kind, word string) bool {
+	word = strings.ToLower(word)
+	switch k {
+	case kindDistance, kindElevation:
+		_, ok := distanceUnits[word]
+		return ok
+	case kindSpeed:
+		_, ok := speedUnits[word]
+		return ok
+	case kindDuration:
+		switch word {
+		case "h", "m", "s", "min", "mins":
+			return true
+		}
+	}
+	return false
+}
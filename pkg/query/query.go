@@ -0,0 +1,143 @@
+// Package query implements the filter language of get_activities and GET /api/activities, e.g.
+//
+//	sport_type in (Run, TrailRun) and distance > 10km and avg_hr < 150 and name ~ "tempo"
+//	sort by distance desc limit 5
+//
+// Conditions compare a field with a literal (=, !=, <, <=, >, >=), test string fields for a
+// case-insensitive substring (~, !~) or for membership (in, not in), and combine with and, or,
+// not and parentheses. Boolean fields such as commute can be used on their own. Literals carry
+// optional units (10km, 6.2mi, 500ft, 1h30m, 25kmh, 5:00/km) and dates are written 2024-06-01.
+package query
+
+import (
+	"sort"
+	"stravamcp/model"
+	"strings"
+)
+
+// Query is a parsed expression. A nil Query matches every activity and keeps the order.
+type Query struct {
+	text  string
+	where expr
+	sort  []sortKey
+	limit int
+}
+
+type sortKey struct {
+	field      *field
+	descending bool
+}
+
+// Parse parses an expression once so it can be applied to any number of activity lists. An
+// empty expression returns a nil Query.
+func Parse(text string) (*Query, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	tokens, err := lex(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	q, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	q.text = strings.TrimSpace(text)
+	return q, nil
+}
+
+func (q *Query) String() string {
+	if q == nil {
+		return ""
+	}
+	return q.text
+}
+
+// Limit is the maximum number of activities to return, 0 when unlimited.
+func (q *Query) Limit() int {
+	if q == nil {
+		return 0
+	}
+	return q.limit
+}
+
+// Match reports whether the activity satisfies the conditions of the query.
+func (q *Query) Match(activity *model.AthleteActivity) bool {
+	if q == nil || q.where == nil {
+		return true
+	}
+	return q.where.match(activity)
+}
+
+// Apply returns the matching activities, sorted and limited as requested. Activities that sort
+// equal keep their incoming order, and activities missing a sort field come last.
+func (q *Query) Apply(activities []model.AthleteActivity) []model.AthleteActivity {
+	if q == nil {
+		return activities
+	}
+	matched := make([]model.AthleteActivity, 0, len(activities))
+	for i := range activities {
+		if q.Match(&activities[i]) {
+			matched = append(matched, activities[i])
+		}
+	}
+	if len(q.sort) > 0 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			for _, key := range q.sort {
+				if c := key.compare(&matched[i], &matched[j]); c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+	if q.limit > 0 && len(matched) > q.limit {
+		matched = matched[:q.limit]
+	}
+	return matched
+}
+
+func (k sortKey) compare(a, b *model.AthleteActivity) int {
+	var c int
+	var okA, okB bool
+	switch k.field.kind {
+	case kindString, kindSport:
+		var x, y string
+		x, okA = k.field.str(a)
+		y, okB = k.field.str(b)
+		c = strings.Compare(strings.ToLower(x), strings.ToLower(y))
+	case kindBool:
+		x, y := k.field.truthy(a), k.field.truthy(b)
+		okA, okB = true, true
+		switch {
+		case x == y:
+		case !x:
+			c = -1
+		default:
+			c = 1
+		}
+	default:
+		var x, y float64
+		x, okA = k.field.num(a)
+		y, okB = k.field.num(b)
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	}
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return 1
+	case !okB:
+		return -1
+	}
+	if k.descending {
+		return -c
+	}
+	return c
+}
@@ -0,0 +1,96 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"stravamcp/model"
+	"testing"
+)
+
+func testActivities() []model.AthleteActivity {
+	return []model.AthleteActivity{
+		{ID: 1, Name: "Easy run", SportType: "Run", Distance: 5000, AverageSpeed: 1000.0 / 330, MovingTime: 1650, StartDateLocal: "2024-06-01T07:00:00Z"},
+		{ID: 2, Name: "Tempo run", SportType: "Run", Distance: 10000, AverageSpeed: 1000.0 / 270, MovingTime: 2700, StartDateLocal: "2024-06-01T23:30:00Z"},
+		{ID: 3, Name: "Gravel loop", SportType: "GravelRide", Distance: 40000, AverageSpeed: 8, MovingTime: 5400, StartDateLocal: "2024-06-02T06:00:00Z"},
+		{ID: 4, Name: "Long run", SportType: "TrailRun", Distance: 10100, AverageSpeed: 1000.0 / 360, MovingTime: 3636, StartDateLocal: "2024-05-31T18:00:00Z"},
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"", []int64{1, 2, 3, 4}},
+		{"distance > 10km", []int64{3, 4}},
+		{"distance >= 10 km", []int64{2, 3, 4}},
+		{"distance > 6.2mi", []int64{2, 3, 4}},
+		{"distance < 6.2mi", []int64{1}},
+		{"pace < 5:00/km", []int64{2, 3}},
+		{"pace <= 5:30", []int64{1, 2, 3}},
+		{"pace > 9:00/mi", []int64{4}},
+		{"moving_time >= 1h30m", []int64{3}},
+		{"moving_time < 1h30m and moving_time > 45min", []int64{4}},
+		{"sport_type in (Run, TrailRun)", []int64{1, 2, 4}},
+		{"sport_type not in (Run, TrailRun)", []int64{3}},
+		{"distance in (5km, 40km)", []int64{1, 3}},
+		{"name ~ \"RUN\" and not sport_type = TrailRun", []int64{1, 2}},
+		{"date = 2024-06-01", []int64{1, 2}},
+		{"date != 2024-06-01", []int64{3, 4}},
+		{"date > 2024-06-01", []int64{3}},
+		{"date >= 2024-06-01", []int64{1, 2, 3}},
+		{"date < 2024-06-01", []int64{4}},
+		{"date <= 2024-06-01", []int64{1, 2, 4}},
+		{"sort by distance desc", []int64{3, 4, 2, 1}},
+		{"sort by sport_type, distance desc", []int64{3, 2, 1, 4}},
+		{"sport_type != GravelRide sort by pace limit 2", []int64{2, 1}},
+		{"sport_type = Run sort by date desc limit 1", []int64{2}},
+		{"limit 3", []int64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []int64{}
+			for _, a := range q.Apply(testActivities()) {
+				got = append(got, a.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{"bogus = 1", 0},
+		{"name < \"tempo\"", 5},
+		{"name ~ \"tempo", 7},
+		{"distance > 10parsecs", 11},
+		{"pace < 5:00/yd", 7},
+		{"date = 2024-13-01", 7},
+		{"sport_type in (Run, Ride", 24},
+		{"commute ! trainer", 8},
+		{"sort by bogus", 8},
+		{"distance > 10km limit 0", 22},
+		{"distance > 10km avg_hr < 150", 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			var queryErr *Error
+			if !errors.As(err, &queryErr) {
+				t.Fatalf("got error %v, want a *Error", err)
+			}
+			if queryErr.Pos != tt.pos {
+				t.Errorf("error at %d, want %d: %v", queryErr.Pos, tt.pos, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package sport maps the names people use for sports ("runs", "cycling", "xc ski") onto Strava
+// sport types.
+package sport
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"stravamcp/model"
+	"strings"
+)
+
+var ErrUnknown = errors.New("unknown sport")
+
+// Set is a set of Strava sport types such as GravelRide or TrailRun.
+type Set map[string]bool
+
+// groups lists the sport types of each group. A group is found by its name, its singular and
+// any alias below; every sport type also resolves to itself unless a group has its name.
+var groups = map[string][]string{
+	"cycling":  {"Ride", "VirtualRide", "GravelRide", "MountainBikeRide", "EBikeRide", "EMountainBikeRide", "Velomobile", "Handcycle"},
+	"running":  {"Run", "TrailRun", "VirtualRun"},
+	"swimming": {"Swim"},
+	"walking":  {"Walk", "Hike"},
+	"skiing":   {"AlpineSki", "BackcountrySki", "NordicSki", "RollerSki", "Snowboard"},
+	"winter":   {"AlpineSki", "BackcountrySki", "NordicSki", "Snowboard", "Snowshoe", "IceSkate"},
+	"paddling": {"Canoeing", "Kayaking", "StandUpPaddling"},
+	"rowing":   {"Rowing", "VirtualRow"},
+	"water":    {"Canoeing", "Kayaking", "Kitesurf", "Rowing", "Sail", "StandUpPaddling", "Surfing", "Swim", "Windsurf"},
+	"fitness":  {"Crossfit", "Elliptical", "HighIntensityIntervalTraining", "Pilates", "StairStepper", "WeightTraining", "Workout", "Yoga"},
+	"racket":   {"Badminton", "Pickleball", "Racquetball", "Squash", "TableTennis", "Tennis"},
+	"skating":  {"IceSkate", "InlineSkate", "Skateboard"},
+	"virtual":  {"VirtualRide", "VirtualRun", "VirtualRow"},
+}
+
+var aliases = map[string]string{
+	"ride": "cycling", "rides": "cycling", "bike": "cycling", "bikes": "cycling", "biking": "cycling", "cycle": "cycling", "bicycle": "cycling",
+	"run": "running", "runs": "running", "jog": "running", "jogging": "running",
+	"swim": "swimming", "swims": "swimming",
+	"walk": "walking", "walks": "walking", "hike": "walking", "hikes": "walking", "hiking": "walking",
+	"ski": "skiing", "skis": "skiing", "paddle": "paddling", "row": "rowing", "rows": "rowing",
+	"gym": "fitness", "workouts": "fitness", "strength": "fitness",
+	"racquet": "racket", "indoor": "virtual",
+}
+
+// typeAliases maps colloquial and legacy names onto a single sport type.
+var typeAliases = map[string]string{
+	"gravel": "GravelRide", "mtb": "MountainBikeRide", "mountainbike": "MountainBikeRide", "mountainbiking": "MountainBikeRide",
+	"ebike": "EBikeRide", "emtb": "EMountainBikeRide", "zwift": "VirtualRide", "indoorride": "VirtualRide", "turbo": "VirtualRide",
+	"trail": "TrailRun", "trailrunning": "TrailRun", "treadmill": "VirtualRun", "indoorrun": "VirtualRun",
+	"xcski": "NordicSki", "crosscountryski": "NordicSki", "crosscountryskiing": "NordicSki", "skitouring": "BackcountrySki",
+	"downhill": "AlpineSki", "snowboarding": "Snowboard", "snowshoeing": "Snowshoe", "iceskating": "IceSkate",
+	"sup": "StandUpPaddling", "kayak": "Kayaking", "canoe": "Canoeing", "surf": "Surfing", "kitesurfing": "Kitesurf",
+	"windsurfing": "Windsurf", "sailing": "Sail", "climbing": "RockClimbing", "bouldering": "RockClimbing",
+	"weights": "WeightTraining", "weighttraining": "WeightTraining", "hiit": "HighIntensityIntervalTraining",
+	"stairs": "StairStepper", "inlineskating": "InlineSkate", "rollerblading": "InlineSkate", "skateboarding": "Skateboard",
+	"football": "Soccer", "pingpong": "TableTennis",
+}
+
+// types are the sport types Strava documents, besides the ones already listed in groups.
+var types = []string{"Golf", "RockClimbing", "Soccer", "Wheelchair"}
+
+var canonical = map[string]string{}
+
+func init() {
+	for _, members := range groups {
+		for _, sportType := range members {
+			canonical[normalize(sportType)] = sportType
+		}
+	}
+	for _, sportType := range types {
+		canonical[normalize(sportType)] = sportType
+	}
+}
+
+func normalize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '_', '-', '.':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// Resolve returns the sport types a name stands for. Names are matched case-insensitively and
+// ignoring spaces, dashes and underscores, so "Gravel Ride", "gravel_ride" and "GravelRide" are
+// the same. Group names ("cycling", "rides", "runs") take precedence over the sport type of the
+// same name; use the query language's sport_type field to select plain Ride or Run.
+func Resolve(name string) (Set, error) {
+	key := normalize(name)
+	if group, ok := aliases[key]; ok {
+		key = group
+	}
+	if members, ok := groups[key]; ok {
+		return newSet(members...), nil
+	}
+	if sportType, ok := typeAliases[key]; ok {
+		return newSet(sportType), nil
+	}
+	if sportType, ok := canonical[key]; ok {
+		return newSet(sportType), nil
+	}
+	if singular := strings.TrimSuffix(key, "s"); singular != key {
+		return Resolve(singular)
+	}
+	return nil, fmt.Errorf("%w %q (try a Strava sport type such as GravelRide or a group: %s)", ErrUnknown, name, strings.Join(Groups(), ", "))
+}
+
+// Groups returns the names of the sport groups.
+func Groups() []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newSet(sportTypes ...string) Set {
+	set := make(Set, len(sportTypes))
+	for _, sportType := range sportTypes {
+		set[sportType] = true
+	}
+	return set
+}
+
+// Of returns the sport type of an activity. Activities cached before Strava introduced
+// sport_type only carry the legacy type, which names the same sport for those activities.
+func Of(activity *model.AthleteActivity) string {
+	if activity.SportType != "" {
+		return activity.SportType
+	}
+	return activity.Type
+}
+
+// Contains reports whether the activity's sport type is in the set.
+func (s Set) Contains(activity *model.AthleteActivity) bool {
+	return s[Of(activity)]
+}
@@ -0,0 +1,55 @@
+package sport
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"GravelRide", []string{"GravelRide"}},
+		{"gravel_ride", []string{"GravelRide"}},
+		{"Gravel Ride", []string{"GravelRide"}},
+		{"gravel", []string{"GravelRide"}},
+		{"zwift", []string{"VirtualRide"}},
+		{"xc ski", []string{"NordicSki"}},
+		{"Golf", []string{"Golf"}},
+		{"running", []string{"Run", "TrailRun", "VirtualRun"}},
+		{"runs", []string{"Run", "TrailRun", "VirtualRun"}},
+		{"Run", []string{"Run", "TrailRun", "VirtualRun"}},
+		{"hikes", []string{"Hike", "Walk"}},
+		{"swims", []string{"Swim"}},
+		{"rowing", []string{"Rowing", "VirtualRow"}},
+		{"virtual", []string{"VirtualRide", "VirtualRow", "VirtualRun"}},
+		{"TrailRuns", []string{"TrailRun"}},
+		{"kayaks", []string{"Kayaking"}},
+		{"cycling", []string{"EBikeRide", "EMountainBikeRide", "GravelRide", "Handcycle", "MountainBikeRide", "Ride", "Velomobile", "VirtualRide"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := Resolve(tt.name)
+			if err != nil {
+				t.Fatalf("Resolve(%q) failed: %v", tt.name, err)
+			}
+			if got := slices.Sorted(maps.Keys(set)); !slices.Equal(got, tt.want) {
+				t.Errorf("Resolve(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveUnknown(t *testing.T) {
+	for _, name := range []string{"", "s", "quidditch", "runz", "bikeride"} {
+		t.Run(name, func(t *testing.T) {
+			set, err := Resolve(name)
+			if !errors.Is(err, ErrUnknown) {
+				t.Errorf("Resolve(%q) = %v, %v, want ErrUnknown", name, set, err)
+			}
+		})
+	}
+}
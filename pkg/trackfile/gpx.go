@@ -0,0 +1,94 @@
+package trackfile
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type gpxFile struct {
+	Metadata struct {
+		Name string `xml:"name"`
+		Time string `xml:"time"`
+	} `xml:"metadata"`
+	Tracks []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name     string `xml:"name"`
+	Type     string `xml:"type"`
+	Segments []struct {
+		Points []gpxPoint `xml:"trkpt"`
+	} `xml:"trkseg"`
+}
+
+type gpxPoint struct {
+	Lat        float64  `xml:"lat,attr"`
+	Lon        float64  `xml:"lon,attr"`
+	Ele        *float64 `xml:"ele"`
+	Time       string   `xml:"time"`
+	Extensions struct {
+		Power      *float64 `xml:"power"`
+		PowerInW   *float64 `xml:"PowerInWatts"`
+		TrackPoint struct {
+			Heartrate *float64 `xml:"hr"`
+			Cadence   *float64 `xml:"cad"`
+			Temp      *float64 `xml:"atemp"`
+		} `xml:"TrackPointExtension"`
+	} `xml:"extensions"`
+}
+
+// ParseGPX decodes a GPX 1.1 activity, reading heart rate, cadence and temperature from the
+// Garmin TrackPointExtension and power from the <power> or Garmin PowerExtension element. Points without a timestamp are skipped.
+func ParseGPX(r io.Reader) (*Track, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var file gpxFile
+	// Strava's exported files can carry whitespace before the XML declaration, which encoding/xml rejects.
+	if err := xml.Unmarshal(bytes.TrimSpace(data), &file); err != nil {
+		return nil, fmt.Errorf("failed to decode GPX: %w", err)
+	}
+
+	track := &Track{Name: file.Metadata.Name}
+	var points []Point
+	for _, trk := range file.Tracks {
+		if track.Name == "" {
+			track.Name = trk.Name
+		}
+		if track.Sport == "" {
+			track.Sport = trk.Type
+		}
+		for _, segment := range trk.Segments {
+			for _, trkpt := range segment.Points {
+				timestamp, err := time.Parse(time.RFC3339Nano, trkpt.Time)
+				if err != nil {
+					continue
+				}
+				watts := trkpt.Extensions.Power
+				if watts == nil {
+					watts = trkpt.Extensions.PowerInW
+				}
+				points = append(points, Point{
+					Time:      timestamp,
+					Lat:       float(trkpt.Lat),
+					Lng:       float(trkpt.Lon),
+					Altitude:  trkpt.Ele,
+					Heartrate: trkpt.Extensions.TrackPoint.Heartrate,
+					Cadence:   trkpt.Extensions.TrackPoint.Cadence,
+					Temp:      trkpt.Extensions.TrackPoint.Temp,
+					Watts:     watts,
+				})
+			}
+		}
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("GPX file has no timed track points")
+	}
+	track.StartTime = points[0].Time
+	track.Streams = BuildStreams(points)
+	return track, nil
+}
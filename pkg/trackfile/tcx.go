@@ -0,0 +1,88 @@
+package trackfile
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type tcxFile struct {
+	Activities []tcxActivity `xml:"Activities>Activity"`
+}
+
+type tcxActivity struct {
+	Sport string `xml:"Sport,attr"`
+	ID    string `xml:"Id"`
+	Laps  []struct {
+		Trackpoints []tcxTrackpoint `xml:"Track>Trackpoint"`
+	} `xml:"Lap"`
+}
+
+type tcxTrackpoint struct {
+	Time     string `xml:"Time"`
+	Position *struct {
+		Lat float64 `xml:"LatitudeDegrees"`
+		Lng float64 `xml:"LongitudeDegrees"`
+	} `xml:"Position"`
+	Altitude   *float64 `xml:"AltitudeMeters"`
+	Distance   *float64 `xml:"DistanceMeters"`
+	Heartrate  *float64 `xml:"HeartRateBpm>Value"`
+	Cadence    *float64 `xml:"Cadence"`
+	Extensions struct {
+		Speed      *float64 `xml:"TPX>Speed"`
+		Watts      *float64 `xml:"TPX>Watts"`
+		RunCadence *float64 `xml:"TPX>RunCadence"`
+	} `xml:"Extensions"`
+}
+
+// ParseTCX decodes the first activity of a Garmin Training Center file.
+func ParseTCX(r io.Reader) (*Track, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var file tcxFile
+	if err := xml.Unmarshal(bytes.TrimSpace(data), &file); err != nil {
+		return nil, fmt.Errorf("failed to decode TCX: %w", err)
+	}
+	if len(file.Activities) == 0 {
+		return nil, fmt.Errorf("TCX file has no activities")
+	}
+
+	activity := file.Activities[0]
+	track := &Track{Sport: activity.Sport}
+	var points []Point
+	for _, lap := range activity.Laps {
+		for _, trackpoint := range lap.Trackpoints {
+			timestamp, err := time.Parse(time.RFC3339Nano, trackpoint.Time)
+			if err != nil {
+				continue
+			}
+			point := Point{
+				Time:      timestamp,
+				Altitude:  trackpoint.Altitude,
+				Distance:  trackpoint.Distance,
+				Heartrate: trackpoint.Heartrate,
+				Cadence:   trackpoint.Cadence,
+				Speed:     trackpoint.Extensions.Speed,
+				Watts:     trackpoint.Extensions.Watts,
+			}
+			if point.Cadence == nil {
+				point.Cadence = trackpoint.Extensions.RunCadence
+			}
+			if trackpoint.Position != nil {
+				point.Lat = float(trackpoint.Position.Lat)
+				point.Lng = float(trackpoint.Position.Lng)
+			}
+			points = append(points, point)
+		}
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("TCX file has no timed track points")
+	}
+	track.StartTime = points[0].Time
+	track.Streams = BuildStreams(points)
+	return track, nil
+}
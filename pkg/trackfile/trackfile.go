@@ -0,0 +1,116 @@
+package trackfile
+
+import (
+	"stravamcp/model"
+	"stravamcp/pkg/geo"
+	"time"
+)
+
+// Track is a recorded activity file decoded into Strava-shaped streams.
+type Track struct {
+	Name      string
+	Sport     string
+	StartTime time.Time
+	Streams   *model.ActivityStreams
+}
+
+// Point is a single recorded sample. Nil fields were not recorded by the device.
+type Point struct {
+	Time      time.Time
+	Lat       *float64
+	Lng       *float64
+	Altitude  *float64
+	Distance  *float64
+	Speed     *float64
+	Heartrate *float64
+	Cadence   *float64
+	Watts     *float64
+	Temp      *float64
+}
+
+// BuildStreams converts points into activity streams with time in seconds from the first point.
+// Distance is accumulated from positions and speed derived from distance when the file lacks them.
+func BuildStreams(points []Point) *model.ActivityStreams {
+	streams := &model.ActivityStreams{}
+	if len(points) == 0 {
+		return streams
+	}
+
+	n := len(points)
+	timeData := make([]*float64, n)
+	distance := make([]*float64, n)
+	speed := make([]*float64, n)
+	altitude := make([]*float64, n)
+	heartrate := make([]*float64, n)
+	cadence := make([]*float64, n)
+	watts := make([]*float64, n)
+	temp := make([]*float64, n)
+	latlng := make([][]float64, n)
+
+	start := points[0].Time
+	var travelled float64
+	var lastLat, lastLng *float64
+	for i, point := range points {
+		offset := point.Time.Sub(start).Seconds()
+		timeData[i] = &offset
+
+		if point.Lat != nil && point.Lng != nil {
+			latlng[i] = []float64{*point.Lat, *point.Lng}
+			if lastLat != nil {
+				travelled += geo.Haversine(*lastLat, *lastLng, *point.Lat, *point.Lng)
+			}
+			lastLat, lastLng = point.Lat, point.Lng
+		}
+		if point.Distance != nil {
+			travelled = *point.Distance
+			distance[i] = point.Distance
+		} else if lastLat != nil {
+			d := travelled
+			distance[i] = &d
+		}
+
+		speed[i] = point.Speed
+		if speed[i] == nil && i > 0 && distance[i] != nil && distance[i-1] != nil {
+			if dt := offset - *timeData[i-1]; dt > 0 {
+				v := (*distance[i] - *distance[i-1]) / dt
+				speed[i] = &v
+			}
+		}
+
+		altitude[i] = point.Altitude
+		heartrate[i] = point.Heartrate
+		cadence[i] = point.Cadence
+		watts[i] = point.Watts
+		temp[i] = point.Temp
+	}
+
+	streams.Time = newStream(timeData)
+	streams.Distance = newStream(distance)
+	streams.VelocitySmooth = newStream(speed)
+	streams.Altitude = newStream(altitude)
+	streams.Heartrate = newStream(heartrate)
+	streams.Cadence = newStream(cadence)
+	streams.Watts = newStream(watts)
+	streams.Temp = newStream(temp)
+	for _, sample := range latlng {
+		if sample != nil {
+			streams.LatLng = &model.LatLngStreamData{Data: latlng, SeriesType: "time", OriginalSize: int32(n), Resolution: "high"}
+			break
+		}
+	}
+	return streams
+}
+
+// newStream returns nil when no sample was recorded, matching Strava which omits absent streams.
+func newStream(data []*float64) *model.StreamData {
+	for _, sample := range data {
+		if sample != nil {
+			return &model.StreamData{Data: data, SeriesType: "time", OriginalSize: int32(len(data)), Resolution: "high"}
+		}
+	}
+	return nil
+}
+
+func float(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,268 @@
+package trackfile
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"stravamcp/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatGPX Format = "gpx"
+	FormatTCX Format = "tcx"
+)
+
+func ParseFormat(value string) (Format, error) {
+	switch strings.ToLower(value) {
+	case "", "gpx":
+		return FormatGPX, nil
+	case "tcx":
+		return FormatTCX, nil
+	default:
+		return "", fmt.Errorf("unsupported format %q (use gpx or tcx)", value)
+	}
+}
+
+func (f Format) ContentType() string {
+	if f == FormatTCX {
+		return "application/vnd.garmin.tcx+xml"
+	}
+	return "application/gpx+xml"
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+
+// sample is one row of the cached streams with an absolute timestamp.
+type sample struct {
+	time      time.Time
+	latlng    []float64
+	altitude  *float64
+	distance  *float64
+	speed     *float64
+	heartrate *float64
+	cadence   *float64
+	watts     *float64
+	temp      *float64
+}
+
+func samples(activity *model.AthleteActivity, streams *model.ActivityStreams) ([]sample, error) {
+	start, err := time.Parse(time.RFC3339, activity.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("activity %d has no valid start date: %w", activity.ID, err)
+	}
+	if streams.Time == nil || len(streams.Time.Data) == 0 {
+		return nil, fmt.Errorf("activity %d has no time stream", activity.ID)
+	}
+
+	var result []sample
+	for i, offset := range streams.Time.Data {
+		if offset == nil {
+			continue
+		}
+		s := sample{
+			time:      start.Add(time.Duration(*offset * float64(time.Second))),
+			altitude:  at(streams.Altitude, i),
+			distance:  at(streams.Distance, i),
+			speed:     at(streams.VelocitySmooth, i),
+			heartrate: at(streams.Heartrate, i),
+			cadence:   at(streams.Cadence, i),
+			watts:     at(streams.Watts, i),
+			temp:      at(streams.Temp, i),
+		}
+		if streams.LatLng != nil && i < len(streams.LatLng.Data) && len(streams.LatLng.Data[i]) >= 2 {
+			s.latlng = streams.LatLng.Data[i]
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// WriteGPX writes a GPX 1.1 track. Heart rate, cadence and temperature use the Garmin
+// TrackPointExtension and power the Garmin PowerExtension. Samples without a position are
+// omitted because GPX track points require one.
+func WriteGPX(w io.Writer, activity *model.AthleteActivity, streams *model.ActivityStreams) error {
+	points, err := samples(activity, streams)
+	if err != nil {
+		return err
+	}
+
+	b := bufio.NewWriter(w)
+	b.WriteString(xmlHeader)
+	b.WriteString(`<gpx version="1.1" creator="strava-mcp" xmlns="http://www.topografix.com/GPX/1/1"` +
+		` xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"` +
+		` xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1"` +
+		` xmlns:gpxpx="http://www.garmin.com/xmlschemas/PowerExtension/v1"` +
+		` xsi:schemaLocation="http://www.topografix.com/GPX/1/1 http://www.topografix.com/GPX/1/1/gpx.xsd` +
+		` http://www.garmin.com/xmlschemas/TrackPointExtension/v1 http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd` +
+		` http://www.garmin.com/xmlschemas/PowerExtension/v1 http://www.garmin.com/xmlschemas/PowerExtensionv1.xsd">` + "\n")
+	fmt.Fprintf(b, " <metadata>\n  <name>%s</name>\n  <time>%s</time>\n </metadata>\n", escape(activity.Name), formatTime(points[0].time))
+	fmt.Fprintf(b, " <trk>\n  <name>%s</name>\n  <type>%s</type>\n  <trkseg>\n", escape(activity.Name), escape(sportOf(activity)))
+	for _, p := range points {
+		if p.latlng == nil {
+			continue
+		}
+		fmt.Fprintf(b, "   <trkpt lat=\"%s\" lon=\"%s\">\n", formatFloat(p.latlng[0], 7), formatFloat(p.latlng[1], 7))
+		if p.altitude != nil {
+			fmt.Fprintf(b, "    <ele>%s</ele>\n", formatFloat(*p.altitude, 1))
+		}
+		fmt.Fprintf(b, "    <time>%s</time>\n", formatTime(p.time))
+		if p.heartrate != nil || p.cadence != nil || p.temp != nil || p.watts != nil {
+			b.WriteString("    <extensions>\n")
+			if p.watts != nil {
+				fmt.Fprintf(b, "     <gpxpx:PowerInWatts>%d</gpxpx:PowerInWatts>\n", round(*p.watts))
+			}
+			if p.heartrate != nil || p.cadence != nil || p.temp != nil {
+				b.WriteString("     <gpxtpx:TrackPointExtension>\n")
+				if p.temp != nil {
+					fmt.Fprintf(b, "      <gpxtpx:atemp>%s</gpxtpx:atemp>\n", formatFloat(*p.temp, 1))
+				}
+				if p.heartrate != nil {
+					fmt.Fprintf(b, "      <gpxtpx:hr>%d</gpxtpx:hr>\n", round(*p.heartrate))
+				}
+				if p.cadence != nil {
+					fmt.Fprintf(b, "      <gpxtpx:cad>%d</gpxtpx:cad>\n", round(*p.cadence))
+				}
+				b.WriteString("     </gpxtpx:TrackPointExtension>\n")
+			}
+			b.WriteString("    </extensions>\n")
+		}
+		b.WriteString("   </trkpt>\n")
+	}
+	b.WriteString("  </trkseg>\n </trk>\n</gpx>\n")
+	return b.Flush()
+}
+
+// WriteTCX writes a single-lap Garmin Training Center activity. Speed, power and run cadence
+// go in the ActivityExtension TPX element.
+func WriteTCX(w io.Writer, activity *model.AthleteActivity, streams *model.ActivityStreams) error {
+	points, err := samples(activity, streams)
+	if err != nil {
+		return err
+	}
+	sport := tcxSport(activity)
+
+	b := bufio.NewWriter(w)
+	b.WriteString(xmlHeader)
+	b.WriteString(`<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"` +
+		` xmlns:ns3="http://www.garmin.com/xmlschemas/ActivityExtension/v2"` +
+		` xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"` +
+		` xsi:schemaLocation="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2 http://www.garmin.com/xmlschemas/TrainingCenterDatabasev2.xsd">` + "\n")
+	fmt.Fprintf(b, " <Activities>\n  <Activity Sport=\"%s\">\n   <Id>%s</Id>\n", sport, formatTime(points[0].time))
+	fmt.Fprintf(b, "   <Lap StartTime=\"%s\">\n", formatTime(points[0].time))
+
+	totalTime := float64(activity.ElapsedTime)
+	if totalTime == 0 {
+		totalTime = points[len(points)-1].time.Sub(points[0].time).Seconds()
+	}
+	fmt.Fprintf(b, "    <TotalTimeSeconds>%s</TotalTimeSeconds>\n", formatFloat(totalTime, 1))
+	fmt.Fprintf(b, "    <DistanceMeters>%s</DistanceMeters>\n", formatFloat(activity.Distance, 1))
+	if activity.MaxSpeed > 0 {
+		fmt.Fprintf(b, "    <MaximumSpeed>%s</MaximumSpeed>\n", formatFloat(activity.MaxSpeed, 3))
+	}
+	calories := 0
+	if activity.Kilojoules != nil {
+		// Cycling mechanical work in kJ is close to metabolic kcal at typical efficiency.
+		calories = round(*activity.Kilojoules)
+	}
+	fmt.Fprintf(b, "    <Calories>%d</Calories>\n", calories)
+	if activity.AverageHeartrate != nil {
+		fmt.Fprintf(b, "    <AverageHeartRateBpm>\n     <Value>%d</Value>\n    </AverageHeartRateBpm>\n", round(*activity.AverageHeartrate))
+	}
+	if activity.MaxHeartrate != nil {
+		fmt.Fprintf(b, "    <MaximumHeartRateBpm>\n     <Value>%d</Value>\n    </MaximumHeartRateBpm>\n", round(*activity.MaxHeartrate))
+	}
+	b.WriteString("    <Intensity>Active</Intensity>\n")
+	if activity.AverageCadence != nil && sport == "Biking" {
+		fmt.Fprintf(b, "    <Cadence>%d</Cadence>\n", round(*activity.AverageCadence))
+	}
+	b.WriteString("    <TriggerMethod>Manual</TriggerMethod>\n    <Track>\n")
+	for _, p := range points {
+		fmt.Fprintf(b, "     <Trackpoint>\n      <Time>%s</Time>\n", formatTime(p.time))
+		if p.latlng != nil {
+			fmt.Fprintf(b, "      <Position>\n       <LatitudeDegrees>%s</LatitudeDegrees>\n       <LongitudeDegrees>%s</LongitudeDegrees>\n      </Position>\n",
+				formatFloat(p.latlng[0], 7), formatFloat(p.latlng[1], 7))
+		}
+		if p.altitude != nil {
+			fmt.Fprintf(b, "      <AltitudeMeters>%s</AltitudeMeters>\n", formatFloat(*p.altitude, 1))
+		}
+		if p.distance != nil {
+			fmt.Fprintf(b, "      <DistanceMeters>%s</DistanceMeters>\n", formatFloat(*p.distance, 1))
+		}
+		if p.heartrate != nil && *p.heartrate >= 1 {
+			fmt.Fprintf(b, "      <HeartRateBpm>\n       <Value>%d</Value>\n      </HeartRateBpm>\n", round(*p.heartrate))
+		}
+		if p.cadence != nil && sport == "Biking" {
+			fmt.Fprintf(b, "      <Cadence>%d</Cadence>\n", min(round(*p.cadence), 254))
+		}
+		runCadence := p.cadence != nil && sport == "Running"
+		if p.speed != nil || p.watts != nil || runCadence {
+			b.WriteString("      <Extensions>\n       <ns3:TPX>\n")
+			if p.speed != nil {
+				fmt.Fprintf(b, "        <ns3:Speed>%s</ns3:Speed>\n", formatFloat(*p.speed, 3))
+			}
+			if runCadence {
+				fmt.Fprintf(b, "        <ns3:RunCadence>%d</ns3:RunCadence>\n", min(round(*p.cadence), 254))
+			}
+			if p.watts != nil {
+				fmt.Fprintf(b, "        <ns3:Watts>%d</ns3:Watts>\n", round(*p.watts))
+			}
+			b.WriteString("       </ns3:TPX>\n      </Extensions>\n")
+		}
+		b.WriteString("     </Trackpoint>\n")
+	}
+	b.WriteString("    </Track>\n   </Lap>\n  </Activity>\n </Activities>\n</TrainingCenterDatabase>\n")
+	return b.Flush()
+}
+
+func sportOf(activity *model.AthleteActivity) string {
+	if activity.SportType != "" {
+		return activity.SportType
+	}
+	return activity.Type
+}
+
+// tcxSport maps a Strava sport type onto the three sports TCX knows about.
+func tcxSport(activity *model.AthleteActivity) string {
+	sport := sportOf(activity)
+	switch {
+	case strings.HasSuffix(sport, "Ride") || sport == "Velomobile" || sport == "Handcycle":
+		return "Biking"
+	case strings.HasSuffix(sport, "Run"):
+		return "Running"
+	default:
+		return "Other"
+	}
+}
+
+func at(stream *model.StreamData, i int) *float64 {
+	if stream == nil || i >= len(stream.Data) {
+		return nil
+	}
+	return stream.Data[i]
+}
+
+func escape(value string) string {
+	var sb strings.Builder
+	//nolint: errcheck // strings.Builder never returns an error
+	xml.EscapeText(&sb, []byte(value))
+	return sb.String()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatFloat(v float64, precision int) string {
+	return strconv.FormatFloat(v, 'f', precision, 64)
+}
+
+func round(v float64) int {
+	return int(math.Round(v))
+}
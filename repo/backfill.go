@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	BackfillRunning   = "running"
+	BackfillPaused    = "paused"
+	BackfillCompleted = "completed"
+	BackfillFailed    = "failed"
+)
+
+// BackfillState is the persisted progress of a full-history backfill. The job walks back in time,
+// one page of activities at a time, so Before is the cursor: every activity that started at or
+// after it has been processed. Times are RFC 3339.
+type BackfillState struct {
+	Status string `json:"status"`
+	Since  string `json:"since"`
+	Before string `json:"before"`
+	// Listed counts activities seen, Fetched streams downloaded and Skipped activities already cached.
+	Listed    int    `json:"listed"`
+	Fetched   int    `json:"fetched"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+	StartedAt string `json:"started_at"`
+	UpdatedAt string `json:"updated_at"`
+	// ResumeAt is set while paused on the rate limit.
+	ResumeAt  string `json:"resume_at,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+func (s *storage) GetBackfillState() (*BackfillState, error) {
+	data, err := os.ReadFile(s.backfillStatePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state BackfillState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode backfill state: %w", err)
+	}
+	return &state, nil
+}
+
+func (s *storage) SaveBackfillState(state *BackfillState) error {
+	return saveJSONAtomic(state, s.backfillStatePath())
+}
+
+func (s *storage) backfillStatePath() string {
+	return filepath.Join(s.path, "data", "backfill.json")
+}
@@ -0,0 +1,24 @@
+package repo
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// GetActivityClimbs returns the climb profile saved with the cached stream, encoded as the
+// service saved it, or nil when there is none.
+func (s *storage) GetActivityClimbs(id string) (json.RawMessage, error) {
+	var profile json.RawMessage
+	err := LoadFromZstd(s.getFilePath(id, "climbs"), &profile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (s *storage) SaveActivityClimbs(id string, profile json.RawMessage) error {
+	return SaveToZstd(profile, s.getFilePath(id, "climbs"))
+}
@@ -0,0 +1,16 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SaveExport writes a file to the exports folder of the data folder and returns its path.
+func (s *storage) SaveExport(name string, data []byte) (string, error) {
+	dir := filepath.Join(s.path, "exports")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	return path, os.WriteFile(path, data, 0o644)
+}
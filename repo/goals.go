@@ -0,0 +1,45 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Goal is a target for the activities of a period, e.g. 5000 km of cycling in 2026 or 3 runs per
+// week. Metric is "distance" (km), "moving_time" (hours), "elevation_gain" (m) or "activities".
+// Sport is a sport name understood by sport.Resolve, empty for all sports. Period is "week",
+// "month" or "year"; Year pins a yearly goal to one year, otherwise the current period is used.
+type Goal struct {
+	Name   string  `json:"name,omitempty"`
+	Sport  string  `json:"sport,omitempty"`
+	Metric string  `json:"metric"`
+	Target float64 `json:"target"`
+	Period string  `json:"period"`
+	Year   int     `json:"year,omitempty"`
+}
+
+// GetGoals returns the configured goals, or none when the file does not exist.
+func (s *storage) GetGoals() ([]Goal, error) {
+	data, err := os.ReadFile(s.goalsPath())
+	if os.IsNotExist(err) {
+		return []Goal{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	goals := []Goal{}
+	if err := json.Unmarshal(data, &goals); err != nil {
+		return nil, fmt.Errorf("failed to decode goals: %w", err)
+	}
+	return goals, nil
+}
+
+func (s *storage) SaveGoals(goals []Goal) error {
+	return saveJSONAtomic(goals, s.goalsPath())
+}
+
+func (s *storage) goalsPath() string {
+	return filepath.Join(s.path, "data", "goals.json")
+}
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// CurrentSchemaVersion is the version of the data folder layout written by this build.
+// Bump it together with a new Migration whenever the shape of cached files changes.
+const CurrentSchemaVersion = 4
+
+// legacySchemaVersion is assumed for data folders created before the manifest existed.
+const legacySchemaVersion = 1
+
+var ErrSchemaTooNew = errors.New("data folder was written by a newer version of strava-mcp")
+
+type Manifest struct {
+	SchemaVersion int                `json:"schema_version"`
+	CreatedAt     string             `json:"created_at,omitempty"`
+	UpdatedAt     string             `json:"updated_at,omitempty"`
+	Migrations    []AppliedMigration `json:"migrations,omitempty"`
+}
+
+type AppliedMigration struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	AppliedAt   string `json:"applied_at"`
+}
+
+// Migration upgrades the data folder from Version-1 to Version.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(s Storage) error
+}
+
+func (s *storage) GetManifest() (*Manifest, error) {
+	data, err := os.ReadFile(s.manifestPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+func (s *storage) SaveManifest(manifest *Manifest) error {
+	return saveJSONAtomic(manifest, s.manifestPath())
+}
+
+// Migrate brings the data folder up to CurrentSchemaVersion, applying every migration newer
+// than the version recorded in the manifest. The manifest is saved after each step so an
+// interrupted run resumes from the last completed migration.
+func (s *storage) Migrate(migrations []Migration) error {
+	manifest, err := s.GetManifest()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if manifest == nil {
+		if !s.hasCachedData() {
+			return s.SaveManifest(&Manifest{SchemaVersion: CurrentSchemaVersion, CreatedAt: now, UpdatedAt: now})
+		}
+		manifest = &Manifest{SchemaVersion: legacySchemaVersion, CreatedAt: now}
+	}
+	if manifest.SchemaVersion > CurrentSchemaVersion {
+		return fmt.Errorf("%w: schema version %d, supported %d", ErrSchemaTooNew, manifest.SchemaVersion, CurrentSchemaVersion)
+	}
+
+	pending := slices.Clone(migrations)
+	slices.SortFunc(pending, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	for _, migration := range pending {
+		if migration.Version <= manifest.SchemaVersion || migration.Version > CurrentSchemaVersion {
+			continue
+		}
+		slog.Info("Migrating data folder", "from", manifest.SchemaVersion, "to", migration.Version, "description", migration.Description)
+		if err := migration.Up(s); err != nil {
+			return fmt.Errorf("migration to schema version %d (%s): %w", migration.Version, migration.Description, err)
+		}
+		manifest.SchemaVersion = migration.Version
+		manifest.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		manifest.Migrations = append(manifest.Migrations, AppliedMigration{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   manifest.UpdatedAt,
+		})
+		if err := s.SaveManifest(manifest); err != nil {
+			return err
+		}
+	}
+
+	if manifest.SchemaVersion < CurrentSchemaVersion {
+		return fmt.Errorf("migrations stop at schema version %d, expected %d", manifest.SchemaVersion, CurrentSchemaVersion)
+	}
+	return nil
+}
+
+func (s *storage) hasCachedData() bool {
+	for _, kind := range []string{"activity", "stream"} {
+		entries, err := os.ReadDir(s.getDirPath(kind))
+		if err == nil && len(entries) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *storage) manifestPath() string {
+	return filepath.Join(s.path, "data", "manifest.json")
+}
+
+// saveJSONAtomic writes data as indented JSON via a temporary file so readers never see a
+// partially written file.
+func saveJSONAtomic(data interface{}, filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+	jsonData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling to JSON: %w", err)
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, jsonData, 0644); err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return fmt.Errorf("error replacing file: %w", err)
+	}
+	return nil
+}
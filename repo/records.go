@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PersonalRecord is the best value of a record and the activity it was set in.
+type PersonalRecord struct {
+	Value      float64 `json:"value"`
+	ActivityID int64   `json:"activity_id"`
+	Name       string  `json:"name"`
+	Date       string  `json:"date"`
+}
+
+// PersonalRecords are the all-time and per-year bests keyed by record, and the activities whose
+// streams were scanned for them.
+type PersonalRecords struct {
+	AllTime   map[string]PersonalRecord            `json:"all_time"`
+	Years     map[string]map[string]PersonalRecord `json:"years"`
+	Scanned   map[int64]bool                       `json:"scanned"`
+	UpdatedAt string                               `json:"updated_at"`
+}
+
+func (s *storage) GetPersonalRecords() (*PersonalRecords, error) {
+	data, err := os.ReadFile(s.personalRecordsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records PersonalRecords
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode personal records: %w", err)
+	}
+	return &records, nil
+}
+
+func (s *storage) SavePersonalRecords(records *PersonalRecords) error {
+	return saveJSONAtomic(records, s.personalRecordsPath())
+}
+
+func (s *storage) personalRecordsPath() string {
+	return filepath.Join(s.path, "data", "personal_records.json")
+}
@@ -1,11 +1,13 @@
 package repo
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"stravamcp/model"
 	"strings"
+	"sync/atomic"
 )
 
 type Storage interface {
@@ -15,9 +17,36 @@ type Storage interface {
 	GetActivityStream(id string) (*model.ActivityStreams, error)
 	SaveAthleteActivity(activity *model.AthleteActivity) error
 	SaveActivityStream(id string, stream *model.ActivityStreams) error
+	GetActivityLaps(id string) ([]model.Lap, error)
+	SaveActivityLaps(id string, laps []model.Lap) error
+	GetActivityClimbs(id string) (json.RawMessage, error)
+	SaveActivityClimbs(id string, profile json.RawMessage) error
+	DeleteActivity(id string) error
+	TombstoneActivity(activity *model.AthleteActivity, reason string) error
+	GetTombstones() ([]Tombstone, error)
+	RemoveTombstone(id string) error
+	GetActivityStreamIDs() ([]string, error)
+	// ActivitiesVersion changes whenever an activity summary is saved or removed through this
+	// storage, so that in-memory caches built from the summaries can tell when to rebuild.
+	ActivitiesVersion() uint64
+	GetManifest() (*Manifest, error)
+	SaveManifest(manifest *Manifest) error
+	Migrate(migrations []Migration) error
+	GetSyncState() (*SyncState, error)
+	SaveSyncState(state *SyncState) error
+	GetBackfillState() (*BackfillState, error)
+	SaveBackfillState(state *BackfillState) error
+	GetAthleteZones() (*CachedZones, error)
+	SaveAthleteZones(zones *CachedZones) error
+	GetPersonalRecords() (*PersonalRecords, error)
+	SavePersonalRecords(records *PersonalRecords) error
+	GetGoals() ([]Goal, error)
+	SaveGoals(goals []Goal) error
+	SaveExport(name string, data []byte) (string, error)
 }
 type storage struct {
-	path string
+	path    string
+	version atomic.Uint64
 }
 
 func NewStorage(path string) Storage {
@@ -37,9 +66,12 @@ func (s *storage) GetAthleteActivity(id string) (*model.AthleteActivity, error)
 }
 
 func (s *storage) GetAllAthleteActivities() ([]model.AthleteActivity, error) {
-	dirPath := fmt.Sprintf("%s/data/%s/", s.path, "activity")
+	dirPath := s.getDirPath("activity")
 
 	files, err := os.ReadDir(dirPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +118,27 @@ func (s *storage) GetActivityStream(id string) (*model.ActivityStreams, error) {
 	return &loadedData, nil
 }
 
+func (s *storage) GetActivityStreamIDs() ([]string, error) {
+	files, err := os.ReadDir(s.getDirPath("stream"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json.zstd") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(file.Name(), ".json.zstd"))
+	}
+	return ids, nil
+}
+
 func (s *storage) SaveAthleteActivity(activity *model.AthleteActivity) error {
+	defer s.version.Add(1)
 	return SaveToZstd(activity, s.getFilePath(fmt.Sprintf("%d", activity.ID), "activity"))
 }
 
@@ -94,6 +146,44 @@ func (s *storage) SaveActivityStream(id string, stream *model.ActivityStreams) e
 	return SaveToZstd(stream, s.getFilePath(id, "stream"))
 }
 
+// GetActivityLaps returns nil when the laps were never fetched and an empty slice for activities
+// without laps.
+func (s *storage) GetActivityLaps(id string) ([]model.Lap, error) {
+	laps := []model.Lap{}
+	err := LoadFromZstd(s.getFilePath(id, "laps"), &laps)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return laps, nil
+}
+
+func (s *storage) SaveActivityLaps(id string, laps []model.Lap) error {
+	return SaveToZstd(laps, s.getFilePath(id, "laps"))
+}
+
+// DeleteActivity removes an activity, its stream, laps, climbs and any tombstone from the cache.
+// Missing files are ignored.
+func (s *storage) DeleteActivity(id string) error {
+	defer s.version.Add(1)
+	for _, kind := range []string{"activity", "stream", "laps", "climbs", "tombstone"} {
+		if err := os.Remove(s.getFilePath(id, kind)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *storage) ActivitiesVersion() uint64 {
+	return s.version.Load()
+}
+
 func (s *storage) getFilePath(id, activityType string) string {
 	return fmt.Sprintf("%s/data/%s/%s.json.zstd", s.path, activityType, id)
 }
+
+func (s *storage) getDirPath(activityType string) string {
+	return fmt.Sprintf("%s/data/%s/", s.path, activityType)
+}
@@ -0,0 +1,44 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SyncState records how far the local cache is in step with Strava. Times are RFC 3339.
+type SyncState struct {
+	// LastActivityStart is the start date of the newest activity synced so far, the high-water mark
+	// for incremental syncs.
+	LastActivityStart string `json:"last_activity_start,omitempty"`
+	LastSyncAt        string `json:"last_sync_at,omitempty"`
+	// LastFullScanAt is the end of the last reconciliation pass over the recent window.
+	LastFullScanAt string `json:"last_full_scan_at,omitempty"`
+	// LegacyStreams are the IDs of cached streams that lack the keys requested since schema
+	// version 2 and are still waiting to be re-fetched.
+	LegacyStreams []string `json:"legacy_streams,omitempty"`
+}
+
+func (s *storage) GetSyncState() (*SyncState, error) {
+	data, err := os.ReadFile(s.syncStatePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state SyncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode sync state: %w", err)
+	}
+	return &state, nil
+}
+
+func (s *storage) SaveSyncState(state *SyncState) error {
+	return saveJSONAtomic(state, s.syncStatePath())
+}
+
+func (s *storage) syncStatePath() string {
+	return filepath.Join(s.path, "data", "sync_state.json")
+}
@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"stravamcp/model"
+	"strings"
+	"time"
+)
+
+// Tombstone keeps the summary of an activity that disappeared from Strava (deleted, or made
+// private without read_all access) after its cached files were removed.
+type Tombstone struct {
+	Activity  model.AthleteActivity `json:"activity"`
+	Reason    string                `json:"reason"`
+	RemovedAt string                `json:"removed_at"`
+}
+
+// TombstoneActivity replaces the cached activity, stream, laps and climbs with a tombstone, which
+// hides the activity from reads while keeping a record of it.
+func (s *storage) TombstoneActivity(activity *model.AthleteActivity, reason string) error {
+	defer s.version.Add(1)
+	tombstone := &Tombstone{Activity: *activity, Reason: reason, RemovedAt: time.Now().UTC().Format(time.RFC3339)}
+	id := fmt.Sprintf("%d", activity.ID)
+	if err := SaveToZstd(tombstone, s.getFilePath(id, "tombstone")); err != nil {
+		return err
+	}
+	for _, kind := range []string{"activity", "stream", "laps", "climbs"} {
+		if err := os.Remove(s.getFilePath(id, kind)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *storage) GetTombstones() ([]Tombstone, error) {
+	dirPath := s.getDirPath("tombstone")
+	files, err := os.ReadDir(dirPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tombstones []Tombstone
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".zstd") {
+			continue
+		}
+		var tombstone Tombstone
+		if err := LoadFromZstd(filepath.Join(dirPath, file.Name()), &tombstone); err != nil {
+			continue
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	return tombstones, nil
+}
+
+// RemoveTombstone forgets a tombstone, e.g. when the activity is visible on Strava again.
+func (s *storage) RemoveTombstone(id string) error {
+	if err := os.Remove(s.getFilePath(id, "tombstone")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"stravamcp/model"
+)
+
+// CachedZones are the athlete's heart rate and power zones as last fetched from Strava.
+type CachedZones struct {
+	Zones     model.AthleteZones `json:"zones"`
+	FetchedAt string             `json:"fetched_at"`
+}
+
+func (s *storage) GetAthleteZones() (*CachedZones, error) {
+	data, err := os.ReadFile(s.athleteZonesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var zones CachedZones
+	if err := json.Unmarshal(data, &zones); err != nil {
+		return nil, fmt.Errorf("failed to decode athlete zones: %w", err)
+	}
+	return &zones, nil
+}
+
+func (s *storage) SaveAthleteZones(zones *CachedZones) error {
+	return saveJSONAtomic(zones, s.athleteZonesPath())
+}
+
+func (s *storage) athleteZonesPath() string {
+	return filepath.Join(s.path, "data", "athlete_zones.json")
+}
@@ -3,83 +3,99 @@ package service
 import (
 	"cmp"
 	"context"
-	"fmt"
 	"log/slog"
 	"slices"
 	"stravamcp/model"
+	"stravamcp/pkg/analytics"
 	"stravamcp/pkg/client"
+	"stravamcp/pkg/query"
+	"stravamcp/pkg/sport"
+	"stravamcp/pkg/trackfile"
 	"stravamcp/repo"
-	"strings"
+	"sync"
 	"time"
 )
 
 type ActivityService interface {
-	ProcessActivities(after time.Time) error
-	GetAllActivities(_ context.Context, filter string, before *time.Time, after *time.Time) ([]model.AthleteActivity, error)
+	ProcessActivities(after time.Time) (*SyncResult, error)
+	SyncActivities() (*SyncResult, error)
+	ReconcileActivities(after, before time.Time, mode ReconcileMode) (*ReconcileResult, error)
+	GetAllActivities(_ context.Context, filter string, q *query.Query, before *time.Time, after *time.Time, maxStaleness time.Duration) (*ActivityList, error)
 	GetActivityStream(_ context.Context, id string) (*ActivityStreamData, error)
+	GetDecoupling(_ context.Context, id string) (*ActivityDecoupling, error)
+	DetectIntervals(_ context.Context, id string) (*ActivityIntervals, error)
+	GetSplits(_ context.Context, id string, unit analytics.SplitUnit) (*ActivitySplits, error)
+	GetClimbs(_ context.Context, id string) (*ActivityClimbs, error)
+	GetCachedClimbs(_ context.Context, activities []model.AthleteActivity) (map[int64]analytics.ClimbProfile, error)
+	GetPersonalRecords(_ context.Context, year int) (*PersonalRecords, error)
+	ExportActivity(_ context.Context, id string, format trackfile.Format) (*ActivityExport, error)
+	SaveExport(_ context.Context, export *ActivityExport, fileName string) (string, error)
+	MigrateStorage() error
+	activityCache
 }
+
+// activityCache is the part of the activity service that backfills cache activities through, so
+// that they share its locks. Wrappers of an ActivityService keep it by embedding the service.
+type activityCache interface {
+	hasRateLimitBudget(inFlight int) bool
+	saveSummaries(activities []model.AthleteActivity, result *SyncResult) ([]model.AthleteActivity, error)
+	fetchStreams(accessToken string, activities []model.AthleteActivity, result *SyncResult)
+}
+
 type activityService struct {
 	stravaClient client.StravaClient
 	tokenRepo    repo.TokenRepo
 	storage      repo.Storage
+	syncConfig   SyncConfig
+	syncMu       sync.Mutex
+	syncCall     *syncCall
+	recordsMu    sync.Mutex
 }
 
-func NewActivityService(stravaClient client.StravaClient, tokenRepo repo.TokenRepo, storage repo.Storage) ActivityService {
-	return &activityService{stravaClient: stravaClient, tokenRepo: tokenRepo, storage: storage}
+func NewActivityService(stravaClient client.StravaClient, tokenRepo repo.TokenRepo, storage repo.Storage, syncConfig SyncConfig) ActivityService {
+	return &activityService{stravaClient: stravaClient, tokenRepo: tokenRepo, storage: storage, syncConfig: syncConfig}
 }
 
-func (a *activityService) ProcessActivities(after time.Time) error {
-	token, err := a.tokenRepo.Get()
-	if err != nil {
-		return err
-	}
-	activities, err := a.stravaClient.GetAllAthleteActivities(int(after.Unix()), token.AccessToken)
-	if err != nil {
-		return err
-	}
+func (a *activityService) ProcessActivities(after time.Time) (*SyncResult, error) {
+	result, _, err := a.processActivities(after)
+	return result, err
+}
 
-	for _, athleteActivity := range activities {
-		id := athleteActivity.ID
-		activity, err := a.storage.GetAthleteActivity(fmt.Sprintf("%d", id))
-		if err != nil {
-			return err
-		}
-		if activity == nil {
-			err = a.storage.SaveAthleteActivity(&athleteActivity)
-			if err != nil {
-				return err
-			}
-		}
-		activityStream, err := a.storage.GetActivityStream(fmt.Sprintf("%d", id))
-		if err != nil {
-			return err
-		}
-		if activityStream != nil {
-			continue
-		}
-		slog.Info("Getting stream for activity", "id", id, "start_date", athleteActivity.StartDate)
-		stream, err := a.stravaClient.FetchStreams(fmt.Sprintf("%d", id), getActivityKeys(), token.AccessToken)
-		if err != nil {
-			return err
-		}
-		err = a.storage.SaveActivityStream(fmt.Sprintf("%d", id), stream)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+// ActivityList is a read from the local cache together with how fresh the cache is.
+type ActivityList struct {
+	Activities []model.AthleteActivity `json:"activities"`
+	Freshness  Freshness               `json:"freshness"`
 }
 
-func (a *activityService) GetAllActivities(_ context.Context, filter string, before *time.Time, after *time.Time) ([]model.AthleteActivity, error) {
-	defaultAfter := after
-	if defaultAfter == nil {
-		oneDayAgo := time.Now().Add(time.Hour * -24 * 7)
-		defaultAfter = &oneDayAgo
-	}
-	err := a.ProcessActivities(*defaultAfter)
+type Freshness struct {
+	// LastSyncAt is empty when the cache was never synced.
+	LastSyncAt string `json:"last_sync_at,omitempty"`
+	AgeSeconds *int64 `json:"age_seconds,omitempty"`
+	// Stale is set when the cache is older than the requested max staleness.
+	Stale bool `json:"stale"`
+	// Refreshing is set while a sync runs in the background.
+	Refreshing bool `json:"refreshing"`
+}
+
+// GetAllActivities reads activities from the local cache only, so it works offline and never
+// waits for Strava. The filter is a sport type or group name understood by sport.Resolve, and
+// the activities are newest first unless the query sorts them. When the last sync is older than
+// maxStaleness a sync is started in the background; its results show up in later reads. A
+// maxStaleness of zero never triggers a sync.
+func (a *activityService) GetAllActivities(_ context.Context, filter string, q *query.Query, before *time.Time, after *time.Time, maxStaleness time.Duration) (*ActivityList, error) {
+	freshness, err := a.freshness(maxStaleness)
 	if err != nil {
 		return nil, err
 	}
+	if freshness.Stale && !freshness.Refreshing {
+		freshness.Refreshing = true
+		go func() {
+			if _, err := a.SyncActivities(); err != nil {
+				slog.Error("Background refresh failed", "error", err)
+			}
+		}()
+	}
+
 	allActivities, err := a.storage.GetAllAthleteActivities()
 	if err != nil {
 		return nil, err
@@ -89,10 +105,18 @@ func (a *activityService) GetAllActivities(_ context.Context, filter string, bef
 		return cmp.Compare(b.StartDate, a.StartDate)
 	})
 
+	var sports sport.Set
+	if filter != "" {
+		sports, err = sport.Resolve(filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	filteredActivities := make([]model.AthleteActivity, 0)
 
 	for _, activity := range allActivities {
-		if filter != "" && strings.EqualFold(activity.Type, filter) {
+		if sports != nil && !sports.Contains(&activity) {
 			continue
 		}
 
@@ -112,7 +136,31 @@ func (a *activityService) GetAllActivities(_ context.Context, filter string, bef
 		filteredActivities = append(filteredActivities, activity)
 	}
 
-	return filteredActivities, nil
+	return &ActivityList{Activities: q.Apply(filteredActivities), Freshness: *freshness}, nil
+}
+
+func (a *activityService) freshness(maxStaleness time.Duration) (*Freshness, error) {
+	state, err := a.storage.GetSyncState()
+	if err != nil {
+		return nil, err
+	}
+	a.syncMu.Lock()
+	freshness := &Freshness{Refreshing: a.syncCall != nil}
+	a.syncMu.Unlock()
+
+	var lastSync time.Time
+	if state != nil {
+		lastSync, err = time.Parse(time.RFC3339, state.LastSyncAt)
+	}
+	if state == nil || err != nil {
+		freshness.Stale = maxStaleness > 0
+		return freshness, nil
+	}
+	age := int64(time.Since(lastSync).Seconds())
+	freshness.LastSyncAt = state.LastSyncAt
+	freshness.AgeSeconds = &age
+	freshness.Stale = maxStaleness > 0 && time.Since(lastSync) > maxStaleness
+	return freshness, nil
 }
 
 type ActivityStreamData struct {
@@ -123,52 +171,70 @@ type ActivityStreamData struct {
 }
 
 type StreamDataPoint struct {
-	Time      *float64 `json:"time,omitempty"`
-	Watts     *float64 `json:"watts,omitempty"`
-	Heartrate *float64 `json:"heartrate,omitempty"`
-	Cadence   *float64 `json:"cadence,omitempty"`
+	Time           *float64 `json:"time,omitempty"`
+	Distance       *float64 `json:"distance,omitempty"`
+	Altitude       *float64 `json:"altitude,omitempty"`
+	VelocitySmooth *float64 `json:"velocity_smooth,omitempty"`
+	GradeSmooth    *float64 `json:"grade_smooth,omitempty"`
+	Watts          *float64 `json:"watts,omitempty"`
+	Heartrate      *float64 `json:"heartrate,omitempty"`
+	Cadence        *float64 `json:"cadence,omitempty"`
+	Temp           *float64 `json:"temp,omitempty"`
 }
 
 func (a *activityService) GetActivityStream(_ context.Context, id string) (*ActivityStreamData, error) {
-	token, err := a.tokenRepo.Get()
+	activity, rawStreams, err := a.loadActivityAndStreams(id)
 	if err != nil {
 		return nil, err
 	}
+	return combineStreams(id, activity, rawStreams), nil
+}
+
+// loadActivityAndStreams reads an activity and its streams from storage, fetching and caching
+// whichever is missing from Strava.
+func (a *activityService) loadActivityAndStreams(id string) (*model.AthleteActivity, *model.ActivityStreams, error) {
+	token, err := a.tokenRepo.Get()
+	if err != nil {
+		return nil, nil, err
+	}
 	rawStreams, err := a.storage.GetActivityStream(id)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if rawStreams == nil {
 		rawStreams, err = a.stravaClient.FetchStreams(id, getActivityKeys(), token.AccessToken)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		err = a.storage.SaveActivityStream(id, rawStreams)
+		err = saveStream(a.storage, id, rawStreams)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
 	activity, err := a.storage.GetAthleteActivity(id)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if activity == nil {
 		activity, err = a.stravaClient.GetAthleteActivityByID(id, token.AccessToken)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		err = a.storage.SaveAthleteActivity(activity)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
+	return activity, rawStreams, nil
+}
 
-	isBike := activity != nil && strings.EqualFold(activity.Type, "ride")
-
+// combineStreams zips the raw per-key streams into one data point per time sample. Streams the
+// activity was not recorded with, or samples missing from them, are left out of the points.
+func combineStreams(id string, activity *model.AthleteActivity, rawStreams *model.ActivityStreams) *ActivityStreamData {
 	combined := &ActivityStreamData{
 		ActivityID: id,
 		Streams:    []StreamDataPoint{},
@@ -179,42 +245,36 @@ func (a *activityService) GetActivityStream(_ context.Context, id string) (*Acti
 		combined.Date = activity.StartDate
 	}
 
-	if rawStreams.Time == nil || rawStreams.Watts == nil || rawStreams.Heartrate == nil {
-		return combined, nil
+	if rawStreams.Time == nil {
+		return combined
 	}
 
 	for i := 0; i < len(rawStreams.Time.Data); i++ {
 		if rawStreams.Time.Data[i] == nil {
 			continue
 		}
-		if rawStreams.Heartrate.Data[i] == nil {
-			continue
-		}
+		combined.Streams = append(combined.Streams, StreamDataPoint{
+			Time:           rawStreams.Time.Data[i],
+			Distance:       sampleAt(rawStreams.Distance, i),
+			Altitude:       sampleAt(rawStreams.Altitude, i),
+			VelocitySmooth: sampleAt(rawStreams.VelocitySmooth, i),
+			GradeSmooth:    sampleAt(rawStreams.GradeSmooth, i),
+			Watts:          sampleAt(rawStreams.Watts, i),
+			Heartrate:      sampleAt(rawStreams.Heartrate, i),
+			Cadence:        sampleAt(rawStreams.Cadence, i),
+			Temp:           sampleAt(rawStreams.Temp, i),
+		})
+	}
+	return combined
+}
 
-		if rawStreams.Watts != nil && rawStreams.Watts.Data[i] == nil && isBike {
-			continue
-		}
-		if rawStreams.Cadence != nil && rawStreams.Cadence.Data[i] == nil && isBike {
-			continue
-		}
-		point := StreamDataPoint{
-			Time:      rawStreams.Time.Data[i],
-			Heartrate: rawStreams.Heartrate.Data[i],
-		}
-		if isBike {
-			if rawStreams.Cadence != nil {
-				point.Cadence = rawStreams.Cadence.Data[i]
-			}
-			if rawStreams.Watts != nil {
-				point.Watts = rawStreams.Watts.Data[i]
-			}
-		}
-		combined.Streams = append(combined.Streams, point)
+func sampleAt(stream *model.StreamData, i int) *float64 {
+	if stream == nil || i >= len(stream.Data) {
+		return nil
 	}
-	return combined, nil
+	return stream.Data[i]
 }
 
 func getActivityKeys() []string {
-	return []string{"watts", "time", "heartrate", "cadence"}
-
+	return []string{"watts", "time", "heartrate", "cadence", "distance", "altitude", "velocity_smooth", "temp", "grade_smooth", "latlng"}
 }
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"stravamcp/config"
+	"stravamcp/model"
+	"stravamcp/pkg/analytics"
+	"stravamcp/repo"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AnalyticsService computes training metrics from the local cache. It never calls Strava, so
+// activities whose stream has not been synced yet are scored from their summary.
+type AnalyticsService interface {
+	GetTrainingLoad(_ context.Context, after *time.Time, before *time.Time) (*TrainingLoad, error)
+	GetPowerAnalysis(_ context.Context, id string) (*PowerAnalysis, error)
+	GetPowerCurve(_ context.Context, after *time.Time, before *time.Time) (*PowerCurve, error)
+	GetActivityZones(_ context.Context, id string) (*ActivityZones, error)
+	GetZoneDistribution(_ context.Context, filter string, after *time.Time, before *time.Time, groupBy Grouping) (*ZoneDistribution, error)
+	GetSummary(_ context.Context, filter string, after *time.Time, before *time.Time, groupBy Grouping) (*Summary, error)
+	GetGoals(_ context.Context) ([]repo.Goal, error)
+	SaveGoals(_ context.Context, goals []repo.Goal) error
+	GetGoalProgress(_ context.Context) (*GoalProgressList, error)
+	FindSimilarActivities(_ context.Context, id string, limit int) (*SimilarActivities, error)
+	SearchActivitiesByLocation(_ context.Context, query LocationQuery) (*LocationSearch, error)
+}
+
+var (
+	ErrActivityNotCached = errors.New("activity is not cached")
+	// ErrStreamNotCached is returned for activities whose stream was not synced yet; get_activity_stream
+	// or a sync fetches it.
+	ErrStreamNotCached = errors.New("activity stream is not cached, fetch it with get_activity_stream or refresh_activities")
+	ErrNoPowerData     = errors.New("activity has no power data")
+	ErrNoHeartRateData = errors.New("no heart rate data")
+)
+
+// AthleteConfig holds the configured thresholds. Zero values are estimated from the cache.
+type AthleteConfig struct {
+	FTP       float64
+	MaxHR     float64
+	RestingHR float64
+	LTHR      float64
+}
+
+func NewAthleteConfig(cfg *config.Config) AthleteConfig {
+	return AthleteConfig{
+		FTP:       float64(cfg.AthleteFtp),
+		MaxHR:     float64(cfg.AthleteMaxHr),
+		RestingHR: float64(cfg.AthleteRestingHr),
+		LTHR:      float64(cfg.AthleteLthr),
+	}
+}
+
+type analyticsService struct {
+	storage    repo.Storage
+	athlete    AthleteConfig
+	locationMu sync.Mutex
+	locations  *locationIndex
+}
+
+func NewAnalyticsService(storage repo.Storage, athlete AthleteConfig) AnalyticsService {
+	return &analyticsService{storage: storage, athlete: athlete}
+}
+
+const defaultRestingHR = 60
+
+// AthleteThresholds are the thresholds used for a computation and where each one came from:
+// "config", "estimated" from the cached history, or "default".
+type AthleteThresholds struct {
+	analytics.Thresholds
+	Sources map[string]string `json:"sources"`
+}
+
+// thresholds fills in thresholds that are not configured. Max HR is the highest max heart rate
+// of any cached activity, LTHR 89% of max HR. FTP is never guessed.
+func (s *analyticsService) thresholds(activities []model.AthleteActivity) AthleteThresholds {
+	t := AthleteThresholds{
+		Thresholds: analytics.Thresholds{FTP: s.athlete.FTP, MaxHR: s.athlete.MaxHR, RestingHR: s.athlete.RestingHR, LTHR: s.athlete.LTHR},
+		Sources:    map[string]string{},
+	}
+	if t.FTP > 0 {
+		t.Sources["ftp"] = "config"
+	}
+	if t.MaxHR > 0 {
+		t.Sources["max_hr"] = "config"
+	} else {
+		for _, activity := range activities {
+			if activity.MaxHeartrate != nil && *activity.MaxHeartrate > t.MaxHR {
+				t.MaxHR = *activity.MaxHeartrate
+			}
+		}
+		if t.MaxHR > 0 {
+			t.Sources["max_hr"] = "estimated"
+		}
+	}
+	if t.RestingHR > 0 {
+		t.Sources["resting_hr"] = "config"
+	} else {
+		t.RestingHR = defaultRestingHR
+		t.Sources["resting_hr"] = "default"
+	}
+	if t.LTHR > 0 {
+		t.Sources["lthr"] = "config"
+	} else if t.MaxHR > 0 {
+		t.LTHR = math.Round(t.MaxHR * 0.89)
+		t.Sources["lthr"] = "estimated"
+	}
+	return t
+}
+
+// cachedActivities returns every cached activity, oldest first.
+func (s *analyticsService) cachedActivities() ([]model.AthleteActivity, error) {
+	activities, err := s.storage.GetAllAthleteActivities()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(activities, func(a, b model.AthleteActivity) int {
+		return cmp.Compare(a.StartDate, b.StartDate)
+	})
+	return activities, nil
+}
+
+// localDate is the calendar day the activity started on where it was recorded. Strava's
+// start_date_local is the wall-clock time with a Z suffix; without it the UTC start is converted
+// to the IANA zone at the end of the timezone field, e.g. "(GMT+01:00) Europe/Berlin".
+func localDate(activity *model.AthleteActivity) string {
+	date := activity.StartDateLocal
+	if date == "" {
+		date = activity.StartDate
+		if _, name, ok := strings.Cut(activity.Timezone, ") "); ok {
+			start, err := time.Parse(time.RFC3339, date)
+			location, zoneErr := time.LoadLocation(name)
+			if err == nil && zoneErr == nil {
+				date = start.In(location).Format(time.RFC3339)
+			}
+		}
+	}
+	if len(date) < 10 {
+		return ""
+	}
+	return date[:10]
+}
+
+// cachedActivity loads an activity and its stream from the cache.
+func (s *analyticsService) cachedActivity(id string) (*model.AthleteActivity, *model.ActivityStreams, error) {
+	activity, err := s.storage.GetAthleteActivity(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if activity == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrActivityNotCached, id)
+	}
+	streams, err := s.storage.GetActivityStream(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if streams == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrStreamNotCached, id)
+	}
+	return activity, streams, nil
+}
+
+// inRange reports whether the activity started within the optional date range.
+func inRange(activity *model.AthleteActivity, after *time.Time, before *time.Time) bool {
+	start, err := time.Parse(time.RFC3339, activity.StartDate)
+	if err != nil {
+		return false
+	}
+	return (after == nil || !start.Before(*after)) && (before == nil || !start.After(*before))
+}
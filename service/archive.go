@@ -0,0 +1,287 @@
+package service
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"stravamcp/model"
+	"stravamcp/pkg/archive"
+	"stravamcp/pkg/bulkexport"
+	"stravamcp/pkg/fit"
+	"stravamcp/repo"
+	"strconv"
+)
+
+type ArchiveService interface {
+	Export(w io.Writer, dataset archive.Dataset, format archive.Format) (int, error)
+	Import(r io.Reader, dataset archive.Dataset, format archive.Format) (*ImportResult, error)
+	ImportStravaArchive(fileName string) (*StravaImportResult, error)
+	AnalyzeFitFile(fileName string) (*FitAnalysis, error)
+}
+
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
+
+type StravaImportResult struct {
+	Activities  int             `json:"activities"`
+	Streams     int             `json:"streams"`
+	Skipped     int             `json:"skipped"`
+	Unsupported int             `json:"unsupported"`
+	Failed      []ImportFailure `json:"failed,omitempty"`
+}
+
+type ImportFailure struct {
+	ActivityID int64  `json:"activity_id"`
+	File       string `json:"file"`
+	Error      string `json:"error"`
+}
+
+type FitAnalysis struct {
+	FileName         string                 `json:"file_name"`
+	Activity         *model.AthleteActivity `json:"activity"`
+	Laps             []fit.Summary          `json:"laps,omitempty"`
+	AvailableStreams []string               `json:"available_streams"`
+	Stream           *ActivityStreamData    `json:"stream_data"`
+}
+
+type archiveService struct {
+	storage repo.Storage
+}
+
+func NewArchiveService(storage repo.Storage) ArchiveService {
+	return &archiveService{storage: storage}
+}
+
+// Export writes every cached activity or stream to w and returns the number of activities written.
+func (a *archiveService) Export(w io.Writer, dataset archive.Dataset, format archive.Format) (int, error) {
+	switch dataset {
+	case archive.DatasetActivities:
+		return a.exportActivities(w, format)
+	case archive.DatasetStreams:
+		return a.exportStreams(w, format)
+	default:
+		return 0, fmt.Errorf("unsupported dataset %q", dataset)
+	}
+}
+
+func (a *archiveService) exportActivities(w io.Writer, format archive.Format) (int, error) {
+	activities, err := a.storage.GetAllAthleteActivities()
+	if err != nil {
+		return 0, err
+	}
+	slices.SortFunc(activities, func(a, b model.AthleteActivity) int {
+		return cmp.Compare(a.StartDate, b.StartDate)
+	})
+
+	writer, err := archive.NewActivityWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+	for i := range activities {
+		if err := writer.Write(&activities[i]); err != nil {
+			return 0, err
+		}
+	}
+	return len(activities), writer.Close()
+}
+
+func (a *archiveService) exportStreams(w io.Writer, format archive.Format) (int, error) {
+	ids, err := a.storage.GetActivityStreamIDs()
+	if err != nil {
+		return 0, err
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(a), len(b)), cmp.Compare(a, b))
+	})
+
+	writer, err := archive.NewStreamWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, id := range ids {
+		activityID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		stream, err := a.storage.GetActivityStream(id)
+		if err != nil {
+			return count, err
+		}
+		if stream == nil {
+			continue
+		}
+		if err := writer.Write(activityID, stream); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, writer.Close()
+}
+
+// Import restores an export into the cache. Entries that are already cached are skipped so a
+// lossy CSV or Parquet import never overwrites a full copy fetched from Strava.
+func (a *archiveService) Import(r io.Reader, dataset archive.Dataset, format archive.Format) (*ImportResult, error) {
+	result := &ImportResult{}
+	switch dataset {
+	case archive.DatasetActivities:
+		err := archive.ReadActivities(r, format, func(activity *model.AthleteActivity) error {
+			existing, err := a.storage.GetAthleteActivity(fmt.Sprintf("%d", activity.ID))
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				result.Skipped++
+				return nil
+			}
+			result.Imported++
+			return a.storage.SaveAthleteActivity(activity)
+		})
+		return result, err
+	case archive.DatasetStreams:
+		err := archive.ReadStreams(r, format, func(activityID int64, streams *model.ActivityStreams) error {
+			id := fmt.Sprintf("%d", activityID)
+			existing, err := a.storage.GetActivityStream(id)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				result.Skipped++
+				return nil
+			}
+			result.Imported++
+			return saveStream(a.storage, id, streams)
+		})
+		return result, err
+	default:
+		return nil, fmt.Errorf("unsupported dataset %q", dataset)
+	}
+}
+
+// ImportStravaArchive fills the cache from a Strava bulk export so history can be backfilled
+// without API calls. Activities and streams already in the cache are left untouched; activity
+// files that cannot be decoded still import the CSV summary.
+func (a *archiveService) ImportStravaArchive(fileName string) (*StravaImportResult, error) {
+	bulk, err := bulkexport.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	//nolint: errcheck // defer is used to clean up
+	defer bulk.Close()
+
+	entries, err := bulk.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &StravaImportResult{}
+	for _, entry := range entries {
+		id := fmt.Sprintf("%d", entry.Activity.ID)
+		existingActivity, err := a.storage.GetAthleteActivity(id)
+		if err != nil {
+			return result, err
+		}
+		existingStream, err := a.storage.GetActivityStream(id)
+		if err != nil {
+			return result, err
+		}
+		if existingActivity != nil && (existingStream != nil || entry.FileName == "") {
+			result.Skipped++
+			continue
+		}
+
+		if existingStream == nil && entry.FileName != "" {
+			track, err := bulk.Track(entry)
+			switch {
+			case errors.Is(err, bulkexport.ErrUnsupportedFile):
+				result.Unsupported++
+			case err != nil:
+				slog.Warn("Unable to decode activity file", "id", id, "file", entry.FileName, "error", err)
+				result.Failed = append(result.Failed, ImportFailure{ActivityID: entry.Activity.ID, File: entry.FileName, Error: err.Error()})
+			default:
+				if err := saveStream(a.storage, id, track.Streams); err != nil {
+					return result, err
+				}
+				result.Streams++
+				fillLocation(entry.Activity, track.Streams)
+			}
+		}
+
+		if existingActivity == nil {
+			if err := a.storage.SaveAthleteActivity(entry.Activity); err != nil {
+				return result, err
+			}
+			result.Activities++
+		}
+	}
+	return result, nil
+}
+
+// fillLocation copies the first and last recorded positions onto the activity summary.
+func fillLocation(activity *model.AthleteActivity, streams *model.ActivityStreams) {
+	if streams.LatLng == nil {
+		return
+	}
+	for _, latlng := range streams.LatLng.Data {
+		if len(latlng) >= 2 {
+			activity.StartLatLng = latlng
+			break
+		}
+	}
+	for i := len(streams.LatLng.Data) - 1; i >= 0; i-- {
+		if latlng := streams.LatLng.Data[i]; len(latlng) >= 2 {
+			activity.EndLatLng = latlng
+			break
+		}
+	}
+}
+
+// AnalyzeFitFile decodes a local FIT file without touching the cache, for activities that
+// were never uploaded to Strava.
+func (a *archiveService) AnalyzeFitFile(fileName string) (*FitAnalysis, error) {
+	decoded, err := fit.DecodeFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	activity := decoded.AthleteActivity()
+	activity.Name = filepath.Base(fileName)
+	streams := decoded.Track().Streams
+
+	return &FitAnalysis{
+		FileName:         fileName,
+		Activity:         activity,
+		Laps:             decoded.Laps,
+		AvailableStreams: availableStreams(streams),
+		Stream:           combineStreams(activity.Name, activity, streams),
+	}, nil
+}
+
+func availableStreams(streams *model.ActivityStreams) []string {
+	var names []string
+	for _, stream := range []struct {
+		name    string
+		present bool
+	}{
+		{"time", streams.Time != nil},
+		{"latlng", streams.LatLng != nil},
+		{"distance", streams.Distance != nil},
+		{"altitude", streams.Altitude != nil},
+		{"velocity_smooth", streams.VelocitySmooth != nil},
+		{"heartrate", streams.Heartrate != nil},
+		{"cadence", streams.Cadence != nil},
+		{"watts", streams.Watts != nil},
+		{"temp", streams.Temp != nil},
+		{"grade_smooth", streams.GradeSmooth != nil},
+	} {
+		if stream.present {
+			names = append(names, stream.name)
+		}
+	}
+	return names
+}
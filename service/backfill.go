@@ -0,0 +1,306 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"stravamcp/model"
+	"stravamcp/pkg/client"
+	"stravamcp/repo"
+	"sync"
+	"time"
+)
+
+var ErrBackfillRunning = errors.New("a backfill is already running")
+
+// BackfillService downloads the full activity history in the background. Progress is saved to the
+// data folder after every page, so the job survives rate limits and restarts.
+type BackfillService interface {
+	// Start begins a backfill of every activity since the given time. An unfinished job with the
+	// same start continues from its cursor.
+	Start(since time.Time) (*repo.BackfillState, error)
+	// Resume restarts a saved job that was running or paused when the process stopped.
+	Resume() error
+	Status() (*SyncStatus, error)
+	// Stop ends the background job at the next page and waits for it.
+	Stop()
+}
+
+type SyncStatus struct {
+	Sync      *repo.SyncState     `json:"sync,omitempty"`
+	Backfill  *repo.BackfillState `json:"backfill,omitempty"`
+	RateLimit *client.RateLimit   `json:"rate_limit,omitempty"`
+}
+
+type backfillService struct {
+	activities   activityCache
+	stravaClient client.StravaClient
+	tokenRepo    repo.TokenRepo
+	storage      repo.Storage
+	mu           sync.Mutex
+	running      bool
+	done         chan struct{}
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewBackfillService returns a backfill that caches activities through the given activity
+// service, sharing its locks on the files that syncs update as well.
+func NewBackfillService(activities ActivityService, stravaClient client.StravaClient, tokenRepo repo.TokenRepo, storage repo.Storage) BackfillService {
+	return &backfillService{
+		activities:   activities,
+		stravaClient: stravaClient,
+		tokenRepo:    tokenRepo,
+		storage:      storage,
+		stop:         make(chan struct{}),
+	}
+}
+
+func (b *backfillService) Start(since time.Time) (*repo.BackfillState, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running {
+		return nil, ErrBackfillRunning
+	}
+
+	state, err := b.storage.GetBackfillState()
+	if err != nil {
+		return nil, err
+	}
+	sinceDate := since.UTC().Format(time.RFC3339)
+	now := time.Now().UTC().Format(time.RFC3339)
+	if state == nil || state.Status == repo.BackfillCompleted || state.Since != sinceDate {
+		state = &repo.BackfillState{Since: sinceDate, Before: now, StartedAt: now}
+	}
+	state.Status = repo.BackfillRunning
+	state.ResumeAt = ""
+	state.LastError = ""
+	state.UpdatedAt = now
+	if err := b.storage.SaveBackfillState(state); err != nil {
+		return nil, err
+	}
+	b.launch(*state)
+	return state, nil
+}
+
+func (b *backfillService) Resume() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.running {
+		return nil
+	}
+	state, err := b.storage.GetBackfillState()
+	if err != nil {
+		return err
+	}
+	if state == nil || (state.Status != repo.BackfillRunning && state.Status != repo.BackfillPaused) {
+		return nil
+	}
+	slog.Info("Resuming backfill", "since", state.Since, "before", state.Before, "status", state.Status)
+	b.launch(*state)
+	return nil
+}
+
+func (b *backfillService) Status() (*SyncStatus, error) {
+	syncState, err := b.storage.GetSyncState()
+	if err != nil {
+		return nil, err
+	}
+	backfill, err := b.storage.GetBackfillState()
+	if err != nil {
+		return nil, err
+	}
+	status := &SyncStatus{Sync: syncState, Backfill: backfill}
+	if limit := b.stravaClient.RateLimit(); limit.Known() {
+		status.RateLimit = &limit
+	}
+	return status, nil
+}
+
+func (b *backfillService) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+	})
+	b.mu.Lock()
+	done := b.done
+	b.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// launch starts the job goroutine. The caller holds b.mu.
+func (b *backfillService) launch(state repo.BackfillState) {
+	b.running = true
+	b.done = make(chan struct{})
+	go b.run(&state, b.done)
+}
+
+func (b *backfillService) run(state *repo.BackfillState, done chan struct{}) {
+	defer func() {
+		b.mu.Lock()
+		b.running = false
+		b.mu.Unlock()
+		close(done)
+	}()
+
+	for {
+		if state.Status == repo.BackfillPaused {
+			if resumeAt, err := time.Parse(time.RFC3339, state.ResumeAt); err == nil {
+				select {
+				case <-time.After(time.Until(resumeAt)):
+				case <-b.stop:
+					return
+				}
+			}
+			state.Status = repo.BackfillRunning
+			state.ResumeAt = ""
+		}
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+
+		if err := b.step(state); err != nil {
+			slog.Error("Backfill failed", "before", state.Before, "error", err)
+			state.Status = repo.BackfillFailed
+			state.LastError = err.Error()
+		}
+		state.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		if err := b.storage.SaveBackfillState(state); err != nil {
+			slog.Error("Failed to save backfill state", "error", err)
+			return
+		}
+		if state.Status == repo.BackfillCompleted || state.Status == repo.BackfillFailed {
+			return
+		}
+	}
+}
+
+// step processes the page of activities that started just before the cursor and moves the cursor
+// past every activity that is now fully cached.
+func (b *backfillService) step(state *repo.BackfillState) error {
+	if !b.activities.hasRateLimitBudget(1) {
+		b.pause(state, nil)
+		return nil
+	}
+	before, err := time.Parse(time.RFC3339, state.Before)
+	if err != nil {
+		return fmt.Errorf("invalid backfill cursor %q: %w", state.Before, err)
+	}
+	since, err := time.Parse(time.RFC3339, state.Since)
+	if err != nil {
+		return fmt.Errorf("invalid backfill start %q: %w", state.Since, err)
+	}
+	token, err := b.tokenRepo.Get()
+	if err != nil {
+		return err
+	}
+
+	// Strava lists pages newest first only without a lower bound; given both bounds it lists them
+	// oldest first. So only before is sent, and activities older than the start are dropped here.
+	listed, err := b.stravaClient.GetAthleteActivitiesBefore(0, int(before.Unix()), token.AccessToken)
+	if errors.Is(err, client.ErrRateLimited) {
+		b.pause(state, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var page []model.AthleteActivity
+	reachedSince := false
+	for _, activity := range listed {
+		if start, err := time.Parse(time.RFC3339, activity.StartDate); err == nil && start.Before(since) {
+			reachedSince = true
+			continue
+		}
+		page = append(page, activity)
+	}
+	if len(page) == 0 {
+		b.complete(state)
+		return nil
+	}
+
+	result := &SyncResult{}
+	pending, err := b.activities.saveSummaries(page, result)
+	if err != nil {
+		return err
+	}
+	b.activities.fetchStreams(token.AccessToken, pending, result)
+
+	// Without a rate limit the whole page is done and failures are only counted. Otherwise the
+	// cursor stays just above the newest activity still missing its stream.
+	cursor := ""
+	for _, activity := range page {
+		if cursor == "" || activity.StartDate < cursor {
+			cursor = activity.StartDate
+		}
+	}
+	if result.RateLimited {
+		for _, failure := range result.Failed {
+			start, err := time.Parse(time.RFC3339, failure.StartDate)
+			if err != nil {
+				continue
+			}
+			if after := start.Add(time.Second).UTC().Format(time.RFC3339); after > cursor {
+				cursor = after
+			}
+		}
+	}
+
+	missing := make(map[int64]bool, len(pending))
+	for _, activity := range pending {
+		missing[activity.ID] = true
+	}
+	failed := make(map[int64]bool, len(result.Failed))
+	for _, failure := range result.Failed {
+		failed[failure.ActivityID] = true
+	}
+	for _, activity := range page {
+		if activity.StartDate < cursor {
+			continue
+		}
+		state.Listed++
+		switch {
+		case !missing[activity.ID]:
+			state.Skipped++
+		case failed[activity.ID]:
+			state.Failed++
+		default:
+			state.Fetched++
+		}
+	}
+	if !result.RateLimited && len(result.Failed) > 0 {
+		state.LastError = result.Failed[len(result.Failed)-1].Error
+	}
+	state.Before = cursor
+	slog.Info("Backfill page done", "before", state.Before, "listed", state.Listed, "fetched", state.Fetched)
+
+	if result.RateLimited {
+		b.pause(state, nil)
+	} else if reachedSince {
+		b.complete(state)
+	}
+	return nil
+}
+
+func (b *backfillService) complete(state *repo.BackfillState) {
+	slog.Info("Backfill completed", "since", state.Since, "listed", state.Listed, "fetched", state.Fetched)
+	state.Status = repo.BackfillCompleted
+}
+
+// pause schedules the job to continue when the exhausted rate-limit window resets.
+func (b *backfillService) pause(state *repo.BackfillState, err error) {
+	now := time.Now()
+	resumeAt := client.ShortWindowReset(now)
+	if limit := b.stravaClient.RateLimit(); limit.Known() && limit.ResetAt().After(now) {
+		resumeAt = limit.ResetAt()
+	}
+	state.Status = repo.BackfillPaused
+	state.ResumeAt = resumeAt.UTC().Format(time.RFC3339)
+	if err != nil {
+		state.LastError = err.Error()
+	}
+	slog.Info("Backfill paused on rate limit", "resume_at", state.ResumeAt, "before", state.Before)
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"stravamcp/model"
+	"stravamcp/pkg/client"
+	"stravamcp/repo"
+	"testing"
+	"time"
+)
+
+// fakeStrava lists activities like Strava: newest first without a lower bound and oldest first
+// when both after and before are given, a page at a time.
+type fakeStrava struct {
+	client.StravaClient
+	activities []model.AthleteActivity
+	perPage    int
+}
+
+func (f *fakeStrava) GetAthleteActivitiesBefore(after, before int, _ string) ([]model.AthleteActivity, error) {
+	var page []model.AthleteActivity
+	for _, activity := range f.activities {
+		start, _ := time.Parse(time.RFC3339, activity.StartDate)
+		if start.Unix() < int64(before) && (after == 0 || start.Unix() > int64(after)) {
+			page = append(page, activity)
+		}
+	}
+	slices.SortFunc(page, func(a, b model.AthleteActivity) int {
+		if after > 0 {
+			return cmp.Compare(a.StartDate, b.StartDate)
+		}
+		return cmp.Compare(b.StartDate, a.StartDate)
+	})
+	return page[:min(len(page), f.perPage)], nil
+}
+
+func (f *fakeStrava) FetchStreams(string, []string, string) (*model.ActivityStreams, error) {
+	second := 0.0
+	return &model.ActivityStreams{Time: &model.StreamData{Data: []*float64{&second}}}, nil
+}
+
+func (f *fakeStrava) RateLimit() client.RateLimit {
+	return client.RateLimit{}
+}
+
+type fakeTokenRepo struct{}
+
+func (fakeTokenRepo) Get() (*model.RedirectTokenResponse, error) {
+	return &model.RedirectTokenResponse{AccessToken: "token"}, nil
+}
+
+func TestBackfillStepFetchesWholeRange(t *testing.T) {
+	first := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	strava := &fakeStrava{perPage: 3}
+	for day := range 10 {
+		strava.activities = append(strava.activities, model.AthleteActivity{
+			ID:        int64(day + 1),
+			Type:      "Run",
+			SportType: "Run",
+			StartDate: first.AddDate(0, 0, day).Format(time.RFC3339),
+		})
+	}
+	storage := repo.NewStorage(t.TempDir())
+	activities := NewActivityService(strava, fakeTokenRepo{}, storage, SyncConfig{Concurrency: 2})
+	b := NewBackfillService(activities, strava, fakeTokenRepo{}, storage).(*backfillService)
+
+	// The backfill starts on the third day, so the first two activities stay out of the cache.
+	since := first.AddDate(0, 0, 2)
+	state := &repo.BackfillState{
+		Since:  since.Format(time.RFC3339),
+		Before: first.AddDate(0, 0, 30).Format(time.RFC3339),
+		Status: repo.BackfillRunning,
+	}
+	for steps := 0; state.Status == repo.BackfillRunning; steps++ {
+		if steps == 10 {
+			t.Fatalf("backfill still running after %d steps, cursor %s", steps, state.Before)
+		}
+		if err := b.step(state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if state.Status != repo.BackfillCompleted {
+		t.Fatalf("status %q, want %q", state.Status, repo.BackfillCompleted)
+	}
+	if state.Fetched != 8 || state.Listed != 8 {
+		t.Errorf("listed %d and fetched %d activities, want 8 and 8", state.Listed, state.Fetched)
+	}
+	for _, activity := range strava.activities {
+		id := fmt.Sprintf("%d", activity.ID)
+		stream, err := storage.GetActivityStream(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := activity.ID > 2; (stream != nil) != want {
+			t.Errorf("activity %s: stream cached %t, want %t", id, stream != nil, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"stravamcp/model"
+	"stravamcp/pkg/analytics"
+	"stravamcp/pkg/sport"
+	"stravamcp/repo"
+)
+
+var ErrNoElevationData = errors.New("activity has no altitude and distance streams to find climbs in")
+
+type ActivityClimbs struct {
+	ActivityID int64  `json:"activity_id"`
+	Name       string `json:"name"`
+	SportType  string `json:"sport_type"`
+	Date       string `json:"date"`
+	// ReportedGain is Strava's total_elevation_gain, to compare with the smoothed gain.
+	ReportedGain float64 `json:"reported_gain"`
+	analytics.ClimbProfile
+}
+
+// GetClimbs returns the climbs of an activity, fetching its stream like GetActivityStream when
+// it is not cached.
+func (a *activityService) GetClimbs(_ context.Context, id string) (*ActivityClimbs, error) {
+	activity, streams, err := a.loadActivityAndStreams(id)
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := analytics.DetectClimbs(streams)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoElevationData, id)
+	}
+	if err := saveClimbs(a.storage, id, &profile); err != nil {
+		return nil, err
+	}
+	return &ActivityClimbs{
+		ActivityID:   activity.ID,
+		Name:         activity.Name,
+		SportType:    sport.Of(activity),
+		Date:         localDate(activity),
+		ReportedGain: activity.TotalElevationGain,
+		ClimbProfile: profile,
+	}, nil
+}
+
+// GetCachedClimbs returns the climb profiles saved with the cached streams of the given
+// activities, without fetching anything. Activities without one are left out.
+func (a *activityService) GetCachedClimbs(_ context.Context, activities []model.AthleteActivity) (map[int64]analytics.ClimbProfile, error) {
+	profiles := map[int64]analytics.ClimbProfile{}
+	for _, activity := range activities {
+		profile, err := loadClimbs(a.storage, fmt.Sprintf("%d", activity.ID))
+		if err != nil {
+			return nil, err
+		}
+		if profile != nil {
+			profiles[activity.ID] = *profile
+		}
+	}
+	return profiles, nil
+}
+
+// saveStream caches a stream together with the climbs found in it, which activity summaries
+// read without loading the stream.
+func saveStream(storage repo.Storage, id string, streams *model.ActivityStreams) error {
+	if err := storage.SaveActivityStream(id, streams); err != nil {
+		return err
+	}
+	profile, ok := analytics.DetectClimbs(streams)
+	if !ok {
+		return nil
+	}
+	return saveClimbs(storage, id, &profile)
+}
+
+// loadClimbs returns the climb profile saved with a cached stream, or nil when there is none.
+func loadClimbs(storage repo.Storage, id string) (*analytics.ClimbProfile, error) {
+	data, err := storage.GetActivityClimbs(id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var profile analytics.ClimbProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to decode climbs of %s: %w", id, err)
+	}
+	return &profile, nil
+}
+
+func saveClimbs(storage repo.Storage, id string, profile *analytics.ClimbProfile) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	return storage.SaveActivityClimbs(id, data)
+}
+
+// detectCachedClimbs computes the climbs of streams cached before climbs were saved with them.
+func detectCachedClimbs(storage repo.Storage) error {
+	ids, err := storage.GetActivityStreamIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		climbs, err := storage.GetActivityClimbs(id)
+		if err != nil {
+			return err
+		}
+		if climbs != nil {
+			continue
+		}
+		streams, err := storage.GetActivityStream(id)
+		if err != nil {
+			slog.Warn("Unable to read stream for climbs", "id", id, "error", err)
+			continue
+		}
+		if streams == nil {
+			continue
+		}
+		if profile, ok := analytics.DetectClimbs(streams); ok {
+			if err := saveClimbs(storage, id, &profile); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
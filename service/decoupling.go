@@ -0,0 +1,166 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"stravamcp/model"
+	"stravamcp/pkg/analytics"
+	"stravamcp/pkg/sport"
+	"time"
+)
+
+var ErrNoDecouplingData = errors.New("decoupling needs at least 20 minutes of moving time with heart rate and power or speed")
+
+// similarDuration is how far, as a fraction, the moving time of a similar activity may differ.
+const similarDuration = 0.25
+
+// maxTrendActivities caps the efficiency factor trend to the most recent similar activities.
+const maxTrendActivities = 20
+
+type ActivityDecoupling struct {
+	ActivityID int64  `json:"activity_id"`
+	Name       string `json:"name"`
+	SportType  string `json:"sport_type"`
+	Date       string `json:"date"`
+	analytics.Decoupling
+	Trend EfficiencyTrend `json:"trend"`
+}
+
+// EfficiencyTrend is the efficiency factor of cached activities of the same sport and method
+// whose moving time is within 25% of the analysed one, oldest first.
+type EfficiencyTrend struct {
+	Activities []EfficiencyPoint `json:"activities"`
+	// ChangePerMonth is the least-squares slope of EF per 30 days, as a percentage of the mean
+	// EF. It needs three activities.
+	ChangePerMonth *float64 `json:"change_per_month,omitempty"`
+}
+
+type EfficiencyPoint struct {
+	ActivityID int64   `json:"activity_id"`
+	Name       string  `json:"name"`
+	Date       string  `json:"date"`
+	EF         float64 `json:"ef"`
+	Decoupling float64 `json:"decoupling"`
+}
+
+// GetDecoupling computes aerobic decoupling of an activity, fetching its stream like
+// GetActivityStream when it is not cached. Runs compare pace to heart rate, other sports power
+// when there is a watts stream and pace otherwise. The trend only reads the cache.
+func (a *activityService) GetDecoupling(_ context.Context, id string) (*ActivityDecoupling, error) {
+	activity, streams, err := a.loadActivityAndStreams(id)
+	if err != nil {
+		return nil, err
+	}
+	if !analytics.Has(streams.Heartrate) {
+		return nil, fmt.Errorf("%w: %s", ErrNoHeartRateData, id)
+	}
+	method := decouplingMethod(activity, streams)
+	decoupling, ok := analytics.Decouple(streams, method)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoDecouplingData, id)
+	}
+	trend, err := a.efficiencyTrend(activity, method)
+	if err != nil {
+		return nil, err
+	}
+	return &ActivityDecoupling{
+		ActivityID: activity.ID,
+		Name:       activity.Name,
+		SportType:  sport.Of(activity),
+		Date:       localDate(activity),
+		Decoupling: decoupling,
+		Trend:      trend,
+	}, nil
+}
+
+func decouplingMethod(activity *model.AthleteActivity, streams *model.ActivityStreams) string {
+	if usesPower(activity, streams) {
+		return analytics.PowerHR
+	}
+	return analytics.PaceHR
+}
+
+// usesPower reports whether an activity is analysed by power rather than pace: runs go by pace
+// even with a running power meter.
+func usesPower(activity *model.AthleteActivity, streams *model.ActivityStreams) bool {
+	running, _ := sport.Resolve("running")
+	return !running.Contains(activity) && analytics.Has(streams.Watts)
+}
+
+func (a *activityService) efficiencyTrend(activity *model.AthleteActivity, method string) (EfficiencyTrend, error) {
+	trend := EfficiencyTrend{Activities: []EfficiencyPoint{}}
+	activities, err := a.storage.GetAllAthleteActivities()
+	if err != nil {
+		return trend, err
+	}
+	slices.SortFunc(activities, func(a, b model.AthleteActivity) int {
+		return cmp.Compare(b.StartDate, a.StartDate)
+	})
+	low := float64(activity.MovingTime) * (1 - similarDuration)
+	high := float64(activity.MovingTime) * (1 + similarDuration)
+	for _, candidate := range activities {
+		if len(trend.Activities) == maxTrendActivities {
+			break
+		}
+		moving := float64(candidate.MovingTime)
+		if sport.Of(&candidate) != sport.Of(activity) || moving < low || moving > high {
+			continue
+		}
+		streams, err := a.storage.GetActivityStream(fmt.Sprintf("%d", candidate.ID))
+		if err != nil {
+			return trend, err
+		}
+		if streams == nil || decouplingMethod(&candidate, streams) != method {
+			continue
+		}
+		decoupling, ok := analytics.Decouple(streams, method)
+		if !ok {
+			continue
+		}
+		trend.Activities = append(trend.Activities, EfficiencyPoint{
+			ActivityID: candidate.ID,
+			Name:       candidate.Name,
+			Date:       localDate(&candidate),
+			EF:         decoupling.EF,
+			Decoupling: decoupling.Percent,
+		})
+	}
+	slices.Reverse(trend.Activities)
+	trend.ChangePerMonth = efficiencySlope(trend.Activities)
+	return trend, nil
+}
+
+// efficiencySlope fits EF against the day of each activity.
+func efficiencySlope(points []EfficiencyPoint) *float64 {
+	if len(points) < 3 {
+		return nil
+	}
+	var days, efs []float64
+	for _, point := range points {
+		day, err := time.Parse("2006-01-02", point.Date)
+		if err != nil {
+			continue
+		}
+		days = append(days, day.Sub(time.Unix(0, 0)).Hours()/24)
+		efs = append(efs, point.EF)
+	}
+	n := float64(len(days))
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range days {
+		sumX += days[i]
+		sumY += efs[i]
+		sumXY += days[i] * efs[i]
+		sumXX += days[i] * days[i]
+	}
+	denominator := n*sumXX - sumX*sumX
+	if n < 3 || denominator == 0 || sumY == 0 {
+		return nil
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	change := math.Round(slope*30/(sumY/n)*1000) / 10
+	return &change
+}
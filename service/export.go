@@ -0,0 +1,155 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"stravamcp/model"
+	"stravamcp/pkg/geo"
+	"stravamcp/pkg/trackfile"
+	"strings"
+	"time"
+)
+
+var ErrInvalidFileName = errors.New("invalid file name")
+
+type ActivityExport struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+	// Approximate is set when positions come from the summary polyline instead of the latlng stream.
+	Approximate bool
+}
+
+// SaveExport writes an export to the exports folder of the data folder, under the given file name
+// or its own without one, and returns the path written. The name cannot point outside the folder.
+func (a *activityService) SaveExport(_ context.Context, export *ActivityExport, fileName string) (string, error) {
+	if fileName == "" {
+		fileName = export.FileName
+	}
+	if fileName != filepath.Base(fileName) || fileName == "." || fileName == ".." || strings.ContainsAny(fileName, `/\`) {
+		return "", fmt.Errorf("%w %q: give a file name without a directory", ErrInvalidFileName, fileName)
+	}
+	return a.storage.SaveExport(fileName, export.Data)
+}
+
+func (a *activityService) ExportActivity(_ context.Context, id string, format trackfile.Format) (*ActivityExport, error) {
+	activity, streams, err := a.loadActivityAndStreams(id)
+	if err != nil {
+		return nil, err
+	}
+
+	approximate := false
+	if streams.LatLng == nil && activity.Map.SummaryPolyline != "" {
+		route, err := geo.DecodePolyline(activity.Map.SummaryPolyline)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode summary polyline of activity %s: %w", id, err)
+		}
+		streams = withRoute(activity, streams, route)
+		approximate = true
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case trackfile.FormatTCX:
+		err = trackfile.WriteTCX(&buf, activity, streams)
+	default:
+		if streams.LatLng == nil {
+			return nil, fmt.Errorf("activity %s has no GPS data to export as GPX", id)
+		}
+		err = trackfile.WriteGPX(&buf, activity, streams)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ActivityExport{
+		FileName:    fmt.Sprintf("strava-%s.%s", id, format),
+		ContentType: format.ContentType(),
+		Data:        buf.Bytes(),
+		Approximate: approximate,
+	}, nil
+}
+
+// withRoute adds positions taken from a decoded summary polyline. Recorded samples are placed
+// along the route by their share of the total distance, or of the total time without a distance
+// stream. Activities without a time stream get one point per polyline vertex spread evenly over
+// the elapsed time.
+func withRoute(activity *model.AthleteActivity, streams *model.ActivityStreams, route [][]float64) *model.ActivityStreams {
+	if len(route) == 0 {
+		return streams
+	}
+	if streams.Time == nil || len(streams.Time.Data) == 0 {
+		start, _ := time.Parse(time.RFC3339, activity.StartDate)
+		step := 0.0
+		if len(route) > 1 {
+			step = float64(activity.ElapsedTime) / float64(len(route)-1)
+		}
+		points := make([]trackfile.Point, len(route))
+		for i, position := range route {
+			points[i] = trackfile.Point{
+				Time: start.Add(time.Duration(float64(i) * step * float64(time.Second))),
+				Lat:  &position[0],
+				Lng:  &position[1],
+			}
+		}
+		return trackfile.BuildStreams(points)
+	}
+
+	progress := streams.Distance
+	if progress == nil {
+		progress = streams.Time
+	}
+	var total float64
+	for _, value := range progress.Data {
+		if value != nil && *value > total {
+			total = *value
+		}
+	}
+
+	// cumulative[i] is the distance along the route up to vertex i.
+	cumulative := make([]float64, len(route))
+	for i := 1; i < len(route); i++ {
+		cumulative[i] = cumulative[i-1] + geo.Haversine(route[i-1][0], route[i-1][1], route[i][0], route[i][1])
+	}
+	length := cumulative[len(cumulative)-1]
+
+	latlng := make([][]float64, len(streams.Time.Data))
+	for i := range latlng {
+		fraction := 0.0
+		if i < len(progress.Data) && progress.Data[i] != nil && total > 0 {
+			fraction = *progress.Data[i] / total
+		}
+		latlng[i] = interpolateRoute(route, cumulative, fraction*length)
+	}
+
+	withLatLng := *streams
+	withLatLng.LatLng = &model.LatLngStreamData{
+		Data:         latlng,
+		SeriesType:   streams.Time.SeriesType,
+		OriginalSize: int32(len(latlng)),
+		Resolution:   "low",
+	}
+	return &withLatLng
+}
+
+func interpolateRoute(route [][]float64, cumulative []float64, target float64) []float64 {
+	i := sort.SearchFloat64s(cumulative, target)
+	if i == 0 {
+		return route[0]
+	}
+	if i >= len(route) {
+		return route[len(route)-1]
+	}
+	segment := cumulative[i] - cumulative[i-1]
+	if segment == 0 {
+		return route[i]
+	}
+	t := (target - cumulative[i-1]) / segment
+	return []float64{
+		route[i-1][0] + t*(route[i][0]-route[i-1][0]),
+		route[i-1][1] + t*(route[i][1]-route[i-1][1]),
+	}
+}
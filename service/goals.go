@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"stravamcp/pkg/sport"
+	"stravamcp/repo"
+	"time"
+)
+
+var ErrInvalidGoal = errors.New("invalid goal")
+
+// goalMetric reads a goal metric from summary totals, in the unit goals are set in.
+type goalMetric struct {
+	Unit  string
+	value func(totals SummaryTotals) float64
+}
+
+var goalMetrics = map[string]goalMetric{
+	"distance":       {Unit: "km", value: func(t SummaryTotals) float64 { return t.Distance / 1000 }},
+	"moving_time":    {Unit: "h", value: func(t SummaryTotals) float64 { return float64(t.MovingTime) / 3600 }},
+	"elevation_gain": {Unit: "m", value: func(t SummaryTotals) float64 { return t.ElevationGain }},
+	"activities":     {Unit: "activities", value: func(t SummaryTotals) float64 { return float64(t.Activities) }},
+}
+
+// GoalProgress is how far a goal is in its current period. Current counts the activities from
+// Start up to AsOf and LastYear the same span one year earlier, by local start date. Projected
+// extrapolates Current at the same daily rate to the end of the period; it is nil before the
+// period has started.
+type GoalProgress struct {
+	Goal          repo.Goal `json:"goal"`
+	Description   string    `json:"description"`
+	Unit          string    `json:"unit"`
+	Start         string    `json:"start"`
+	End           string    `json:"end"`
+	AsOf          string    `json:"as_of"`
+	ElapsedDays   int       `json:"elapsed_days"`
+	TotalDays     int       `json:"total_days"`
+	Current       float64   `json:"current"`
+	Percent       float64   `json:"percent"`
+	Remaining     float64   `json:"remaining"`
+	LastYear      float64   `json:"last_year"`
+	Change        float64   `json:"change"`
+	ChangePercent *float64  `json:"change_percent,omitempty"`
+	Projected     *float64  `json:"projected,omitempty"`
+	OnTrack       *bool     `json:"on_track,omitempty"`
+}
+
+type GoalProgressList struct {
+	AsOf  string         `json:"as_of"`
+	Goals []GoalProgress `json:"goals"`
+}
+
+// GetGoals returns the goals configured in the data folder.
+func (s *analyticsService) GetGoals(_ context.Context) ([]repo.Goal, error) {
+	return s.storage.GetGoals()
+}
+
+// SaveGoals replaces the configured goals after validating them.
+func (s *analyticsService) SaveGoals(_ context.Context, goals []repo.Goal) error {
+	for _, goal := range goals {
+		if err := validateGoal(goal); err != nil {
+			return err
+		}
+	}
+	return s.storage.SaveGoals(goals)
+}
+
+func validateGoal(goal repo.Goal) error {
+	if _, ok := goalMetrics[goal.Metric]; !ok {
+		return fmt.Errorf("%w: unsupported metric %q (use distance, moving_time, elevation_gain or activities)", ErrInvalidGoal, goal.Metric)
+	}
+	if goal.Target <= 0 {
+		return fmt.Errorf("%w: target must be positive", ErrInvalidGoal)
+	}
+	if goal.Period == "" {
+		return fmt.Errorf("%w: missing period (use week, month or year)", ErrInvalidGoal)
+	}
+	if _, err := ParseGrouping(goal.Period); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidGoal, err)
+	}
+	if goal.Year != 0 && goal.Period != string(GroupByYear) {
+		return fmt.Errorf("%w: only yearly goals can be pinned to a year", ErrInvalidGoal)
+	}
+	if goal.Sport != "" {
+		if _, err := sport.Resolve(goal.Sport); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidGoal, err)
+		}
+	}
+	return nil
+}
+
+// GetGoalProgress compares every configured goal with the cached activities of its current
+// period, or of its year when it is pinned to one.
+func (s *analyticsService) GetGoalProgress(_ context.Context) (*GoalProgressList, error) {
+	goals, err := s.storage.GetGoals()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	result := &GoalProgressList{AsOf: today.Format("2006-01-02"), Goals: []GoalProgress{}}
+	if len(goals) == 0 {
+		return result, nil
+	}
+	activities, err := s.cachedActivities()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, goal := range goals {
+		if err := validateGoal(goal); err != nil {
+			return nil, err
+		}
+		groupBy := Grouping(goal.Period)
+		metric := goalMetrics[goal.Metric]
+		start := groupBy.periodStart(today)
+		if goal.Year != 0 {
+			start = time.Date(goal.Year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}
+		end := groupBy.shift(start, 1)
+		asOf := today
+		if !asOf.Before(end) {
+			asOf = end.AddDate(0, 0, -1)
+		}
+		var sports sport.Set
+		if goal.Sport != "" {
+			sports, _ = sport.Resolve(goal.Sport)
+		}
+
+		var current, lastYear SummaryTotals
+		lastYearStart, lastYearAsOf := yearEarlier(groupBy, start), yearEarlier(groupBy, asOf)
+		for _, activity := range activities {
+			if sports != nil && !sports.Contains(&activity) {
+				continue
+			}
+			day, err := time.Parse("2006-01-02", localDate(&activity))
+			if err != nil {
+				continue
+			}
+			if !day.Before(start) && !day.After(asOf) {
+				current.add(&activity)
+			}
+			if !day.Before(lastYearStart) && !day.After(lastYearAsOf) {
+				lastYear.add(&activity)
+			}
+		}
+		current.finish()
+		lastYear.finish()
+
+		progress := GoalProgress{
+			Goal:        goal,
+			Description: describeGoal(goal, metric),
+			Unit:        metric.Unit,
+			Start:       start.Format("2006-01-02"),
+			End:         end.AddDate(0, 0, -1).Format("2006-01-02"),
+			AsOf:        asOf.Format("2006-01-02"),
+			ElapsedDays: max(int(asOf.Sub(start).Hours()/24)+1, 0),
+			TotalDays:   int(end.Sub(start).Hours() / 24),
+			Current:     round1(metric.value(current)),
+			LastYear:    round1(metric.value(lastYear)),
+		}
+		progress.Percent = round1(progress.Current / goal.Target * 100)
+		progress.Remaining = round1(math.Max(goal.Target-progress.Current, 0))
+		progress.Change = round1(progress.Current - progress.LastYear)
+		progress.ChangePercent = percentChange(progress.Current, progress.LastYear)
+		if progress.ElapsedDays > 0 {
+			projected := round1(progress.Current / float64(progress.ElapsedDays) * float64(progress.TotalDays))
+			onTrack := projected >= goal.Target
+			progress.Projected, progress.OnTrack = &projected, &onTrack
+		}
+		result.Goals = append(result.Goals, progress)
+	}
+	return result, nil
+}
+
+// yearEarlier moves a day back one year; weeks move back 52 weeks so that they keep their weekday.
+func yearEarlier(groupBy Grouping, day time.Time) time.Time {
+	if groupBy == GroupByWeek {
+		return day.AddDate(0, 0, -364)
+	}
+	return day.AddDate(-1, 0, 0)
+}
+
+// describeGoal names a goal that has none, e.g. "5000 km in 2026 (cycling)" or "3 activities per week (runs)".
+func describeGoal(goal repo.Goal, metric goalMetric) string {
+	if goal.Name != "" {
+		return goal.Name
+	}
+	description := fmt.Sprintf("%g %s per %s", goal.Target, metric.Unit, goal.Period)
+	if goal.Year != 0 {
+		description = fmt.Sprintf("%g %s in %d", goal.Target, metric.Unit, goal.Year)
+	}
+	if goal.Sport != "" {
+		description += fmt.Sprintf(" (%s)", goal.Sport)
+	}
+	return description
+}
+
+func round1(value float64) float64 {
+	return math.Round(value*10) / 10
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"stravamcp/model"
+	"stravamcp/pkg/analytics"
+	"stravamcp/pkg/sport"
+)
+
+var ErrNoIntervalData = errors.New("activity has no power or speed stream to detect intervals in")
+
+type ActivityIntervals struct {
+	ActivityID int64  `json:"activity_id"`
+	Name       string `json:"name"`
+	SportType  string `json:"sport_type"`
+	Date       string `json:"date"`
+	Laps       int    `json:"laps"`
+	analytics.Intervals
+}
+
+// DetectIntervals segments an activity into work and rest blocks, fetching its stream like
+// GetActivityStream and its laps when they are not cached. Runs are split on pace, other sports
+// on power when there is a watts stream and on pace otherwise.
+func (a *activityService) DetectIntervals(_ context.Context, id string) (*ActivityIntervals, error) {
+	activity, streams, err := a.loadActivityAndStreams(id)
+	if err != nil {
+		return nil, err
+	}
+	laps, err := a.loadLaps(id)
+	if err != nil {
+		return nil, err
+	}
+	signal := analytics.SignalPace
+	if usesPower(activity, streams) {
+		signal = analytics.SignalPower
+	}
+	intervals, ok := analytics.DetectIntervals(streams, laps, signal)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoIntervalData, id)
+	}
+	return &ActivityIntervals{
+		ActivityID: activity.ID,
+		Name:       activity.Name,
+		SportType:  sport.Of(activity),
+		Date:       localDate(activity),
+		Laps:       len(laps),
+		Intervals:  intervals,
+	}, nil
+}
+
+// loadLaps reads the laps of an activity, fetching and caching them on first use. Laps only
+// refine the detection, so a failed fetch is logged and the activity analysed without them.
+func (a *activityService) loadLaps(id string) ([]model.Lap, error) {
+	laps, err := a.storage.GetActivityLaps(id)
+	if err != nil || laps != nil {
+		return laps, err
+	}
+	token, err := a.tokenRepo.Get()
+	if err != nil {
+		return nil, err
+	}
+	laps, err = a.stravaClient.GetActivityLaps(id, token.AccessToken)
+	if err != nil {
+		slog.Warn("Unable to fetch laps", "activity", id, "error", err)
+		return nil, nil
+	}
+	if err := a.storage.SaveActivityLaps(id, laps); err != nil {
+		return nil, err
+	}
+	return laps, nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"stravamcp/model"
+	"stravamcp/pkg/geo"
+	"stravamcp/pkg/sport"
+	"time"
+)
+
+var ErrInvalidLocation = errors.New("invalid location query")
+
+// defaultLocationRadius is the radius, in meters, of point queries that do not give one, and
+// maxLocationRadius the largest one accepted.
+const (
+	defaultLocationRadius = 500
+	maxLocationRadius     = 50000
+)
+
+// LocationQuery selects activities by where they went: within Radius meters of Lat and Lng, or
+// through Box, or with Within completely inside it. Sport, After and Before narrow it further
+// like in GetAllActivities, and a Limit above zero caps the number of activities returned.
+type LocationQuery struct {
+	Lat    *float64
+	Lng    *float64
+	Radius float64
+	Box    *geo.BoundingBox
+	Within bool
+	Sport  string
+	After  *time.Time
+	Before *time.Time
+	Limit  int
+}
+
+// LocationMatch is an activity found by a location search. Distance is the shortest distance in
+// meters from the query point to its route, and Approximate is set for activities without a map
+// that were located by their start and end only.
+type LocationMatch struct {
+	ActivityID  int64     `json:"activity_id"`
+	Name        string    `json:"name"`
+	SportType   string    `json:"sport_type"`
+	Date        string    `json:"date"`
+	Length      float64   `json:"length"`
+	MovingTime  int       `json:"moving_time"`
+	StartLatLng []float64 `json:"start_latlng,omitempty"`
+	EndLatLng   []float64 `json:"end_latlng,omitempty"`
+	Distance    *float64  `json:"distance,omitempty"`
+	Approximate bool      `json:"approximate,omitempty"`
+}
+
+// LocationSearch lists the matches of a location query, nearest first for point queries and
+// newest first for boxes. Indexed counts the activities with a location and Total the matches
+// before the limit.
+type LocationSearch struct {
+	Point      []float64        `json:"point,omitempty"`
+	Radius     float64          `json:"radius,omitempty"`
+	Box        *geo.BoundingBox `json:"box,omitempty"`
+	Within     bool             `json:"within,omitempty"`
+	Sport      string           `json:"sport,omitempty"`
+	Indexed    int              `json:"indexed"`
+	Total      int              `json:"total"`
+	Activities []LocationMatch  `json:"activities"`
+}
+
+// locationIndex is the spatial index of every cached activity with a location, kept until the
+// cached summaries change.
+type locationIndex struct {
+	version     uint64
+	index       *geo.Index
+	activities  map[int64]*model.AthleteActivity
+	approximate map[int64]bool
+}
+
+// SearchActivitiesByLocation finds cached activities by location. Their routes are decoded from
+// the summary polyline, or taken as the line from the start to the end position without one,
+// and filed in a spatial index that the query is answered from.
+func (s *analyticsService) SearchActivitiesByLocation(_ context.Context, query LocationQuery) (*LocationSearch, error) {
+	if err := validateLocationQuery(&query); err != nil {
+		return nil, err
+	}
+	var sports sport.Set
+	if query.Sport != "" {
+		var err error
+		sports, err = sport.Resolve(query.Sport)
+		if err != nil {
+			return nil, err
+		}
+	}
+	locations, err := s.locationIndex()
+	if err != nil {
+		return nil, err
+	}
+	selected := func(id int64) bool {
+		activity := locations.activities[id]
+		return (sports == nil || sports.Contains(activity)) && inRange(activity, query.After, query.Before)
+	}
+	indexed := 0
+	for id := range locations.activities {
+		if selected(id) {
+			indexed++
+		}
+	}
+
+	result := &LocationSearch{Sport: query.Sport, Indexed: indexed, Activities: []LocationMatch{}}
+	var matches []geo.Match
+	if query.Box != nil {
+		result.Box, result.Within = query.Box, query.Within
+		matches = locations.index.InBox(*query.Box, query.Within)
+	} else {
+		result.Point, result.Radius = []float64{*query.Lat, *query.Lng}, query.Radius
+		matches = locations.index.Near(*query.Lat, *query.Lng, query.Radius)
+	}
+	for _, m := range matches {
+		if !selected(m.ID) {
+			continue
+		}
+		activity := locations.activities[m.ID]
+		match := LocationMatch{
+			ActivityID:  activity.ID,
+			Name:        activity.Name,
+			SportType:   sport.Of(activity),
+			Date:        localDate(activity),
+			Length:      activity.Distance,
+			MovingTime:  activity.MovingTime,
+			StartLatLng: activity.StartLatLng,
+			EndLatLng:   activity.EndLatLng,
+			Approximate: locations.approximate[m.ID],
+		}
+		if query.Box == nil {
+			match.Distance = &m.Distance
+		}
+		result.Activities = append(result.Activities, match)
+	}
+	if query.Box != nil {
+		slices.SortStableFunc(result.Activities, func(a, b LocationMatch) int {
+			return cmp.Compare(b.Date, a.Date)
+		})
+	}
+	result.Total = len(result.Activities)
+	if query.Limit > 0 && len(result.Activities) > query.Limit {
+		result.Activities = result.Activities[:query.Limit]
+	}
+	return result, nil
+}
+
+// locationIndex returns the index of the cached activities, rebuilding it when a summary was
+// saved or removed since it was built, as every sync that finds new activities does.
+func (s *analyticsService) locationIndex() (*locationIndex, error) {
+	s.locationMu.Lock()
+	defer s.locationMu.Unlock()
+	version := s.storage.ActivitiesVersion()
+	if s.locations != nil && s.locations.version == version {
+		return s.locations, nil
+	}
+	activities, err := s.storage.GetAllAthleteActivities()
+	if err != nil {
+		return nil, err
+	}
+	locations := &locationIndex{
+		version:     version,
+		index:       geo.NewIndex(geo.DefaultCellDegrees),
+		activities:  map[int64]*model.AthleteActivity{},
+		approximate: map[int64]bool{},
+	}
+	for i := range activities {
+		activity := &activities[i]
+		track, exact := activityTrack(activity)
+		if len(track) == 0 {
+			continue
+		}
+		locations.index.Add(activity.ID, track)
+		locations.activities[activity.ID] = activity
+		locations.approximate[activity.ID] = !exact
+	}
+	s.locations = locations
+	return locations, nil
+}
+
+func validateLocationQuery(query *LocationQuery) error {
+	point := query.Lat != nil || query.Lng != nil
+	switch {
+	case point && query.Box != nil:
+		return fmt.Errorf("%w: give either a point or a bounding box", ErrInvalidLocation)
+	case query.Box != nil:
+		if err := query.Box.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidLocation, err)
+		}
+	case query.Lat == nil || query.Lng == nil:
+		return fmt.Errorf("%w: give a latitude and longitude or a bounding box", ErrInvalidLocation)
+	case *query.Lat < -90 || *query.Lat > 90 || *query.Lng < -180 || *query.Lng > 180:
+		return fmt.Errorf("%w: point out of range", ErrInvalidLocation)
+	case query.Radius < 0:
+		return fmt.Errorf("%w: radius must not be negative", ErrInvalidLocation)
+	case query.Radius > maxLocationRadius:
+		return fmt.Errorf("%w: radius must be at most %d m", ErrInvalidLocation, maxLocationRadius)
+	case query.Radius == 0:
+		query.Radius = defaultLocationRadius
+	}
+	return nil
+}
+
+// activityTrack is the route of an activity from its summary polyline, and whether it is one;
+// otherwise it is the line from its start to its end position, or nil without either.
+func activityTrack(activity *model.AthleteActivity) ([][]float64, bool) {
+	if activity.Map.SummaryPolyline != "" {
+		if points, err := geo.DecodePolyline(activity.Map.SummaryPolyline); err == nil && len(points) > 0 {
+			return points, true
+		}
+	}
+	var track [][]float64
+	for _, position := range [][]float64{activity.StartLatLng, activity.EndLatLng} {
+		if len(position) == 2 && (position[0] != 0 || position[1] != 0) {
+			track = append(track, position)
+		}
+	}
+	return track, false
+}
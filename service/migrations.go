@@ -0,0 +1,71 @@
+package service
+
+import (
+	"log/slog"
+	"stravamcp/model"
+	"stravamcp/repo"
+)
+
+// migrations lists every upgrade of the data folder layout, keyed by the schema version it produces.
+func (a *activityService) migrations() []repo.Migration {
+	return []repo.Migration{
+		{
+			Version:     2,
+			Description: "queue streams for re-fetch with distance, altitude, velocity, temperature, grade and latlng",
+			Up:          queueLegacyStreams,
+		},
+		{
+			Version:     3,
+			Description: "detect climbs in cached streams",
+			Up:          detectCachedClimbs,
+		},
+		{
+			Version:     4,
+			Description: "build personal records from cached streams",
+			Up:          buildPersonalRecords,
+		},
+	}
+}
+
+func (a *activityService) MigrateStorage() error {
+	return a.storage.Migrate(a.migrations())
+}
+
+// queueLegacyStreams lists the streams cached by schema version 1, which only requested watts,
+// time, heartrate and cadence, for syncs to re-fetch while the rate limit allows. Streams that
+// cannot be read are left as they are.
+func queueLegacyStreams(storage repo.Storage) error {
+	ids, err := storage.GetActivityStreamIDs()
+	if err != nil {
+		return err
+	}
+	var legacy []string
+	for _, id := range ids {
+		stream, err := storage.GetActivityStream(id)
+		if err != nil {
+			slog.Warn("Unable to read stream, not queueing it for re-fetch", "id", id, "error", err)
+			continue
+		}
+		if stream != nil && isLegacyStream(stream) {
+			legacy = append(legacy, id)
+		}
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+	state, err := storage.GetSyncState()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &repo.SyncState{}
+	}
+	state.LegacyStreams = legacy
+	slog.Info("Queued legacy streams for re-fetch", "count", len(legacy))
+	return storage.SaveSyncState(state)
+}
+
+func isLegacyStream(stream *model.ActivityStreams) bool {
+	return stream.Distance == nil && stream.Altitude == nil && stream.VelocitySmooth == nil &&
+		stream.Temp == nil && stream.GradeSmooth == nil && stream.LatLng == nil
+}
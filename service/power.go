@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"stravamcp/pkg/analytics"
+	"stravamcp/pkg/sport"
+	"time"
+)
+
+type PowerAnalysis struct {
+	ActivityID int64   `json:"activity_id"`
+	Name       string  `json:"name"`
+	SportType  string  `json:"sport_type"`
+	Date       string  `json:"date"`
+	FTP        float64 `json:"ftp,omitempty"`
+	analytics.PowerSummary
+}
+
+// GetPowerAnalysis computes normalized power, intensity, variability, work and the mean-maximal
+// power curve of a cached activity. IF and TSS need ATHLETE_FTP.
+func (s *analyticsService) GetPowerAnalysis(_ context.Context, id string) (*PowerAnalysis, error) {
+	activity, streams, err := s.cachedActivity(id)
+	if err != nil {
+		return nil, err
+	}
+	watts := analytics.PerSecond(streams.Time, streams.Watts)
+	if !analytics.Has(streams.Watts) || len(watts) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoPowerData, id)
+	}
+	return &PowerAnalysis{
+		ActivityID:   activity.ID,
+		Name:         activity.Name,
+		SportType:    sport.Of(activity),
+		Date:         localDate(activity),
+		FTP:          s.athlete.FTP,
+		PowerSummary: analytics.AnalyzePower(watts, s.athlete.FTP),
+	}, nil
+}
+
+type PowerCurve struct {
+	After  string `json:"after,omitempty"`
+	Before string `json:"before,omitempty"`
+	// Activities is the number of activities with power in the range.
+	Activities int         `json:"activities"`
+	Curve      []BestPower `json:"curve"`
+	// EstimatedFTP is 95% of the best 20 minute power.
+	EstimatedFTP float64 `json:"estimated_ftp,omitempty"`
+}
+
+// BestPower is the best power for a duration and the activity it was set in.
+type BestPower struct {
+	analytics.CurvePoint
+	ActivityID int64  `json:"activity_id"`
+	Name       string `json:"name"`
+	Date       string `json:"date"`
+}
+
+// GetPowerCurve aggregates the mean-maximal power curves of all cached activities with power that
+// started in the range. Without a range it is the all-time curve.
+func (s *analyticsService) GetPowerCurve(_ context.Context, after *time.Time, before *time.Time) (*PowerCurve, error) {
+	activities, err := s.cachedActivities()
+	if err != nil {
+		return nil, err
+	}
+	result := &PowerCurve{Curve: []BestPower{}}
+	if after != nil {
+		result.After = after.UTC().Format(time.RFC3339)
+	}
+	if before != nil {
+		result.Before = before.UTC().Format(time.RFC3339)
+	}
+
+	best := map[int]BestPower{}
+	for _, activity := range activities {
+		if !inRange(&activity, after, before) {
+			continue
+		}
+		streams, err := s.storage.GetActivityStream(fmt.Sprintf("%d", activity.ID))
+		if err != nil {
+			return nil, err
+		}
+		if streams == nil || !analytics.Has(streams.Watts) {
+			continue
+		}
+		result.Activities++
+		for _, point := range analytics.MeanMaximal(analytics.PerSecond(streams.Time, streams.Watts)) {
+			if current, ok := best[point.Seconds]; !ok || point.Watts > current.Watts {
+				best[point.Seconds] = BestPower{CurvePoint: point, ActivityID: activity.ID, Name: activity.Name, Date: localDate(&activity)}
+			}
+		}
+	}
+
+	var curve []analytics.CurvePoint
+	for _, seconds := range analytics.CurveDurations {
+		if point, ok := best[seconds]; ok {
+			result.Curve = append(result.Curve, point)
+			curve = append(curve, point.CurvePoint)
+		}
+	}
+	result.EstimatedFTP = analytics.EstimateFTP(curve)
+	return result, nil
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"stravamcp/model"
+	"time"
+)
+
+// ReconcileMode decides what happens to cached activities that Strava no longer lists.
+type ReconcileMode string
+
+const (
+	// ReconcileTombstone removes the cached files but keeps the summary in a tombstone.
+	ReconcileTombstone ReconcileMode = "tombstone"
+	// ReconcilePurge removes every trace of the activity.
+	ReconcilePurge ReconcileMode = "purge"
+)
+
+func ParseReconcileMode(value string) (ReconcileMode, error) {
+	switch ReconcileMode(value) {
+	case "", ReconcileTombstone:
+		return ReconcileTombstone, nil
+	case ReconcilePurge:
+		return ReconcilePurge, nil
+	default:
+		return "", fmt.Errorf("unsupported reconcile mode %q (use tombstone or purge)", value)
+	}
+}
+
+const missingReason = "not listed by Strava: deleted, or made private without activity:read_all access"
+
+// ActivityChange lists the tracked fields of a cached activity that differed from Strava.
+type ActivityChange struct {
+	ActivityID int64    `json:"activity_id"`
+	Name       string   `json:"name"`
+	Fields     []string `json:"fields"`
+}
+
+type ReconcileResult struct {
+	After  string `json:"after"`
+	Before string `json:"before"`
+	// Remote and Local count the activities in the range on Strava and in the cache.
+	Remote int `json:"remote"`
+	Local  int `json:"local"`
+	// Updated counts summaries that were new or differed in any field.
+	Updated    int              `json:"updated"`
+	Changed    []ActivityChange `json:"changed,omitempty"`
+	Tombstoned []int64          `json:"tombstoned,omitempty"`
+	Purged     []int64          `json:"purged,omitempty"`
+	// Restored lists tombstoned activities that Strava lists again; their summaries are cached again.
+	Restored []int64 `json:"restored,omitempty"`
+}
+
+// ReconcileActivities compares the activities Strava lists between after and before with the
+// cache. Edited summaries are updated, and cached activities missing on Strava are tombstoned or
+// purged depending on the mode. Streams are not fetched; the next sync fills them in.
+func (a *activityService) ReconcileActivities(after, before time.Time, mode ReconcileMode) (*ReconcileResult, error) {
+	token, err := a.tokenRepo.Get()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := a.stravaClient.GetAllAthleteActivitiesBetween(int(after.Unix()), int(before.Unix()), token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	syncResult := &SyncResult{}
+	if _, err := a.saveSummaries(remote, syncResult); err != nil {
+		return nil, err
+	}
+	result := &ReconcileResult{
+		After:   after.UTC().Format(time.RFC3339),
+		Before:  before.UTC().Format(time.RFC3339),
+		Remote:  len(remote),
+		Updated: syncResult.Updated,
+		Changed: syncResult.Changed,
+	}
+	if err := a.reconcileMissing(remote, after, before, mode, result); err != nil {
+		return result, err
+	}
+	slog.Info("Reconciled activities", "after", result.After, "before", result.Before, "updated", result.Updated,
+		"tombstoned", len(result.Tombstoned), "purged", len(result.Purged), "restored", len(result.Restored))
+	return result, nil
+}
+
+// reconcileMissing tombstones or purges cached activities in the range that are not in the
+// remote list, and drops tombstones of activities that are listed again. Purging also removes
+// the tombstones in the range.
+func (a *activityService) reconcileMissing(remote []model.AthleteActivity, after, before time.Time, mode ReconcileMode, result *ReconcileResult) error {
+	remoteIDs := make(map[int64]bool, len(remote))
+	for _, activity := range remote {
+		remoteIDs[activity.ID] = true
+	}
+
+	cached, err := a.storage.GetAllAthleteActivities()
+	if err != nil {
+		return err
+	}
+	for _, activity := range cached {
+		start, err := time.Parse(time.RFC3339, activity.StartDate)
+		// Strava lists activities started strictly between after and before.
+		if err != nil || !start.After(after) || !start.Before(before) {
+			continue
+		}
+		result.Local++
+		if remoteIDs[activity.ID] {
+			continue
+		}
+		id := fmt.Sprintf("%d", activity.ID)
+		if mode == ReconcilePurge {
+			slog.Info("Purging activity missing on Strava", "id", id, "start_date", activity.StartDate)
+			if err := a.storage.DeleteActivity(id); err != nil {
+				return err
+			}
+			result.Purged = append(result.Purged, activity.ID)
+			continue
+		}
+		slog.Info("Tombstoning activity missing on Strava", "id", id, "start_date", activity.StartDate)
+		if err := a.storage.TombstoneActivity(&activity, missingReason); err != nil {
+			return err
+		}
+		result.Tombstoned = append(result.Tombstoned, activity.ID)
+	}
+
+	tombstones, err := a.storage.GetTombstones()
+	if err != nil {
+		return err
+	}
+	for _, tombstone := range tombstones {
+		id := fmt.Sprintf("%d", tombstone.Activity.ID)
+		if remoteIDs[tombstone.Activity.ID] {
+			if err := a.storage.RemoveTombstone(id); err != nil {
+				return err
+			}
+			result.Restored = append(result.Restored, tombstone.Activity.ID)
+			continue
+		}
+		// Purging also drops tombstones left in the range by earlier passes.
+		start, err := time.Parse(time.RFC3339, tombstone.Activity.StartDate)
+		if mode != ReconcilePurge || err != nil || !start.After(after) || !start.Before(before) {
+			continue
+		}
+		if err := a.storage.RemoveTombstone(id); err != nil {
+			return err
+		}
+		result.Purged = append(result.Purged, tombstone.Activity.ID)
+	}
+	return nil
+}
+
+// changedFields returns the tracked fields that differ between the cached and the remote summary.
+func changedFields(cached, remote *model.AthleteActivity) []string {
+	var fields []string
+	if cached.Name != remote.Name {
+		fields = append(fields, "name")
+	}
+	if cached.Type != remote.Type {
+		fields = append(fields, "type")
+	}
+	if cached.SportType != remote.SportType {
+		fields = append(fields, "sport_type")
+	}
+	if stringValue(cached.GearID) != stringValue(remote.GearID) {
+		fields = append(fields, "gear_id")
+	}
+	if cached.Visibility != remote.Visibility || cached.Private != remote.Private {
+		fields = append(fields, "visibility")
+	}
+	return fields
+}
+
+func stringValue(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"stravamcp/model"
+	"stravamcp/pkg/analytics"
+	"stravamcp/pkg/sport"
+	"stravamcp/repo"
+	"strconv"
+	"time"
+)
+
+// recordDefinition is a personal record: the fastest moving time in seconds over a running
+// distance, the best average power in watts held for a duration on the bike, or the distance in
+// meters of the longest ride.
+type recordDefinition struct {
+	Key     string
+	Name    string
+	Sport   string
+	Unit    string
+	meters  float64
+	seconds int
+}
+
+var recordDefinitions = []recordDefinition{
+	{Key: "run_1k", Name: "1 km", Sport: "running", Unit: "seconds", meters: 1000},
+	{Key: "run_5k", Name: "5 km", Sport: "running", Unit: "seconds", meters: 5000},
+	{Key: "run_10k", Name: "10 km", Sport: "running", Unit: "seconds", meters: 10000},
+	{Key: "run_half_marathon", Name: "Half marathon", Sport: "running", Unit: "seconds", meters: 21097.5},
+	{Key: "run_marathon", Name: "Marathon", Sport: "running", Unit: "seconds", meters: 42195},
+	{Key: "power_5s", Name: "5 s power", Sport: "cycling", Unit: "watts", seconds: 5},
+	{Key: "power_1min", Name: "1 min power", Sport: "cycling", Unit: "watts", seconds: 60},
+	{Key: "power_5min", Name: "5 min power", Sport: "cycling", Unit: "watts", seconds: 300},
+	{Key: "power_20min", Name: "20 min power", Sport: "cycling", Unit: "watts", seconds: 1200},
+	{Key: "longest_ride", Name: "Longest ride", Sport: "cycling", Unit: "meters"},
+}
+
+// better reports whether value beats the best so far; times are better when lower.
+func (d recordDefinition) better(value, best float64) bool {
+	if d.Unit == "seconds" {
+		return value < best
+	}
+	return value > best
+}
+
+// Record is the best value of a personal record and the activity it was set in.
+type Record struct {
+	Key          string  `json:"key"`
+	Name         string  `json:"name"`
+	Sport        string  `json:"sport"`
+	Unit         string  `json:"unit"`
+	Value        float64 `json:"value"`
+	ActivityID   int64   `json:"activity_id"`
+	ActivityName string  `json:"activity_name"`
+	Date         string  `json:"date"`
+}
+
+// NewRecord is a record set by an activity fetched in a sync. AllTime is set when it is the best
+// ever, otherwise it is the best of Year; Previous is the value it beat.
+type NewRecord struct {
+	Record
+	Year     string   `json:"year"`
+	AllTime  bool     `json:"all_time"`
+	Previous *float64 `json:"previous,omitempty"`
+}
+
+// PersonalRecords are the all-time bests and the bests of every year, in the order of the record
+// definitions. Activities counts the activities whose streams were scanned.
+type PersonalRecords struct {
+	AllTime    []Record            `json:"all_time"`
+	Years      map[string][]Record `json:"years"`
+	Activities int                 `json:"activities"`
+	UpdatedAt  string              `json:"updated_at"`
+}
+
+// GetPersonalRecords returns the personal records after scanning any cached stream they do not
+// include yet. A year other than zero limits the per-year bests to that year.
+func (a *activityService) GetPersonalRecords(_ context.Context, year int) (*PersonalRecords, error) {
+	records, err := a.personalRecords()
+	if err != nil {
+		return nil, err
+	}
+	result := &PersonalRecords{
+		AllTime:    recordList(records.AllTime),
+		Years:      map[string][]Record{},
+		Activities: len(records.Scanned),
+		UpdatedAt:  records.UpdatedAt,
+	}
+	for y, bests := range records.Years {
+		if year == 0 || y == strconv.Itoa(year) {
+			result.Years[y] = recordList(bests)
+		}
+	}
+	return result, nil
+}
+
+func recordList(bests map[string]repo.PersonalRecord) []Record {
+	list := []Record{}
+	for _, d := range recordDefinitions {
+		if best, ok := bests[d.Key]; ok {
+			list = append(list, newRecord(d, best))
+		}
+	}
+	return list
+}
+
+func newRecord(d recordDefinition, best repo.PersonalRecord) Record {
+	return Record{
+		Key:          d.Key,
+		Name:         d.Name,
+		Sport:        d.Sport,
+		Unit:         d.Unit,
+		Value:        best.Value,
+		ActivityID:   best.ActivityID,
+		ActivityName: best.Name,
+		Date:         best.Date,
+	}
+}
+
+func (a *activityService) personalRecords() (*repo.PersonalRecords, error) {
+	a.recordsMu.Lock()
+	defer a.recordsMu.Unlock()
+	return loadPersonalRecords(a.storage)
+}
+
+// recordEfforts adds a stream saved by a sync to the personal records and returns the records it
+// set. Until the records were first built from the cache nothing is reported.
+func (a *activityService) recordEfforts(activity *model.AthleteActivity, streams *model.ActivityStreams) ([]NewRecord, error) {
+	a.recordsMu.Lock()
+	defer a.recordsMu.Unlock()
+	records, err := a.storage.GetPersonalRecords()
+	if err != nil || records == nil || records.Scanned[activity.ID] {
+		return nil, err
+	}
+	set := applyEfforts(records, activity, streams)
+	records.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return set, a.storage.SavePersonalRecords(records)
+}
+
+// forgetEfforts marks the activity as not scanned, so that its replaced stream is scanned the next
+// time the records are read. Records it set are kept, as the new stream can only match or beat
+// them.
+func (a *activityService) forgetEfforts(id string) error {
+	a.recordsMu.Lock()
+	defer a.recordsMu.Unlock()
+	activityID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return err
+	}
+	records, err := a.storage.GetPersonalRecords()
+	if err != nil || records == nil || !records.Scanned[activityID] {
+		return err
+	}
+	delete(records.Scanned, activityID)
+	return a.storage.SavePersonalRecords(records)
+}
+
+// loadPersonalRecords returns the saved personal records after scanning the cached streams they
+// do not include yet, oldest first so that ties go to the earlier activity. They are rebuilt from
+// scratch when a record was set in an activity that is no longer cached.
+func loadPersonalRecords(storage repo.Storage) (*repo.PersonalRecords, error) {
+	records, err := storage.GetPersonalRecords()
+	if err != nil {
+		return nil, err
+	}
+	activities, err := storage.GetAllAthleteActivities()
+	if err != nil {
+		return nil, err
+	}
+	cached := map[int64]bool{}
+	for _, activity := range activities {
+		cached[activity.ID] = true
+	}
+	changed := false
+	if records == nil || !recordsCached(records, cached) {
+		records = &repo.PersonalRecords{
+			AllTime: map[string]repo.PersonalRecord{},
+			Years:   map[string]map[string]repo.PersonalRecord{},
+			Scanned: map[int64]bool{},
+		}
+		changed = true
+	}
+	for id := range records.Scanned {
+		if !cached[id] {
+			delete(records.Scanned, id)
+			changed = true
+		}
+	}
+
+	slices.SortFunc(activities, func(a, b model.AthleteActivity) int {
+		return cmp.Compare(a.StartDate, b.StartDate)
+	})
+	for i := range activities {
+		activity := &activities[i]
+		if records.Scanned[activity.ID] {
+			continue
+		}
+		streams, err := storage.GetActivityStream(fmt.Sprintf("%d", activity.ID))
+		if err != nil {
+			slog.Warn("Unable to read stream for personal records", "id", activity.ID, "error", err)
+			continue
+		}
+		if streams == nil {
+			continue
+		}
+		applyEfforts(records, activity, streams)
+		changed = true
+	}
+	if !changed {
+		return records, nil
+	}
+	records.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return records, storage.SavePersonalRecords(records)
+}
+
+// recordsCached reports whether every record was set in a cached activity.
+func recordsCached(records *repo.PersonalRecords, cached map[int64]bool) bool {
+	for _, best := range records.AllTime {
+		if !cached[best.ActivityID] {
+			return false
+		}
+	}
+	for _, bests := range records.Years {
+		for _, best := range bests {
+			if !cached[best.ActivityID] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// buildPersonalRecords scans the streams cached before personal records were kept.
+func buildPersonalRecords(storage repo.Storage) error {
+	_, err := loadPersonalRecords(storage)
+	return err
+}
+
+// applyEfforts marks the activity as scanned and records every effort in it that beats the best of
+// its year or of all time.
+func applyEfforts(records *repo.PersonalRecords, activity *model.AthleteActivity, streams *model.ActivityStreams) []NewRecord {
+	records.Scanned[activity.ID] = true
+	date := localDate(activity)
+	if date == "" {
+		return nil
+	}
+	year := date[:4]
+	measured := efforts(activity, streams)
+	var set []NewRecord
+	for _, d := range recordDefinitions {
+		value, ok := measured[d.Key]
+		if !ok {
+			continue
+		}
+		if records.Years[year] == nil {
+			records.Years[year] = map[string]repo.PersonalRecord{}
+		}
+		yearBest, hadYearBest := records.Years[year][d.Key]
+		if hadYearBest && !d.better(value, yearBest.Value) {
+			continue
+		}
+		best := repo.PersonalRecord{Value: value, ActivityID: activity.ID, Name: activity.Name, Date: date}
+		records.Years[year][d.Key] = best
+		record := NewRecord{Record: newRecord(d, best), Year: year}
+		if hadYearBest {
+			record.Previous = &yearBest.Value
+		}
+		allTimeBest, hadAllTimeBest := records.AllTime[d.Key]
+		if !hadAllTimeBest || d.better(value, allTimeBest.Value) {
+			records.AllTime[d.Key] = best
+			record.AllTime = true
+			if hadAllTimeBest {
+				record.Previous = &allTimeBest.Value
+			}
+		}
+		set = append(set, record)
+	}
+	return set
+}
+
+// efforts measures the records of an activity: run times from the distance stream, power from
+// the mean-maximal curve and the ride distance from the summary.
+func efforts(activity *model.AthleteActivity, streams *model.ActivityStreams) map[string]float64 {
+	measured := map[string]float64{}
+	running, _ := sport.Resolve("running")
+	cycling, _ := sport.Resolve("cycling")
+	switch {
+	case running.Contains(activity):
+		var distances []float64
+		for _, d := range recordDefinitions {
+			if d.meters > 0 {
+				distances = append(distances, d.meters)
+			}
+		}
+		times := analytics.FastestTimes(streams, distances)
+		for _, d := range recordDefinitions {
+			if i := slices.Index(distances, d.meters); d.meters > 0 && times[i] > 0 {
+				measured[d.Key] = times[i]
+			}
+		}
+	case cycling.Contains(activity):
+		if analytics.Has(streams.Watts) {
+			curve := analytics.MeanMaximal(analytics.PerSecond(streams.Time, streams.Watts))
+			for _, d := range recordDefinitions {
+				i := slices.IndexFunc(curve, func(p analytics.CurvePoint) bool { return p.Seconds == d.seconds })
+				if d.seconds > 0 && i >= 0 && curve[i].Watts > 0 {
+					measured[d.Key] = curve[i].Watts
+				}
+			}
+		}
+		if activity.Distance > 0 {
+			measured["longest_ride"] = math.Round(activity.Distance)
+		}
+	}
+	return measured
+}
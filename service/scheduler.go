@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SyncScheduler runs incremental syncs in the background on a fixed interval.
+type SyncScheduler interface {
+	// Run syncs immediately and then every interval until the context is cancelled. A sync in
+	// progress is finished before Run returns.
+	Run(ctx context.Context)
+	Status() SchedulerStatus
+}
+
+type SchedulerStatus struct {
+	Enabled        bool        `json:"enabled"`
+	Interval       string      `json:"interval"`
+	Running        bool        `json:"running"`
+	LastStartedAt  string      `json:"last_started_at,omitempty"`
+	LastFinishedAt string      `json:"last_finished_at,omitempty"`
+	LastResult     *SyncResult `json:"last_result,omitempty"`
+	LastError      string      `json:"last_error,omitempty"`
+	NextRunAt      string      `json:"next_run_at,omitempty"`
+}
+
+type syncScheduler struct {
+	activityService ActivityService
+	interval        time.Duration
+	mu              sync.Mutex
+	status          SchedulerStatus
+}
+
+// NewSyncScheduler returns a scheduler that syncs every interval. An interval of zero or less
+// disables it.
+func NewSyncScheduler(activityService ActivityService, interval time.Duration) SyncScheduler {
+	return &syncScheduler{
+		activityService: activityService,
+		interval:        interval,
+		status:          SchedulerStatus{Enabled: interval > 0, Interval: interval.String()},
+	}
+}
+
+func (s *syncScheduler) Run(ctx context.Context) {
+	if s.interval <= 0 {
+		return
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		s.runOnce()
+		next := time.Now().Add(s.interval)
+		s.mu.Lock()
+		s.status.NextRunAt = next.UTC().Format(time.RFC3339)
+		s.mu.Unlock()
+		timer.Reset(time.Until(next))
+	}
+}
+
+func (s *syncScheduler) runOnce() {
+	s.mu.Lock()
+	s.status.Running = true
+	s.status.LastStartedAt = time.Now().UTC().Format(time.RFC3339)
+	s.status.NextRunAt = ""
+	s.mu.Unlock()
+
+	result, err := s.activityService.SyncActivities()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Running = false
+	s.status.LastFinishedAt = time.Now().UTC().Format(time.RFC3339)
+	s.status.LastResult = result
+	s.status.LastError = ""
+	if err != nil {
+		slog.Error("Scheduled sync failed", "error", err)
+		s.status.LastError = err.Error()
+		return
+	}
+	slog.Info("Scheduled sync finished", "listed", result.Listed, "synced", result.Synced, "failed", len(result.Failed))
+}
+
+func (s *syncScheduler) Status() SchedulerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
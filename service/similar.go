@@ -0,0 +1,151 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"stravamcp/model"
+	"stravamcp/pkg/geo"
+	"stravamcp/pkg/sport"
+)
+
+var ErrNoRouteData = errors.New("activity has no map polyline to compare routes with")
+
+const (
+	// routeSamples is how many evenly spaced points routes are compared at.
+	routeSamples = 64
+	// routeEndpointDistance is how far apart, in meters, the starts and the ends of two efforts on
+	// the same route may be. Privacy zones trim summary polylines, so it is generous.
+	routeEndpointDistance = 500
+	// routeLengthTolerance is how much, as a fraction, the route lengths may differ.
+	routeLengthTolerance = 0.2
+	// routeMatchDistance is the largest Fréchet distance, in meters, between efforts on the same route.
+	routeMatchDistance = 200
+)
+
+// RouteEffort is one activity on a route. Deviation is the Fréchet distance of its route to the
+// compared activity's in meters, and TimeDifference its moving time minus the compared activity's.
+type RouteEffort struct {
+	ActivityID           int64    `json:"activity_id"`
+	Name                 string   `json:"name"`
+	Date                 string   `json:"date"`
+	Distance             float64  `json:"distance"`
+	MovingTime           int      `json:"moving_time"`
+	ElapsedTime          int      `json:"elapsed_time"`
+	ElevationGain        float64  `json:"elevation_gain"`
+	AverageSpeed         float64  `json:"average_speed"`
+	AverageWatts         *float64 `json:"average_watts,omitempty"`
+	WeightedAverageWatts *int     `json:"weighted_average_watts,omitempty"`
+	AverageHeartrate     *float64 `json:"average_heartrate,omitempty"`
+	Deviation            float64  `json:"deviation"`
+	TimeDifference       int      `json:"time_difference"`
+}
+
+func newRouteEffort(activity *model.AthleteActivity) RouteEffort {
+	return RouteEffort{
+		ActivityID:           activity.ID,
+		Name:                 activity.Name,
+		Date:                 localDate(activity),
+		Distance:             activity.Distance,
+		MovingTime:           activity.MovingTime,
+		ElapsedTime:          activity.ElapsedTime,
+		ElevationGain:        activity.TotalElevationGain,
+		AverageSpeed:         activity.AverageSpeed,
+		AverageWatts:         activity.AverageWatts,
+		WeightedAverageWatts: activity.WeightedAverageWatts,
+		AverageHeartrate:     activity.AverageHeartrate,
+	}
+}
+
+// SimilarActivities are the other efforts of the same sport type on the route of an activity,
+// newest first. Rank is the activity's place by moving time among all efforts, 1 being the
+// fastest, and Total the number of efforts including the activity.
+type SimilarActivities struct {
+	Activity  RouteEffort   `json:"activity"`
+	SportType string        `json:"sport_type"`
+	Rank      int           `json:"rank"`
+	Total     int           `json:"total"`
+	Efforts   []RouteEffort `json:"efforts"`
+}
+
+type route struct {
+	points [][]float64
+	length float64
+}
+
+func newRoute(activity *model.AthleteActivity) (route, bool) {
+	if activity.Map.SummaryPolyline == "" {
+		return route{}, false
+	}
+	points, err := geo.DecodePolyline(activity.Map.SummaryPolyline)
+	if err != nil || len(points) < 2 {
+		return route{}, false
+	}
+	return route{points: geo.Resample(points, routeSamples), length: geo.Length(points)}, true
+}
+
+// near reports whether two routes start and end close to each other and are about as long, which
+// is checked before comparing them point by point.
+func (r route) near(other route) bool {
+	first, last := r.points[0], r.points[len(r.points)-1]
+	otherFirst, otherLast := other.points[0], other.points[len(other.points)-1]
+	return geo.Haversine(first[0], first[1], otherFirst[0], otherFirst[1]) <= routeEndpointDistance &&
+		geo.Haversine(last[0], last[1], otherLast[0], otherLast[1]) <= routeEndpointDistance &&
+		math.Abs(r.length-other.length) <= routeLengthTolerance*r.length
+}
+
+// FindSimilarActivities finds the cached activities of the same sport type that follow the route of
+// an activity, from their summary polylines. Candidates have to start and end within 500 m and
+// be within 20% of the length; their routes are resampled to evenly spaced points and match when
+// the Fréchet distance is at most 200 m. A limit above zero caps the number of efforts returned.
+func (s *analyticsService) FindSimilarActivities(_ context.Context, id string, limit int) (*SimilarActivities, error) {
+	activity, err := s.storage.GetAthleteActivity(id)
+	if err != nil {
+		return nil, err
+	}
+	if activity == nil {
+		return nil, fmt.Errorf("%w: %s", ErrActivityNotCached, id)
+	}
+	target, ok := newRoute(activity)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoRouteData, id)
+	}
+	activities, err := s.storage.GetAllAthleteActivities()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SimilarActivities{Activity: newRouteEffort(activity), SportType: sport.Of(activity), Rank: 1, Efforts: []RouteEffort{}}
+	for i := range activities {
+		other := &activities[i]
+		if other.ID == activity.ID || sport.Of(other) != result.SportType {
+			continue
+		}
+		candidate, ok := newRoute(other)
+		if !ok || !target.near(candidate) {
+			continue
+		}
+		deviation := geo.Frechet(target.points, candidate.points)
+		if deviation > routeMatchDistance {
+			continue
+		}
+		effort := newRouteEffort(other)
+		effort.Deviation = math.Round(deviation)
+		effort.TimeDifference = other.MovingTime - activity.MovingTime
+		result.Efforts = append(result.Efforts, effort)
+		if other.MovingTime < activity.MovingTime {
+			result.Rank++
+		}
+	}
+	result.Total = len(result.Efforts) + 1
+	slices.SortFunc(result.Efforts, func(a, b RouteEffort) int {
+		return cmp.Compare(b.Date, a.Date)
+	})
+	if limit > 0 && len(result.Efforts) > limit {
+		result.Efforts = result.Efforts[:limit]
+	}
+	return result, nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"stravamcp/pkg/analytics"
+	"stravamcp/pkg/sport"
+)
+
+var ErrNoDistanceData = errors.New("activity has no distance stream to split")
+
+type ActivitySplits struct {
+	ActivityID int64  `json:"activity_id"`
+	Name       string `json:"name"`
+	SportType  string `json:"sport_type"`
+	Date       string `json:"date"`
+	analytics.SplitAnalysis
+}
+
+// GetSplits computes distance splits of an activity, fetching its stream like GetActivityStream
+// when it is not cached.
+func (a *activityService) GetSplits(_ context.Context, id string, unit analytics.SplitUnit) (*ActivitySplits, error) {
+	activity, streams, err := a.loadActivityAndStreams(id)
+	if err != nil {
+		return nil, err
+	}
+	splits, ok := analytics.ComputeSplits(streams, unit)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoDistanceData, id)
+	}
+	return &ActivitySplits{
+		ActivityID:    activity.ID,
+		Name:          activity.Name,
+		SportType:     sport.Of(activity),
+		Date:          localDate(activity),
+		SplitAnalysis: splits,
+	}, nil
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"stravamcp/model"
+	"stravamcp/pkg/sport"
+	"time"
+)
+
+// defaultSummaryPeriods is how many periods a summary covers when no range is given.
+var defaultSummaryPeriods = map[Grouping]int{GroupByWeek: 12, GroupByMonth: 12, GroupByYear: 5}
+
+// SummaryTotals add up activities. Distance and elevation gain are meters, moving time seconds;
+// the average heart rate is weighted by the moving time of the activities that recorded one.
+type SummaryTotals struct {
+	Activities       int      `json:"activities"`
+	Distance         float64  `json:"distance"`
+	MovingTime       int      `json:"moving_time"`
+	ElevationGain    float64  `json:"elevation_gain"`
+	Kilojoules       float64  `json:"kilojoules"`
+	AverageHeartrate *float64 `json:"average_heartrate,omitempty"`
+
+	heartbeats, heartrateSeconds float64
+}
+
+func (t *SummaryTotals) add(activity *model.AthleteActivity) {
+	t.Activities++
+	t.Distance += activity.Distance
+	t.MovingTime += activity.MovingTime
+	t.ElevationGain += activity.TotalElevationGain
+	if activity.Kilojoules != nil {
+		t.Kilojoules += *activity.Kilojoules
+	}
+	if activity.AverageHeartrate != nil && *activity.AverageHeartrate > 0 && activity.MovingTime > 0 {
+		t.heartbeats += *activity.AverageHeartrate * float64(activity.MovingTime)
+		t.heartrateSeconds += float64(activity.MovingTime)
+	}
+}
+
+func (t *SummaryTotals) finish() {
+	t.Distance = math.Round(t.Distance)
+	t.ElevationGain = math.Round(t.ElevationGain)
+	t.Kilojoules = math.Round(t.Kilojoules)
+	if t.heartrateSeconds > 0 {
+		hr := math.Round(t.heartbeats / t.heartrateSeconds)
+		t.AverageHeartrate = &hr
+	}
+}
+
+// SummaryChange is the difference to the previous period. The percentages are nil when the
+// previous period had no distance or moving time.
+type SummaryChange struct {
+	Activities        int      `json:"activities"`
+	Distance          float64  `json:"distance"`
+	DistancePercent   *float64 `json:"distance_percent,omitempty"`
+	MovingTime        int      `json:"moving_time"`
+	MovingTimePercent *float64 `json:"moving_time_percent,omitempty"`
+	ElevationGain     float64  `json:"elevation_gain"`
+	Kilojoules        float64  `json:"kilojoules"`
+	AverageHeartrate  *float64 `json:"average_heartrate,omitempty"`
+}
+
+func newSummaryChange(current, previous SummaryTotals) SummaryChange {
+	change := SummaryChange{
+		Activities:        current.Activities - previous.Activities,
+		Distance:          current.Distance - previous.Distance,
+		DistancePercent:   percentChange(current.Distance, previous.Distance),
+		MovingTime:        current.MovingTime - previous.MovingTime,
+		MovingTimePercent: percentChange(float64(current.MovingTime), float64(previous.MovingTime)),
+		ElevationGain:     current.ElevationGain - previous.ElevationGain,
+		Kilojoules:        current.Kilojoules - previous.Kilojoules,
+	}
+	if current.AverageHeartrate != nil && previous.AverageHeartrate != nil {
+		hr := *current.AverageHeartrate - *previous.AverageHeartrate
+		change.AverageHeartrate = &hr
+	}
+	return change
+}
+
+func percentChange(current, previous float64) *float64 {
+	if previous <= 0 {
+		return nil
+	}
+	percent := math.Round((current-previous)/previous*1000) / 10
+	return &percent
+}
+
+// SportSummary is the part of a period spent on one sport type.
+type SportSummary struct {
+	SportType string `json:"sport_type"`
+	SummaryTotals
+	Change SummaryChange `json:"change"`
+}
+
+// SummaryPeriod is a week, month or year from Start to End, both inclusive local dates, with its
+// sports ordered by moving time.
+type SummaryPeriod struct {
+	Period string `json:"period"`
+	Start  string `json:"start"`
+	End    string `json:"end"`
+	SummaryTotals
+	Change SummaryChange  `json:"change"`
+	Sports []SportSummary `json:"sports"`
+}
+
+type Summary struct {
+	After   string          `json:"after"`
+	Before  string          `json:"before"`
+	Sport   string          `json:"sport,omitempty"`
+	GroupBy Grouping        `json:"group_by"`
+	Total   SummaryTotals   `json:"total"`
+	Periods []SummaryPeriod `json:"periods"`
+}
+
+type summaryBucket struct {
+	totals SummaryTotals
+	sports map[string]*SummaryTotals
+}
+
+// GetSummary totals the cached activities per week, month or year and per sport type, by the
+// local date they started on. Every period, including empty ones, is compared with the period
+// before it. The range covers the periods containing after and before, by default the last 12
+// weeks or months or 5 years up to now; filter is a sport name understood by sport.Resolve.
+func (s *analyticsService) GetSummary(_ context.Context, filter string, after *time.Time, before *time.Time, groupBy Grouping) (*Summary, error) {
+	if after != nil && before != nil && before.Before(*after) {
+		return nil, fmt.Errorf("%w: 'before' date must be after 'after' date", ErrInvalidRange)
+	}
+	to := time.Now()
+	if before != nil {
+		to = *before
+	}
+	last := groupBy.periodStart(to)
+	first := groupBy.shift(last, 1-defaultSummaryPeriods[groupBy])
+	if after != nil {
+		first = groupBy.periodStart(*after)
+	}
+	var sports sport.Set
+	if filter != "" {
+		var err error
+		sports, err = sport.Resolve(filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if first.After(last) {
+		return &Summary{
+			After:   first.Format("2006-01-02"),
+			Before:  groupBy.shift(last, 1).AddDate(0, 0, -1).Format("2006-01-02"),
+			Sport:   filter,
+			GroupBy: groupBy,
+			Periods: []SummaryPeriod{},
+		}, nil
+	}
+
+	// The period before the range is only totalled for the change of the first period.
+	var starts []time.Time
+	for start := groupBy.shift(first, -1); !start.After(last); start = groupBy.shift(start, 1) {
+		starts = append(starts, start)
+	}
+	buckets := make([]summaryBucket, len(starts))
+	for i := range buckets {
+		buckets[i].sports = map[string]*SummaryTotals{}
+	}
+	end := groupBy.shift(last, 1)
+
+	activities, err := s.cachedActivities()
+	if err != nil {
+		return nil, err
+	}
+	result := &Summary{
+		After:   first.Format("2006-01-02"),
+		Before:  end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Sport:   filter,
+		GroupBy: groupBy,
+		Periods: []SummaryPeriod{},
+	}
+	for _, activity := range activities {
+		if sports != nil && !sports.Contains(&activity) {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", localDate(&activity))
+		if err != nil || day.Before(starts[0]) || !day.Before(end) {
+			continue
+		}
+		i, _ := slices.BinarySearchFunc(starts, day, func(start, day time.Time) int {
+			return start.Compare(day)
+		})
+		if i == len(starts) || starts[i].After(day) {
+			i--
+		}
+		bucket := &buckets[i]
+		bucket.totals.add(&activity)
+		sportType := sport.Of(&activity)
+		if bucket.sports[sportType] == nil {
+			bucket.sports[sportType] = &SummaryTotals{}
+		}
+		bucket.sports[sportType].add(&activity)
+		if i > 0 {
+			result.Total.add(&activity)
+		}
+	}
+
+	for i := range buckets {
+		buckets[i].totals.finish()
+		for _, totals := range buckets[i].sports {
+			totals.finish()
+		}
+	}
+	result.Total.finish()
+	for i := 1; i < len(starts); i++ {
+		bucket, previous := buckets[i], buckets[i-1]
+		period := SummaryPeriod{
+			Period:        groupBy.period(starts[i].Format("2006-01-02")),
+			Start:         starts[i].Format("2006-01-02"),
+			End:           groupBy.shift(starts[i], 1).AddDate(0, 0, -1).Format("2006-01-02"),
+			SummaryTotals: bucket.totals,
+			Change:        newSummaryChange(bucket.totals, previous.totals),
+			Sports:        []SportSummary{},
+		}
+		for sportType, totals := range bucket.sports {
+			var before SummaryTotals
+			if totals := previous.sports[sportType]; totals != nil {
+				before = *totals
+			}
+			period.Sports = append(period.Sports, SportSummary{SportType: sportType, SummaryTotals: *totals, Change: newSummaryChange(*totals, before)})
+		}
+		slices.SortFunc(period.Sports, func(a, b SportSummary) int {
+			return cmp.Or(cmp.Compare(b.MovingTime, a.MovingTime), cmp.Compare(a.SportType, b.SportType))
+		})
+		result.Periods = append(result.Periods, period)
+	}
+	return result, nil
+}
@@ -0,0 +1,457 @@
+package service
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"stravamcp/config"
+	"stravamcp/model"
+	"stravamcp/pkg/client"
+	"stravamcp/repo"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errBudgetExhausted = errors.New("skipped: rate limit budget exhausted")
+
+// SyncConfig controls how far back incremental syncs and reconciliation passes look and how
+// streams are fetched.
+type SyncConfig struct {
+	InitialWindow     time.Duration
+	Overlap           time.Duration
+	ReconcileInterval time.Duration
+	ReconcileWindow   time.Duration
+	// Concurrency is the number of streams fetched in parallel.
+	Concurrency int
+	// RateLimitReserve is the number of requests per rate-limit window left for interactive use.
+	RateLimitReserve int
+	// ReconcileMode is applied to activities the periodic reconciliation finds missing on Strava.
+	ReconcileMode ReconcileMode
+}
+
+// NewSyncConfig reads the sync settings and rejects an unknown reconcile mode, which would
+// otherwise only surface at the first reconciliation.
+func NewSyncConfig(cfg *config.Config) (SyncConfig, error) {
+	mode, err := ParseReconcileMode(cfg.SyncReconcileMode)
+	if err != nil {
+		return SyncConfig{}, err
+	}
+	return SyncConfig{
+		InitialWindow:     cfg.SyncInitialWindow,
+		Overlap:           cfg.SyncOverlap,
+		ReconcileInterval: cfg.SyncReconcileInterval,
+		ReconcileWindow:   cfg.SyncReconcileWindow,
+		Concurrency:       cfg.SyncConcurrency,
+		RateLimitReserve:  cfg.SyncRateLimitReserve,
+		ReconcileMode:     mode,
+	}, nil
+}
+
+// SyncResult summarises one sync run.
+type SyncResult struct {
+	After string `json:"after"`
+	// Listed is the number of activities Strava returned for the window.
+	Listed int `json:"listed"`
+	// Updated counts activity summaries that were new or changed on Strava.
+	Updated int `json:"updated"`
+	// Synced counts streams fetched, Skipped activities whose stream was already cached.
+	Synced  int `json:"synced"`
+	Skipped int `json:"skipped"`
+	// Refetched counts cached legacy streams replaced by a complete one.
+	Refetched int `json:"refetched,omitempty"`
+	// Changed lists cached activities whose name, type, gear or visibility was edited on Strava.
+	Changed     []ActivityChange `json:"changed,omitempty"`
+	Deleted     int              `json:"deleted,omitempty"`
+	Reconciled  bool             `json:"reconciled,omitempty"`
+	RateLimited bool             `json:"rate_limited,omitempty"`
+	Failed      []SyncFailure    `json:"failed,omitempty"`
+	// NewRecords lists the personal records set by the fetched streams, oldest first.
+	NewRecords []NewRecord `json:"new_records,omitempty"`
+}
+
+type SyncFailure struct {
+	ActivityID int64  `json:"activity_id"`
+	StartDate  string `json:"start_date"`
+	Error      string `json:"error"`
+}
+
+func (r *SyncResult) fail(activity model.AthleteActivity, err error) {
+	r.Failed = append(r.Failed, SyncFailure{ActivityID: activity.ID, StartDate: activity.StartDate, Error: err.Error()})
+}
+
+// syncCall is a sync in progress that concurrent callers wait for instead of starting another.
+type syncCall struct {
+	done   chan struct{}
+	result *SyncResult
+	err    error
+}
+
+// SyncActivities fetches the activities started since the high-water mark in the sync state.
+// Once per ReconcileInterval it instead lists the whole ReconcileWindow, which picks up activities
+// edited on Strava and tombstones or purges cached activities that are no longer listed there.
+// Calls made while a sync is running share its result.
+func (a *activityService) SyncActivities() (*SyncResult, error) {
+	a.syncMu.Lock()
+	if call := a.syncCall; call != nil {
+		a.syncMu.Unlock()
+		<-call.done
+		return call.result, call.err
+	}
+	call := &syncCall{done: make(chan struct{})}
+	a.syncCall = call
+	a.syncMu.Unlock()
+
+	call.result, call.err = a.syncActivities()
+
+	a.syncMu.Lock()
+	a.syncCall = nil
+	a.syncMu.Unlock()
+	close(call.done)
+	return call.result, call.err
+}
+
+func (a *activityService) syncActivities() (*SyncResult, error) {
+	state, err := a.storage.GetSyncState()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		state = &repo.SyncState{}
+	}
+
+	now := time.Now()
+	after := now.Add(-a.syncConfig.InitialWindow)
+	if hwm, err := time.Parse(time.RFC3339, state.LastActivityStart); err == nil {
+		after = hwm.Add(-a.syncConfig.Overlap)
+	}
+
+	reconcile := a.reconcileDue(state, now)
+	reconcileAfter := now.Add(-a.syncConfig.ReconcileWindow)
+	if reconcile && reconcileAfter.Before(after) {
+		after = reconcileAfter
+	}
+
+	slog.Info("Syncing activities", "after", after.Format(time.RFC3339), "reconcile", reconcile)
+	result, remote, err := a.processActivities(after)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.refetchLegacyStreams(result); err != nil {
+		slog.Warn("Failed to re-fetch legacy streams", "error", err)
+	}
+	initial := state.LastActivityStart == ""
+	if !reconcile && !initial {
+		return result, nil
+	}
+	a.refreshAthleteZones()
+
+	if reconcile {
+		missing := &ReconcileResult{}
+		if err := a.reconcileMissing(remote, reconcileAfter, now, a.syncConfig.ReconcileMode, missing); err != nil {
+			return result, err
+		}
+		result.Deleted = len(missing.Tombstoned) + len(missing.Purged)
+		result.Reconciled = true
+	}
+
+	// processActivities saved the state, so reload it before recording the scan. The first
+	// sync listed the whole initial window, which counts as a scan as well.
+	state, err = a.storage.GetSyncState()
+	if err != nil {
+		return result, err
+	}
+	if state == nil {
+		state = &repo.SyncState{}
+	}
+	state.LastFullScanAt = now.UTC().Format(time.RFC3339)
+	return result, a.storage.SaveSyncState(state)
+}
+
+// processActivities caches every activity that started after the given time together with its
+// stream, updates cached summaries that were edited on Strava and advances the sync high-water
+// mark. Listing and storage errors abort the sync; a stream that cannot be fetched is recorded
+// in the result and retried by the next sync. It also returns the activities listed by Strava.
+func (a *activityService) processActivities(after time.Time) (*SyncResult, []model.AthleteActivity, error) {
+	token, err := a.tokenRepo.Get()
+	if err != nil {
+		return nil, nil, err
+	}
+	activities, err := a.stravaClient.GetAllAthleteActivities(int(after.Unix()), token.AccessToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &SyncResult{After: after.UTC().Format(time.RFC3339), Listed: len(activities)}
+	latest := ""
+	for _, activity := range activities {
+		if activity.StartDate > latest {
+			latest = activity.StartDate
+		}
+	}
+	pending, err := a.saveSummaries(activities, result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Scan the cache first so that only streams fetched now are reported as new records.
+	if _, err := a.personalRecords(); err != nil {
+		slog.Warn("Failed to update personal records", "error", err)
+	}
+	a.fetchStreams(token.AccessToken, pending, result)
+
+	// Keep the high-water mark below the oldest failure so the next sync lists it again.
+	for _, failure := range result.Failed {
+		if start, err := time.Parse(time.RFC3339, failure.StartDate); err == nil {
+			if before := start.Add(-time.Second).UTC().Format(time.RFC3339); before < latest {
+				latest = before
+			}
+		}
+	}
+	return result, activities, a.advanceHighWaterMark(latest)
+}
+
+// saveSummaries caches new and edited activity summaries and returns the activities whose stream
+// is not cached yet.
+func (a *activityService) saveSummaries(activities []model.AthleteActivity, result *SyncResult) ([]model.AthleteActivity, error) {
+	var pending []model.AthleteActivity
+	for _, athleteActivity := range activities {
+		id := fmt.Sprintf("%d", athleteActivity.ID)
+		activity, err := a.storage.GetAthleteActivity(id)
+		if err != nil {
+			return nil, err
+		}
+		if activity == nil || !reflect.DeepEqual(*activity, athleteActivity) {
+			err = a.storage.SaveAthleteActivity(&athleteActivity)
+			if err != nil {
+				return nil, err
+			}
+			result.Updated++
+			if activity != nil {
+				if fields := changedFields(activity, &athleteActivity); len(fields) > 0 {
+					result.Changed = append(result.Changed, ActivityChange{ActivityID: athleteActivity.ID, Name: athleteActivity.Name, Fields: fields})
+				}
+			}
+		}
+		activityStream, err := a.storage.GetActivityStream(id)
+		if err != nil {
+			return nil, err
+		}
+		if activityStream != nil {
+			result.Skipped++
+			continue
+		}
+		pending = append(pending, athleteActivity)
+	}
+	return pending, nil
+}
+
+// fetchStreams downloads and caches the streams of the given activities with a pool of
+// SyncConfig.Concurrency workers, then adds them to the personal records. Dispatch stops once
+// Strava reports that the rate-limit budget is down to the reserve or answers with 429; the
+// remaining activities are reported as failed.
+func (a *activityService) fetchStreams(accessToken string, activities []model.AthleteActivity, result *SyncResult) {
+	workers := max(a.syncConfig.Concurrency, 1)
+	jobs := make(chan model.AthleteActivity)
+	var fetched []model.AthleteActivity
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for activity := range jobs {
+				err := a.fetchStream(accessToken, activity)
+				mu.Lock()
+				if err != nil {
+					slog.Warn("Failed to fetch stream", "id", activity.ID, "error", err)
+					result.fail(activity, err)
+					result.RateLimited = result.RateLimited || errors.Is(err, client.ErrRateLimited)
+				} else {
+					result.Synced++
+					fetched = append(fetched, activity)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i, activity := range activities {
+		mu.Lock()
+		stop := result.RateLimited || !a.hasRateLimitBudget(workers)
+		if stop {
+			result.RateLimited = true
+			for _, skipped := range activities[i:] {
+				result.fail(skipped, errBudgetExhausted)
+			}
+		}
+		mu.Unlock()
+		if stop {
+			slog.Warn("Rate limit budget exhausted, deferring streams to the next sync", "remaining", len(activities)-i)
+			break
+		}
+		jobs <- activity
+	}
+	close(jobs)
+	wg.Wait()
+
+	slices.SortFunc(result.Failed, func(a, b SyncFailure) int {
+		return cmp.Compare(a.StartDate, b.StartDate)
+	})
+	a.recordFetchedEfforts(fetched, result)
+}
+
+// fetchStream downloads and caches the stream of an activity.
+func (a *activityService) fetchStream(accessToken string, activity model.AthleteActivity) error {
+	id := fmt.Sprintf("%d", activity.ID)
+	slog.Info("Getting stream for activity", "id", id, "start_date", activity.StartDate)
+	stream, err := a.stravaClient.FetchStreams(id, getActivityKeys(), accessToken)
+	if err != nil {
+		return err
+	}
+	return saveStream(a.storage, id, stream)
+}
+
+// recordFetchedEfforts adds the fetched streams to the personal records oldest first, whatever
+// order the workers finished in, so that every new record is reported against the one it beat.
+// Failing to update the records does not fail the streams.
+func (a *activityService) recordFetchedEfforts(activities []model.AthleteActivity, result *SyncResult) {
+	slices.SortFunc(activities, func(a, b model.AthleteActivity) int {
+		return cmp.Compare(a.StartDate, b.StartDate)
+	})
+	for i := range activities {
+		activity := &activities[i]
+		id := fmt.Sprintf("%d", activity.ID)
+		stream, err := a.storage.GetActivityStream(id)
+		if err == nil && stream != nil {
+			var records []NewRecord
+			records, err = a.recordEfforts(activity, stream)
+			result.NewRecords = append(result.NewRecords, records...)
+		}
+		if err != nil {
+			slog.Warn("Failed to update personal records", "id", id, "error", err)
+		}
+	}
+}
+
+// refetchLegacyStreams replaces the legacy streams queued by the schema version 2 migration, one
+// at a time while the rate-limit budget lasts; the rest wait for the next sync. A stream that
+// cannot be fetched keeps its legacy copy, is reported as failed and leaves the queue, so that an
+// activity deleted on Strava cannot hold it up.
+func (a *activityService) refetchLegacyStreams(result *SyncResult) error {
+	state, err := a.storage.GetSyncState()
+	if err != nil || state == nil || len(state.LegacyStreams) == 0 {
+		return err
+	}
+	token, err := a.tokenRepo.Get()
+	if err != nil {
+		return err
+	}
+	done := 0
+	for _, id := range state.LegacyStreams {
+		if result.RateLimited || !a.hasRateLimitBudget(1) {
+			result.RateLimited = true
+			break
+		}
+		err := a.refetchLegacyStream(token.AccessToken, id)
+		if errors.Is(err, client.ErrRateLimited) {
+			result.RateLimited = true
+			break
+		}
+		done++
+		if err != nil {
+			slog.Warn("Failed to re-fetch legacy stream", "id", id, "error", err)
+			activity, _ := a.storage.GetAthleteActivity(id)
+			if activity == nil {
+				activity = &model.AthleteActivity{}
+				activity.ID, _ = strconv.ParseInt(id, 10, 64)
+			}
+			result.fail(*activity, err)
+			continue
+		}
+		result.Refetched++
+	}
+	if done < len(state.LegacyStreams) {
+		slog.Info("Legacy streams left to re-fetch", "remaining", len(state.LegacyStreams)-done)
+	}
+	state.LegacyStreams = state.LegacyStreams[done:]
+	return a.storage.SaveSyncState(state)
+}
+
+// refetchLegacyStream replaces a cached stream and has the personal records scan it again, since
+// the legacy stream had no distance for the running records.
+func (a *activityService) refetchLegacyStream(accessToken string, id string) error {
+	slog.Info("Re-fetching legacy stream", "id", id)
+	stream, err := a.stravaClient.FetchStreams(id, getActivityKeys(), accessToken)
+	if err != nil {
+		return err
+	}
+	if err := saveStream(a.storage, id, stream); err != nil {
+		return err
+	}
+	if err := a.forgetEfforts(id); err != nil {
+		slog.Warn("Failed to update personal records", "id", id, "error", err)
+	}
+	return nil
+}
+
+// hasRateLimitBudget reports whether another request fits in both rate-limit windows while
+// keeping the reserve, counting requests that may still be in flight. Before Strava has reported
+// any usage the budget is assumed to be available.
+func (a *activityService) hasRateLimitBudget(inFlight int) bool {
+	limit := a.stravaClient.RateLimit()
+	if !limit.Known() {
+		return true
+	}
+	return limit.Remaining(time.Now()) > a.syncConfig.RateLimitReserve+inFlight
+}
+
+func (a *activityService) reconcileDue(state *repo.SyncState, now time.Time) bool {
+	if state.LastActivityStart == "" {
+		// The first sync lists the initial window anyway.
+		return false
+	}
+	last, err := time.Parse(time.RFC3339, state.LastFullScanAt)
+	return err != nil || now.Sub(last) >= a.syncConfig.ReconcileInterval
+}
+
+// refreshAthleteZones caches the athlete's heart rate and power zones for the analytics tools. It
+// runs with the daily reconciliation. Tokens without the profile:read_all scope cannot read the
+// zones, which only leaves the analytics on their fallback, so errors are logged.
+func (a *activityService) refreshAthleteZones() {
+	token, err := a.tokenRepo.Get()
+	if err != nil {
+		slog.Warn("Unable to fetch athlete zones", "error", err)
+		return
+	}
+	zones, err := a.stravaClient.GetAthleteZones(token.AccessToken)
+	if err != nil {
+		slog.Warn("Unable to fetch athlete zones", "error", err)
+		return
+	}
+	cached := &repo.CachedZones{Zones: *zones, FetchedAt: time.Now().UTC().Format(time.RFC3339)}
+	if err := a.storage.SaveAthleteZones(cached); err != nil {
+		slog.Warn("Unable to save athlete zones", "error", err)
+	}
+}
+
+// advanceHighWaterMark records a successful sync and moves the high-water mark forward to the
+// given start date if it is newer.
+func (a *activityService) advanceHighWaterMark(latest string) error {
+	state, err := a.storage.GetSyncState()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &repo.SyncState{}
+	}
+	if latest > state.LastActivityStart {
+		state.LastActivityStart = latest
+	}
+	state.LastSyncAt = time.Now().UTC().Format(time.RFC3339)
+	return a.storage.SaveSyncState(state)
+}
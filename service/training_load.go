@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"stravamcp/pkg/analytics"
+	"stravamcp/pkg/sport"
+	"time"
+)
+
+// ErrInvalidRange is returned when a given 'before' is earlier than the given 'after'. A range
+// that only ends up empty because 'after' lies past the default end of today is not an error:
+// the analyses return an empty result for it instead.
+var ErrInvalidRange = errors.New("invalid date range")
+
+type TrainingLoad struct {
+	From       string              `json:"from"`
+	To         string              `json:"to"`
+	Thresholds AthleteThresholds   `json:"thresholds"`
+	Current    *CurrentLoad        `json:"current,omitempty"`
+	Days       []analytics.DayLoad `json:"days"`
+	Activities []ActivityLoad      `json:"activities"`
+}
+
+// CurrentLoad is the load on the last day of the range.
+type CurrentLoad struct {
+	Date string  `json:"date"`
+	CTL  float64 `json:"ctl"`
+	ATL  float64 `json:"atl"`
+	TSB  float64 `json:"tsb"`
+	Form string  `json:"form"`
+	// RampRate is the change in CTL over the last 7 days.
+	RampRate float64 `json:"ramp_rate"`
+}
+
+type ActivityLoad struct {
+	ActivityID int64  `json:"activity_id"`
+	Name       string `json:"name"`
+	SportType  string `json:"sport_type"`
+	Date       string `json:"date"`
+	analytics.ActivityLoad
+}
+
+const defaultLoadRange = 90 * 24 * time.Hour
+
+// GetTrainingLoad scores every cached activity and returns the daily fitness, fatigue and form
+// between after and before, 90 days up to today by default. The series starts at the first
+// cached activity, so fitness within the range reflects the whole history.
+func (s *analyticsService) GetTrainingLoad(_ context.Context, after *time.Time, before *time.Time) (*TrainingLoad, error) {
+	to := time.Now()
+	if before != nil {
+		to = *before
+	}
+	from := to.Add(-defaultLoadRange)
+	if after != nil {
+		from = *after
+	}
+	if after != nil && before != nil && before.Before(*after) {
+		return nil, fmt.Errorf("%w: 'before' date must be after 'after' date", ErrInvalidRange)
+	}
+	fromDate, toDate := from.Format("2006-01-02"), to.Format("2006-01-02")
+
+	activities, err := s.cachedActivities()
+	if err != nil {
+		return nil, err
+	}
+	thresholds := s.thresholds(activities)
+	result := &TrainingLoad{From: fromDate, To: toDate, Thresholds: thresholds, Days: []analytics.DayLoad{}, Activities: []ActivityLoad{}}
+	if to.Before(from) {
+		return result, nil
+	}
+
+	daily := map[string]float64{}
+	start := from
+	for _, activity := range activities {
+		date := localDate(&activity)
+		if date == "" || date > toDate {
+			continue
+		}
+		streams, err := s.storage.GetActivityStream(fmt.Sprintf("%d", activity.ID))
+		if err != nil {
+			return nil, err
+		}
+		load := analytics.ScoreActivity(&activity, streams, thresholds.Thresholds)
+		daily[date] += load.TSS
+		if day, err := time.Parse("2006-01-02", date); err == nil && day.Before(start) {
+			start = day
+		}
+		if date >= fromDate {
+			result.Activities = append(result.Activities, ActivityLoad{
+				ActivityID:   activity.ID,
+				Name:         activity.Name,
+				SportType:    sport.Of(&activity),
+				Date:         date,
+				ActivityLoad: load,
+			})
+		}
+	}
+
+	series := analytics.LoadSeries(daily, truncateDay(start), truncateDay(to))
+	for _, day := range series {
+		if day.Date >= fromDate {
+			result.Days = append(result.Days, day)
+		}
+	}
+	if n := len(series); n > 0 {
+		last := series[n-1]
+		result.Current = &CurrentLoad{Date: last.Date, CTL: last.CTL, ATL: last.ATL, TSB: last.TSB, Form: analytics.FormStatus(last.TSB)}
+		if n > 7 {
+			result.Current.RampRate = math.Round((last.CTL-series[n-8].CTL)*10) / 10
+		}
+	}
+	return result, nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
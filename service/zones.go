@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"stravamcp/model"
+	"stravamcp/pkg/analytics"
+	"stravamcp/pkg/sport"
+	"time"
+)
+
+// HeartRateZones are the zones used for a distribution and where they came from: "strava" (the
+// athlete's Strava zones), "lthr" or "max_hr" (configured thresholds) or "estimated_max_hr"
+// (the highest heart rate in the cache).
+type HeartRateZones struct {
+	Source string           `json:"source"`
+	Zones  []analytics.Zone `json:"zones"`
+}
+
+// heartRateZones picks the best available zones.
+func (s *analyticsService) heartRateZones(activities []model.AthleteActivity) (*HeartRateZones, error) {
+	cached, err := s.storage.GetAthleteZones()
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && cached.Zones.HeartRate != nil && len(cached.Zones.HeartRate.Zones) > 0 {
+		return &HeartRateZones{Source: "strava", Zones: analytics.ZonesFromStrava(cached.Zones.HeartRate)}, nil
+	}
+	if s.athlete.LTHR > 0 {
+		return &HeartRateZones{Source: "lthr", Zones: analytics.ZonesFromLTHR(s.athlete.LTHR)}, nil
+	}
+	if s.athlete.MaxHR > 0 {
+		return &HeartRateZones{Source: "max_hr", Zones: analytics.ZonesFromMaxHR(s.athlete.MaxHR)}, nil
+	}
+	if t := s.thresholds(activities); t.MaxHR > 0 {
+		return &HeartRateZones{Source: "estimated_max_hr", Zones: analytics.ZonesFromMaxHR(t.MaxHR)}, nil
+	}
+	return nil, ErrNoHeartRateData
+}
+
+// Grouping is the calendar period activities are aggregated by: ISO weeks starting on Monday,
+// months or years of the local start date.
+type Grouping string
+
+const (
+	GroupByWeek  Grouping = "week"
+	GroupByMonth Grouping = "month"
+	GroupByYear  Grouping = "year"
+)
+
+func ParseGrouping(value string) (Grouping, error) {
+	switch Grouping(value) {
+	case "", GroupByWeek:
+		return GroupByWeek, nil
+	case GroupByMonth:
+		return GroupByMonth, nil
+	case GroupByYear:
+		return GroupByYear, nil
+	default:
+		return "", fmt.Errorf("unsupported grouping %q (use week, month or year)", value)
+	}
+}
+
+func (g Grouping) period(date string) string {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return ""
+	}
+	switch g {
+	case GroupByMonth:
+		return day.Format("2006-01")
+	case GroupByYear:
+		return day.Format("2006")
+	}
+	year, week := day.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// periodStart is the first day of the period containing day.
+func (g Grouping) periodStart(day time.Time) time.Time {
+	switch g {
+	case GroupByMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case GroupByYear:
+		return time.Date(day.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// shift moves the start of a period by n periods.
+func (g Grouping) shift(start time.Time, n int) time.Time {
+	switch g {
+	case GroupByMonth:
+		return start.AddDate(0, n, 0)
+	case GroupByYear:
+		return start.AddDate(n, 0, 0)
+	}
+	return start.AddDate(0, 0, 7*n)
+}
+
+// TimeInZones is the time spent in each zone, in the order of the zones.
+type TimeInZones struct {
+	Seconds      []float64                       `json:"seconds"`
+	Percent      []float64                       `json:"percent"`
+	Distribution analytics.IntensityDistribution `json:"distribution"`
+}
+
+func newTimeInZones(seconds []float64) TimeInZones {
+	var total float64
+	for _, s := range seconds {
+		total += s
+	}
+	percent := make([]float64, len(seconds))
+	for i, s := range seconds {
+		if total > 0 {
+			percent[i] = math.Round(s/total*1000) / 10
+		}
+	}
+	return TimeInZones{Seconds: seconds, Percent: percent, Distribution: analytics.Distribute(seconds)}
+}
+
+type ActivityZones struct {
+	ActivityID int64          `json:"activity_id"`
+	Name       string         `json:"name"`
+	SportType  string         `json:"sport_type"`
+	Date       string         `json:"date"`
+	Zones      HeartRateZones `json:"zones"`
+	TimeInZones
+}
+
+// GetActivityZones returns the time in heart rate zones of a cached activity.
+func (s *analyticsService) GetActivityZones(_ context.Context, id string) (*ActivityZones, error) {
+	activity, streams, err := s.cachedActivity(id)
+	if err != nil {
+		return nil, err
+	}
+	hr := analytics.PerSecond(streams.Time, streams.Heartrate)
+	if len(hr) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoHeartRateData, id)
+	}
+	activities, err := s.storage.GetAllAthleteActivities()
+	if err != nil {
+		return nil, err
+	}
+	zones, err := s.heartRateZones(activities)
+	if err != nil {
+		return nil, err
+	}
+	return &ActivityZones{
+		ActivityID:  activity.ID,
+		Name:        activity.Name,
+		SportType:   sport.Of(activity),
+		Date:        localDate(activity),
+		Zones:       *zones,
+		TimeInZones: newTimeInZones(analytics.TimeInZones(hr, zones.Zones)),
+	}, nil
+}
+
+type ZoneDistribution struct {
+	After   string         `json:"after"`
+	Before  string         `json:"before"`
+	Sport   string         `json:"sport,omitempty"`
+	GroupBy Grouping       `json:"group_by"`
+	Zones   HeartRateZones `json:"zones"`
+	// Activities counts activities with a heartrate stream, WithoutHeartRate the others in range.
+	Activities       int          `json:"activities"`
+	WithoutHeartRate int          `json:"without_heart_rate"`
+	Total            TimeInZones  `json:"total"`
+	Periods          []ZonePeriod `json:"periods"`
+}
+
+type ZonePeriod struct {
+	Period     string `json:"period"`
+	Activities int    `json:"activities"`
+	TimeInZones
+}
+
+const defaultZoneRange = 12 * 7 * 24 * time.Hour
+
+// GetZoneDistribution aggregates time in heart rate zones over cached activities that started in
+// the range, 12 weeks up to now by default, per ISO week or calendar month of the local start
+// date. filter is a sport name understood by sport.Resolve, or empty for all sports.
+func (s *analyticsService) GetZoneDistribution(_ context.Context, filter string, after *time.Time, before *time.Time, groupBy Grouping) (*ZoneDistribution, error) {
+	to := time.Now()
+	if before != nil {
+		to = *before
+	}
+	from := to.Add(-defaultZoneRange)
+	if after != nil {
+		from = *after
+	}
+	var sports sport.Set
+	if filter != "" {
+		var err error
+		sports, err = sport.Resolve(filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	activities, err := s.cachedActivities()
+	if err != nil {
+		return nil, err
+	}
+	zones, err := s.heartRateZones(activities)
+	if err != nil {
+		return nil, err
+	}
+	result := &ZoneDistribution{
+		After:   from.UTC().Format(time.RFC3339),
+		Before:  to.UTC().Format(time.RFC3339),
+		Sport:   filter,
+		GroupBy: groupBy,
+		Zones:   *zones,
+		Periods: []ZonePeriod{},
+	}
+
+	total := make([]float64, len(zones.Zones))
+	periods := map[string][]float64{}
+	counts := map[string]int{}
+	var order []string
+	for _, activity := range activities {
+		if !inRange(&activity, &from, &to) || (sports != nil && !sports.Contains(&activity)) {
+			continue
+		}
+		streams, err := s.storage.GetActivityStream(fmt.Sprintf("%d", activity.ID))
+		if err != nil {
+			return nil, err
+		}
+		var hr []float64
+		if streams != nil {
+			hr = analytics.PerSecond(streams.Time, streams.Heartrate)
+		}
+		if len(hr) == 0 {
+			result.WithoutHeartRate++
+			continue
+		}
+		result.Activities++
+		seconds := analytics.TimeInZones(hr, zones.Zones)
+		period := groupBy.period(localDate(&activity))
+		if _, ok := periods[period]; !ok {
+			periods[period] = make([]float64, len(zones.Zones))
+			order = append(order, period)
+		}
+		counts[period]++
+		for i, s := range seconds {
+			periods[period][i] += s
+			total[i] += s
+		}
+	}
+
+	result.Total = newTimeInZones(total)
+	for _, period := range order {
+		result.Periods = append(result.Periods, ZonePeriod{Period: period, Activities: counts[period], TimeInZones: newTimeInZones(periods[period])})
+	}
+	return result, nil
+}
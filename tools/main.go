@@ -75,7 +75,7 @@ func generateAuthURL(clientID string) string {
 	params.Add("response_type", "code")
 	params.Add("redirect_uri", "http://localhost/exchange_token")
 	params.Add("approval_prompt", "force")
-	params.Add("scope", "read,activity:read_all")
+	params.Add("scope", "read,activity:read_all,profile:read_all")
 	return fmt.Sprintf("%s?%s", baseURL, params.Encode())
 }
 